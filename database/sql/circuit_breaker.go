@@ -0,0 +1,296 @@
+package goxSql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/metrics"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// States of CircuitBreaker
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
+)
+
+// Metrics of CircuitBreaker (tagged with db_server) - state gauge is 0 = closed, 1 = half-open and 2 = open
+const (
+	CircuitBreakerStateMetricName      = "db_circuit_breaker_state"
+	CircuitBreakerTransitionMetricName = "db_circuit_breaker_transition"
+	CircuitBreakerRejectedMetricName   = "db_circuit_breaker_rejected"
+)
+
+// Tags of CircuitBreaker metrics
+const (
+	CircuitBreakerTagFrom   = "from"
+	CircuitBreakerTagTo     = "to"
+	CircuitBreakerTagReason = "reason"
+)
+
+// ErrCircuitOpen is given (without calling the db) when the circuit is open, or it is half-open and all trial calls are
+// in-flight
+type ErrCircuitOpen struct {
+	ServerName string
+	State      string
+	RetryAfter time.Duration
+}
+
+func (e *ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("db circuit is %s - call rejected: server=%s, retryAfter=%s", e.State, e.ServerName, e.RetryAfter)
+}
+
+// ErrBulkheadFull is given (without calling the db) when the call name already has max allowed calls in-flight
+type ErrBulkheadFull struct {
+	ServerName         string
+	CallName           string
+	MaxConcurrentCalls int
+}
+
+func (e *ErrBulkheadFull) Error() string {
+	return fmt.Sprintf("db call rejected - too many calls in-flight: server=%s, call=%s, maxConcurrentCalls=%d", e.ServerName, e.CallName, e.MaxConcurrentCalls)
+}
+
+// IsCircuitBreakerError returns true if the call was rejected by circuit breaker or bulkhead - the db was not called,
+// so retrying right away does not help
+func IsCircuitBreakerError(err error) bool {
+	var circuitOpen *ErrCircuitOpen
+	var bulkheadFull *ErrBulkheadFull
+	return errors.As(err, &circuitOpen) || errors.As(err, &bulkheadFull)
+}
+
+// CircuitBreaker rejects db calls when the db is degraded (too many failed or slow calls), and caps in-flight calls of
+// each call name. Only errors which show that the db is not healthy (connection errors, timeouts, server shutting down)
+// are failures - errors of the query itself (no rows, duplicate key, bad sql) are not
+type CircuitBreaker struct {
+	serverName string
+	config     CircuitBreakerConfig
+	scope      metrics.Scope
+	logger     *zap.Logger
+	now        func() time.Time
+
+	mu               sync.Mutex
+	state            string
+	openedAt         time.Time
+	buckets          []circuitBucket
+	halfOpenInFlight int
+	halfOpenPassed   int
+	generation       uint64 // incremented on each transition, so trial calls of an old half-open state are ignored
+
+	bulkheads sync.Map
+}
+
+// circuitBucket keeps outcome of calls in one second of the window
+type circuitBucket struct {
+	second int64
+	calls  int
+	failed int
+	slow   int
+}
+
+// NewCircuitBreaker gives a closed circuit breaker for the db server
+func NewCircuitBreaker(cf gox.CrossFunction, serverName string, config CircuitBreakerConfig) *CircuitBreaker {
+	if cf == nil {
+		cf = gox.NewNoOpCrossFunction()
+	}
+	config.SetupDefaults()
+	b := &CircuitBreaker{
+		serverName: serverName,
+		config:     config,
+		scope:      cf.Metric().Tagged(map[string]string{QueryTagDbServer: serverName}),
+		logger:     cf.Logger().Named("goxSql.circuitBreaker"),
+		now:        time.Now,
+		state:      CircuitStateClosed,
+		buckets:    make([]circuitBucket, config.WindowSec),
+	}
+	b.scope.Gauge(CircuitBreakerStateMetricName).Update(circuitStateValue(CircuitStateClosed))
+	return b
+}
+
+// State gives the current state of the circuit
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitStateOpen && b.now().Sub(b.openedAt) >= b.openFor() {
+		return CircuitStateHalfOpen
+	}
+	return b.state
+}
+
+// Call runs f if the circuit and the bulkhead of the call name allow it, else it gives ErrCircuitOpen or ErrBulkheadFull
+// without running f. Error and time taken by f are recorded to decide the state of the circuit
+func (b *CircuitBreaker) Call(callName string, f func() error) error {
+	release, err := b.acquireBulkhead(callName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	trial, generation, err := b.allow(callName)
+	if err != nil {
+		return err
+	}
+	start := b.now()
+	err = f()
+	b.record(trial, generation, err, b.now().Sub(start))
+	return err
+}
+
+func (b *CircuitBreaker) acquireBulkhead(callName string) (func(), error) {
+	limit := b.config.MaxConcurrentCalls
+	if l, ok := b.config.MaxConcurrentCallsByCallName[callName]; ok {
+		limit = l
+	}
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	v, _ := b.bulkheads.LoadOrStore(callName, make(chan struct{}, limit))
+	slots := v.(chan struct{})
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	default:
+		b.reject(callName, "bulkhead_full")
+		return nil, &ErrBulkheadFull{ServerName: b.serverName, CallName: callName, MaxConcurrentCalls: limit}
+	}
+}
+
+// allow gives true (with the generation of the half-open state) if the call is a trial call of half-open circuit
+func (b *CircuitBreaker) allow(callName string) (bool, uint64, error) {
+	b.mu.Lock()
+	now := b.now()
+	if b.state == CircuitStateOpen && now.Sub(b.openedAt) >= b.openFor() {
+		b.transition(CircuitStateHalfOpen)
+	}
+
+	switch b.state {
+	case CircuitStateClosed:
+		b.mu.Unlock()
+		return false, 0, nil
+
+	case CircuitStateHalfOpen:
+		if b.halfOpenInFlight+b.halfOpenPassed < b.config.HalfOpenCalls {
+			b.halfOpenInFlight++
+			generation := b.generation
+			b.mu.Unlock()
+			return true, generation, nil
+		}
+		b.mu.Unlock()
+		b.reject(callName, CircuitStateHalfOpen)
+		return false, 0, &ErrCircuitOpen{ServerName: b.serverName, State: CircuitStateHalfOpen}
+
+	default:
+		retryAfter := b.openFor() - now.Sub(b.openedAt)
+		b.mu.Unlock()
+		b.reject(callName, CircuitStateOpen)
+		return false, 0, &ErrCircuitOpen{ServerName: b.serverName, State: CircuitStateOpen, RetryAfter: retryAfter}
+	}
+}
+
+func (b *CircuitBreaker) record(trial bool, generation uint64, err error, duration time.Duration) {
+	// ErrSkip is not a call - database/sql falls back to another way to run it
+	if err == driver.ErrSkip {
+		if trial {
+			b.mu.Lock()
+			if generation == b.generation {
+				b.halfOpenInFlight--
+			}
+			b.mu.Unlock()
+		}
+		return
+	}
+	failed := isDbHealthError(err)
+	slow := duration >= time.Duration(b.config.SlowCallThresholdMs)*time.Millisecond
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if trial {
+		// Circuit changed state after this trial call started - its in-flight count was already reset
+		if generation != b.generation {
+			return
+		}
+		b.halfOpenInFlight--
+		if failed || slow {
+			b.transition(CircuitStateOpen)
+		} else if b.halfOpenPassed++; b.halfOpenPassed >= b.config.HalfOpenCalls {
+			b.transition(CircuitStateClosed)
+		}
+		return
+	}
+	if b.state != CircuitStateClosed {
+		return
+	}
+
+	second := b.now().Unix()
+	bucket := &b.buckets[second%int64(len(b.buckets))]
+	if bucket.second != second {
+		*bucket = circuitBucket{second: second}
+	}
+	bucket.calls++
+	if failed {
+		bucket.failed++
+	}
+	if slow {
+		bucket.slow++
+	}
+
+	calls, failedCalls, slowCalls := 0, 0, 0
+	for _, bk := range b.buckets {
+		if second-bk.second < int64(len(b.buckets)) {
+			calls += bk.calls
+			failedCalls += bk.failed
+			slowCalls += bk.slow
+		}
+	}
+	if calls < b.config.MinCalls {
+		return
+	}
+	if float64(failedCalls)/float64(calls) >= b.config.ErrorRateThreshold || float64(slowCalls)/float64(calls) >= b.config.SlowCallRateThreshold {
+		b.logger.Warn("db circuit opened",
+			zap.String("server", b.serverName), zap.Int("calls", calls), zap.Int("failed", failedCalls), zap.Int("slow", slowCalls),
+		)
+		b.transition(CircuitStateOpen)
+	}
+}
+
+// transition must be called with lock held
+func (b *CircuitBreaker) transition(to string) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.halfOpenInFlight, b.halfOpenPassed = 0, 0
+	switch to {
+	case CircuitStateOpen:
+		b.openedAt = b.now()
+	case CircuitStateClosed:
+		b.buckets = make([]circuitBucket, len(b.buckets))
+	}
+
+	b.scope.Gauge(CircuitBreakerStateMetricName).Update(circuitStateValue(to))
+	b.scope.Tagged(map[string]string{CircuitBreakerTagFrom: from, CircuitBreakerTagTo: to}).Counter(CircuitBreakerTransitionMetricName).Inc(1)
+	b.logger.Info("db circuit state changed", zap.String("server", b.serverName), zap.String("from", from), zap.String("to", to))
+}
+
+func (b *CircuitBreaker) reject(callName string, reason string) {
+	b.scope.Tagged(map[string]string{QueryTagCall: callName, CircuitBreakerTagReason: reason}).Counter(CircuitBreakerRejectedMetricName).Inc(1)
+}
+
+func (b *CircuitBreaker) openFor() time.Duration {
+	return time.Duration(b.config.OpenForSec) * time.Second
+}
+
+func circuitStateValue(state string) float64 {
+	switch state {
+	case CircuitStateHalfOpen:
+		return 1
+	case CircuitStateOpen:
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,202 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/errors"
+	mockGox "github.com/devlibx/gox-base/mocks"
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newCircuitBreakerForTest(config CircuitBreakerConfig) (*CircuitBreaker, *time.Time) {
+	now := time.Now()
+	b := NewCircuitBreaker(nil, "primary", config)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+// errConnectionRefused is a network error as given by the driver when db is down
+var errConnectionRefused = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+func fail(err error) func() error {
+	return func() error { return err }
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	config := CircuitBreakerConfig{MinCalls: 4, ErrorRateThreshold: 0.5, OpenForSec: 10, HalfOpenCalls: 2}
+
+	t.Run("Circuit opens on error rate and rejects calls", func(t *testing.T) {
+		b, _ := newCircuitBreakerForTest(config)
+		assert.NoError(t, b.Call("get_job", fail(nil)))
+		assert.NoError(t, b.Call("get_job", fail(nil)))
+		assert.Error(t, b.Call("get_job", fail(errConnectionRefused)))
+		assert.Equal(t, CircuitStateClosed, b.State())
+		assert.Error(t, b.Call("get_job", fail(driver.ErrBadConn)))
+		assert.Equal(t, CircuitStateOpen, b.State())
+
+		called := false
+		err := b.Call("get_job", func() error { called = true; return nil })
+		assert.False(t, called)
+		assert.True(t, IsCircuitBreakerError(errors.Wrap(err, "failed")))
+		var circuitOpen *ErrCircuitOpen
+		assert.True(t, errors.As(err, &circuitOpen))
+		assert.Equal(t, CircuitStateOpen, circuitOpen.State)
+		assert.Equal(t, 10*time.Second, circuitOpen.RetryAfter)
+	})
+
+	t.Run("Errors of the query do not open the circuit", func(t *testing.T) {
+		b, _ := newCircuitBreakerForTest(config)
+		for i := 0; i < 10; i++ {
+			_ = b.Call("get_job", fail(sql.ErrNoRows))
+			_ = b.Call("get_job", fail(&mysql.MySQLError{Number: 1062, Message: "duplicate"}))
+			_ = b.Call("get_job", fail(context.Canceled))
+		}
+		assert.Equal(t, CircuitStateClosed, b.State())
+	})
+
+	t.Run("Circuit opens on slow calls", func(t *testing.T) {
+		b, now := newCircuitBreakerForTest(CircuitBreakerConfig{MinCalls: 2, SlowCallThresholdMs: 100, SlowCallRateThreshold: 0.5})
+		slow := func() error { *now = now.Add(200 * time.Millisecond); return nil }
+		assert.NoError(t, b.Call("get_job", fail(nil)))
+		assert.NoError(t, b.Call("get_job", slow))
+		assert.Equal(t, CircuitStateOpen, b.State())
+	})
+
+	t.Run("Old calls are out of the window", func(t *testing.T) {
+		b, now := newCircuitBreakerForTest(CircuitBreakerConfig{MinCalls: 2, WindowSec: 5})
+		_ = b.Call("get_job", fail(errConnectionRefused))
+		*now = now.Add(10 * time.Second)
+		_ = b.Call("get_job", fail(errConnectionRefused))
+		assert.Equal(t, CircuitStateClosed, b.State())
+	})
+
+	t.Run("Half-open circuit closes after trial calls pass", func(t *testing.T) {
+		b, now := newCircuitBreakerForTest(config)
+		for i := 0; i < 4; i++ {
+			_ = b.Call("get_job", fail(errConnectionRefused))
+		}
+		assert.Equal(t, CircuitStateOpen, b.State())
+
+		*now = now.Add(11 * time.Second)
+		assert.Equal(t, CircuitStateHalfOpen, b.State())
+
+		// Only HalfOpenCalls trial calls are let through at a time
+		err := b.Call("get_job", func() error {
+			return b.Call("get_job", func() error {
+				var circuitOpen *ErrCircuitOpen
+				assert.True(t, errors.As(b.Call("get_job", fail(nil)), &circuitOpen))
+				assert.Equal(t, CircuitStateHalfOpen, circuitOpen.State)
+				return nil
+			})
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, CircuitStateClosed, b.State())
+	})
+
+	t.Run("Half-open circuit opens again if a trial call fails", func(t *testing.T) {
+		b, now := newCircuitBreakerForTest(config)
+		for i := 0; i < 4; i++ {
+			_ = b.Call("get_job", fail(errConnectionRefused))
+		}
+		*now = now.Add(11 * time.Second)
+		assert.NoError(t, b.Call("get_job", fail(nil)))
+		assert.Error(t, b.Call("get_job", fail(errConnectionRefused)))
+		assert.Equal(t, CircuitStateOpen, b.State())
+	})
+
+	t.Run("Trial call of an old half-open state is ignored", func(t *testing.T) {
+		b, now := newCircuitBreakerForTest(config)
+		for i := 0; i < 4; i++ {
+			_ = b.Call("get_job", fail(errConnectionRefused))
+		}
+		*now = now.Add(11 * time.Second)
+
+		// Second trial fails and opens the circuit, which is half-open again before the first trial completes
+		err := b.Call("get_job", func() error {
+			assert.Error(t, b.Call("get_job", fail(errConnectionRefused)))
+			assert.Equal(t, CircuitStateOpen, b.State())
+			*now = now.Add(11 * time.Second)
+			assert.Equal(t, CircuitStateHalfOpen, b.State())
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, b.halfOpenInFlight)
+		assert.Equal(t, 0, b.halfOpenPassed)
+
+		// Trial calls of the new half-open state are still capped at HalfOpenCalls
+		err = b.Call("get_job", func() error {
+			return b.Call("get_job", func() error {
+				assert.True(t, IsCircuitBreakerError(b.Call("get_job", fail(nil))))
+				return nil
+			})
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, CircuitStateClosed, b.State())
+	})
+
+	t.Run("Bulkhead caps in-flight calls per call name", func(t *testing.T) {
+		b, _ := newCircuitBreakerForTest(CircuitBreakerConfig{MaxConcurrentCalls: 1, MaxConcurrentCallsByCallName: map[string]int{"poll": 2}})
+		err := b.Call("get_job", func() error {
+			var bulkheadFull *ErrBulkheadFull
+			assert.True(t, errors.As(b.Call("get_job", fail(nil)), &bulkheadFull))
+			assert.Equal(t, 1, bulkheadFull.MaxConcurrentCalls)
+			return b.Call("poll", func() error {
+				return b.Call("poll", func() error {
+					assert.True(t, IsCircuitBreakerError(b.Call("poll", fail(nil))))
+					return nil
+				})
+			})
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, b.Call("get_job", fail(nil)))
+	})
+}
+
+func TestCircuitBreakerMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scope := mockGox.NewMockScope(ctrl)
+	gauge := mockGox.NewMockGauge(ctrl)
+	counter := mockGox.NewMockCounter(ctrl)
+	scope.EXPECT().Tagged(map[string]string{QueryTagDbServer: "primary"}).Return(scope)
+	scope.EXPECT().Gauge(CircuitBreakerStateMetricName).Return(gauge).Times(2)
+	gauge.EXPECT().Update(float64(0))
+	gauge.EXPECT().Update(float64(2))
+	scope.EXPECT().Tagged(map[string]string{CircuitBreakerTagFrom: CircuitStateClosed, CircuitBreakerTagTo: CircuitStateOpen}).Return(scope)
+	scope.EXPECT().Tagged(map[string]string{QueryTagCall: "get_job", CircuitBreakerTagReason: CircuitStateOpen}).Return(scope)
+	scope.EXPECT().Counter(CircuitBreakerTransitionMetricName).Return(counter)
+	scope.EXPECT().Counter(CircuitBreakerRejectedMetricName).Return(counter)
+	counter.EXPECT().Inc(int64(1)).Times(2)
+
+	b := NewCircuitBreaker(gox.NewCrossFunction(scope), "primary", CircuitBreakerConfig{MinCalls: 1})
+	_ = b.Call("get_job", fail(errConnectionRefused))
+	_ = b.Call("get_job", fail(nil))
+}
+
+func TestInstrumentedDbWithCircuitBreaker(t *testing.T) {
+	connector := &fakeConnector{queryErr: errConnectionRefused}
+	db := sql.OpenDB(NewInstrumentedConnector(connector, nil, &MySQLConfig{
+		ServerName:     "primary",
+		CircuitBreaker: CircuitBreakerConfig{Enabled: true, MinCalls: 3},
+	}, nil))
+	defer db.Close()
+
+	for i := 0; i < 5; i++ {
+		_, _ = db.QueryContext(context.Background(), "SELECT id FROM jobs")
+	}
+	// Connect passed and 2 queries failed - circuit opened after 3 calls
+	assert.Equal(t, int32(2), atomic.LoadInt32(&connector.queries))
+
+	_, err := db.QueryContext(WithDbCallName(context.Background(), "get_job"), "SELECT id FROM jobs")
+	assert.True(t, IsCircuitBreakerError(err))
+}
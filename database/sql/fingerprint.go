@@ -0,0 +1,190 @@
+package goxSql
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxCachedFingerprints is the max no of queries whose fingerprint is cached
+const maxCachedFingerprints = 10000
+
+var (
+	fingerprintCache      = sync.Map{}
+	fingerprintCacheCount = int64(0)
+
+	regexValueList     = regexp.MustCompile(`\(\s*\?(\s*,\s*\?)*\s*\)`)
+	regexRepeatedLists = regexp.MustCompile(`\(\?\+\)(\s*,\s*\(\?\+\))+`)
+)
+
+// FingerprintQuery normalizes a query so that all calls of the same query shape give the same fingerprint - comments
+// are removed, literals (strings and signed numbers) become ?, value lists (IN lists, multi row VALUES) become (?+),
+// white space is collapsed and the query is lower-cased e.g.
+//
+//	SELECT * FROM jobs WHERE id IN (1, 2, 3) AND name='a'  =>  select * from jobs where id in (?+) and name=?
+func FingerprintQuery(query string) string {
+	if v, ok := fingerprintCache.Load(query); ok {
+		return v.(string)
+	}
+	fingerprint := fingerprintQuery(query)
+	if atomic.AddInt64(&fingerprintCacheCount, 1) <= maxCachedFingerprints {
+		fingerprintCache.Store(query, fingerprint)
+	}
+	return fingerprint
+}
+
+// FingerprintId gives a short id of the fingerprint of the query - it is used as metric tag
+func FingerprintId(query string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(FingerprintQuery(query)))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+func fingerprintQuery(query string) string {
+	sb := strings.Builder{}
+	sb.Grow(len(query))
+	space := false
+	writeSpace := func() {
+		if space && sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		space = false
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+
+		case c == '-' && i+1 < len(query) && query[i+1] == '-', c == '#':
+			// Comment till end of line
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			space = true
+
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 3
+			}
+			space = true
+
+		case c == '\'' || c == '"':
+			// String literal - quote is escaped by a backslash or by doubling it
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' {
+					i++
+				} else if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			writeSpace()
+			sb.WriteByte('?')
+
+		case c == '`':
+			// Quoted identifier - kept as is
+			end := strings.IndexByte(query[i+1:], '`')
+			writeSpace()
+			if end < 0 {
+				sb.WriteString(strings.ToLower(query[i:]))
+				i = len(query)
+			} else {
+				sb.WriteString(strings.ToLower(query[i : i+end+2]))
+				i += end + 1
+			}
+
+		case c == '-' && isNumberStart(query, i+1) && isUnaryMinusAfter(sb.String()):
+			// Sign of a number literal e.g. "x > -2.5" - it is part of the literal, so it gives the same fingerprint as
+			// "x > 2.5"
+
+		case isNumberStart(query, i):
+			// Number (or hex) literal - a digit inside an identifier is not a literal
+			if sb.Len() > 0 && !space && isIdentifierChar(lastByte(&sb)) {
+				sb.WriteByte(lower(c))
+				continue
+			}
+			hex := c == '0' && i+1 < len(query) && (query[i+1] == 'x' || query[i+1] == 'X')
+			for i+1 < len(query) {
+				if isIdentifierChar(query[i+1]) || query[i+1] == '.' {
+					i++
+				} else if !hex && (query[i] == 'e' || query[i] == 'E') && (query[i+1] == '-' || query[i+1] == '+') && isNumberStart(query, i+2) {
+					// Signed exponent e.g. 1e-3
+					i++
+				} else {
+					break
+				}
+			}
+			writeSpace()
+			sb.WriteByte('?')
+
+		default:
+			writeSpace()
+			sb.WriteByte(lower(c))
+		}
+	}
+
+	result := regexValueList.ReplaceAllString(sb.String(), "(?+)")
+	return regexRepeatedLists.ReplaceAllString(result, "(?+)")
+}
+
+func isNumberStart(query string, i int) bool {
+	return i < len(query) && (isDigit(query[i]) || (query[i] == '.' && i+1 < len(query) && isDigit(query[i+1])))
+}
+
+// unaryMinusKeywords are keywords after which a "-" is the sign of a number and not a minus operator
+var unaryMinusKeywords = map[string]bool{
+	"select": true, "where": true, "and": true, "or": true, "not": true, "on": true, "having": true, "set": true,
+	"values": true, "in": true, "between": true, "like": true, "when": true, "then": true, "else": true, "case": true,
+	"limit": true, "offset": true, "by": true, "is": true, "return": true,
+}
+
+// isUnaryMinusAfter gives true if a "-" which comes after the given (fingerprinted) query is the sign of a number -
+// it is so at the start, after an operator, "(" or "," and after a keyword
+func isUnaryMinusAfter(fingerprinted string) bool {
+	fingerprinted = strings.TrimRight(fingerprinted, " ")
+	if fingerprinted == "" {
+		return true
+	}
+	last := fingerprinted[len(fingerprinted)-1]
+	if strings.IndexByte("=<>!(,+-*/%&|^~", last) >= 0 {
+		return true
+	} else if !isIdentifierChar(last) {
+		return false
+	}
+	start := len(fingerprinted)
+	for start > 0 && isIdentifierChar(fingerprinted[start-1]) {
+		start--
+	}
+	return unaryMinusKeywords[fingerprinted[start:]]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+func lastByte(sb *strings.Builder) byte {
+	s := sb.String()
+	return s[len(s)-1]
+}
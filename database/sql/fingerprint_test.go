@@ -0,0 +1,32 @@
+package goxSql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFingerprintQuery(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM jobs WHERE id IN (1, 2, 3) AND name='a'":                   "select * from jobs where id in (?+) and name=?",
+		"select * from jobs where id in (?,?)":                                    "select * from jobs where id in (?+)",
+		"SELECT id FROM jobs_2 WHERE state = 1 AND x > -2.5e3":                    "select id from jobs_2 where state = ? and x > ?",
+		"INSERT INTO t (a, b) VALUES (1, 'x'), (2, 'y'), (3, 'it''s')":            "insert into t (a, b) values (?+)",
+		"SELECT /* hint */ a FROM `t1` -- comment\n WHERE b = \"q\\\"x\" # other": "select a from `t1` where b = ?",
+		"UPDATE jobs\n\tSET state=?, version=version+1\n WHERE id=0x1F":           "update jobs set state=?, version=version+? where id=?",
+	}
+	for query, expected := range cases {
+		assert.Equal(t, expected, FingerprintQuery(query), query)
+	}
+
+	assert.Equal(t, FingerprintId("select * from t where id in (1,2,3)"), FingerprintId("SELECT * FROM t WHERE id IN (4)"))
+
+	// Sign of a number is part of the literal - a minus operator is kept
+	for _, query := range []string{"select a from t where x > -2.5e3", "select a from t where x > 2.5e3", "select a from t where x > -1e-3", "SELECT a FROM t WHERE x > -.5"} {
+		assert.Equal(t, "select a from t where x > ?", FingerprintQuery(query), query)
+	}
+	assert.Equal(t, FingerprintQuery("select a from t where x in (-1, 2) limit -1"), FingerprintQuery("select a from t where x in (1, -2) limit 1"))
+	assert.Equal(t, FingerprintQuery("select a from t where x = - 1 and y = 1"), "select a from t where x = - ? and y = ?")
+	assert.Equal(t, "update t set v=v-? where id=?", FingerprintQuery("UPDATE t SET v=v-1 WHERE id=-5"))
+	assert.Equal(t, "select a-? from t", FingerprintQuery("select a-1 from t"))
+	assert.NotEqual(t, FingerprintId("select a from t"), FingerprintId("select b from t"))
+}
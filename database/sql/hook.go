@@ -14,6 +14,7 @@ var DefaultLogInfoFunc LogInfoFunc = func(ctx context.Context, query string, arg
 	return LogInfo{
 		ctx:                         ctx,
 		startTime:                   time.Now().UnixMilli(),
+		startedAt:                   time.Now(),
 		name:                        util.GetMethodNameName(5),
 		query:                       query,
 		cleanQuery:                  cleanQuery(query),
@@ -0,0 +1,411 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/errors"
+)
+
+// Operation names used as LogInfo name when ctx does not have a name (see WithDbCallName)
+const (
+	OperationExec     = "exec"
+	OperationQuery    = "query"
+	OperationPrepare  = "prepare"
+	OperationBegin    = "begin"
+	OperationCommit   = "commit"
+	OperationRollback = "rollback"
+	OperationConnect  = "connect"
+)
+
+// WithDbCallName gives a ctx which names the db calls made with it - the name is used in logs, metrics and callbacks
+// of instrumented DB (see OpenInstrumented)
+func WithDbCallName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, DbCallNameKeyInCyx, name)
+}
+
+func dbCallName(ctx context.Context, operation string) string {
+	if ctx != nil {
+		if name, ok := ctx.Value(DbCallNameKeyInCyx).(string); ok && name != "" {
+			return name
+		}
+	}
+	return operation
+}
+
+// instrumentation builds LogInfo for every call made by the instrumented driver
+type instrumentation struct {
+	cf        gox.CrossFunction
+	config    *MySQLConfig
+	callbacks *Callbacks
+
+	// db is the DB opened with this connector - EXPLAIN of slow queries runs on a connection from its pool (nil if the
+	// DB was not opened with OpenInstrumentedDB)
+	db *sql.DB
+
+	// rewriter renames tables in queries as per config (nil if no table is renamed)
+	rewriter *TableNameRewriter
+
+	// breaker rejects calls when db is degraded (nil if circuit breaker is not enabled)
+	breaker *CircuitBreaker
+}
+
+func (i *instrumentation) start(ctx context.Context, operation string, query string) LogInfo {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	li := NewLogInfoExt(ctx, i.cf, query, i.config, i.callbacks)
+	li.name = dbCallName(ctx, operation)
+	if operation == OperationExec || operation == OperationQuery {
+		li.explain = i.explain
+	}
+	return li
+}
+
+// guard runs f through the circuit breaker (if enabled)
+func (i *instrumentation) guard(ctx context.Context, operation string, f func() error) error {
+	if i.breaker == nil {
+		return f()
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return i.breaker.Call(dbCallName(ctx, operation), f)
+}
+
+// OpenInstrumented opens a DB where each Exec, Query, Prepare, Begin, Commit and Rollback is logged, timed and reported to
+// callbacks (same as building a LogInfo by hand) - EnableSqlQueryLogging and EnableSqlQueryMetricLogging of config
+// decide what is logged. Name of the call is taken from ctx (see WithDbCallName), else it is the operation name
+func OpenInstrumented(driverName string, dsn string, cf gox.CrossFunction, config *MySQLConfig, callbacks *Callbacks) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open db: driver=%s", driverName)
+	}
+	d := db.Driver()
+	_ = db.Close()
+
+	var connector driver.Connector
+	if dc, ok := d.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, errors.Wrap(err, "failed to open db connector: driver=%s", driverName)
+		}
+	} else {
+		connector = &dsnConnector{dsn: dsn, driver: d}
+	}
+	return OpenInstrumentedDB(NewInstrumentedConnector(connector, cf, config, callbacks)), nil
+}
+
+// OpenInstrumentedDB is same as sql.OpenDB - for a connector from NewInstrumentedConnector, EXPLAIN of slow queries is
+// run on a connection borrowed from the pool of the returned DB (with sql.OpenDB, EXPLAIN is not captured)
+func OpenInstrumentedDB(connector driver.Connector) *sql.DB {
+	db := sql.OpenDB(connector)
+	bindExplainDb(connector, db)
+	return db
+}
+
+func bindExplainDb(connector driver.Connector, db *sql.DB) {
+	switch c := connector.(type) {
+	case *instrumentedConnector:
+		c.db = db
+	case *closeNotifyingConnector:
+		bindExplainDb(c.Connector, db)
+	}
+}
+
+// NewInstrumentedConnector wraps the connector - use it with OpenInstrumentedDB (see OpenInstrumented)
+func NewInstrumentedConnector(connector driver.Connector, cf gox.CrossFunction, config *MySQLConfig, callbacks *Callbacks) driver.Connector {
+	if config == nil {
+		config = &MySQLConfig{}
+	}
+	if cf == nil {
+		cf = gox.NewNoOpCrossFunction()
+	}
+	i := &instrumentation{
+		cf:        cf,
+		config:    config,
+		callbacks: callbacks,
+		rewriter:  NewTableNameRewriterFromConfig(config),
+	}
+	if config.CircuitBreaker.Enabled {
+		i.breaker = NewCircuitBreaker(cf, config.ServerName, config.CircuitBreaker)
+	}
+	return &instrumentedConnector{Connector: connector, instrumentation: i}
+}
+
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type instrumentedConnector struct {
+	driver.Connector
+	*instrumentation
+}
+
+func (c *instrumentedConnector) Connect(ctx context.Context) (conn driver.Conn, err error) {
+	err = c.guard(ctx, OperationConnect, func() (e error) {
+		conn, e = c.Connector.Connect(ctx)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn: conn, instrumentation: c.instrumentation}, nil
+}
+
+func (c *instrumentedConnector) Driver() driver.Driver {
+	return &instrumentedDriver{Driver: c.Connector.Driver(), instrumentation: c.instrumentation}
+}
+
+type instrumentedDriver struct {
+	driver.Driver
+	*instrumentation
+}
+
+func (d *instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn: conn, instrumentation: d.instrumentation}, nil
+}
+
+// instrumentedConn wraps a driver connection. Optional interfaces which the wrapped connection does not implement
+// give driver.ErrSkip (or the default behaviour), so database/sql falls back as it would without the wrapper
+type instrumentedConn struct {
+	conn driver.Conn
+	*instrumentation
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	query = c.rewriter.RewriteQuery(query)
+	li := c.start(ctx, OperationPrepare, query)
+	defer func() { li.Done(err) }()
+
+	err = c.guard(ctx, OperationPrepare, func() (e error) {
+		if p, ok := c.conn.(driver.ConnPrepareContext); ok {
+			stmt, e = p.PrepareContext(ctx, query)
+		} else {
+			stmt, e = c.conn.Prepare(query)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{stmt: stmt, query: query, instrumentation: c.instrumentation}, nil
+}
+
+func (c *instrumentedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *instrumentedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	li := c.start(ctx, OperationBegin, "BEGIN")
+	defer func() { li.Done(err) }()
+
+	b, ok := c.conn.(driver.ConnBeginTx)
+	if !ok && (opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly) {
+		return nil, errors.New("driver does not support isolation level or read-only txn")
+	}
+	err = c.guard(ctx, OperationBegin, func() (e error) {
+		if ok {
+			tx, e = b.BeginTx(ctx, opts)
+		} else {
+			tx, e = c.conn.Begin()
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{tx: tx, ctx: ctx, instrumentation: c.instrumentation}, nil
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	e, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	query = c.rewriter.RewriteQuery(query)
+	li := c.start(ctx, OperationExec, query)
+	defer func() {
+		// ErrSkip is not a failure - database/sql will prepare and run the statement (which is instrumented)
+		if err != driver.ErrSkip {
+			li.Done(err, namedValuesToArgs(args)...)
+		}
+	}()
+	err = c.guard(ctx, OperationExec, func() (e2 error) {
+		result, e2 = e.ExecContext(ctx, query, args)
+		return
+	})
+	return
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	q, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	query = c.rewriter.RewriteQuery(query)
+	li := c.start(ctx, OperationQuery, query)
+	defer func() {
+		if err != driver.ErrSkip {
+			li.Done(err, namedValuesToArgs(args)...)
+		}
+	}()
+	err = c.guard(ctx, OperationQuery, func() (e error) {
+		rows, e = q.QueryContext(ctx, query, args)
+		return
+	})
+	return
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if p, ok := c.conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if v, ok := c.conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *instrumentedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type instrumentedStmt struct {
+	stmt  driver.Stmt
+	query string
+	*instrumentation
+}
+
+func (s *instrumentedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *instrumentedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *instrumentedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (s *instrumentedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, err error) {
+	li := s.start(ctx, OperationExec, s.query)
+	defer func() { li.Done(err, namedValuesToArgs(args)...) }()
+
+	err = s.guard(ctx, OperationExec, func() (e error) {
+		if ec, ok := s.stmt.(driver.StmtExecContext); ok {
+			result, e = ec.ExecContext(ctx, args)
+		} else {
+			result, e = s.stmt.Exec(namedValuesToValues(args))
+		}
+		return
+	})
+	return
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	li := s.start(ctx, OperationQuery, s.query)
+	defer func() { li.Done(err, namedValuesToArgs(args)...) }()
+
+	err = s.guard(ctx, OperationQuery, func() (e error) {
+		if qc, ok := s.stmt.(driver.StmtQueryContext); ok {
+			rows, e = qc.QueryContext(ctx, args)
+		} else {
+			rows, e = s.stmt.Query(namedValuesToValues(args))
+		}
+		return
+	})
+	return
+}
+
+func (s *instrumentedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// instrumentedTx keeps the ctx of BeginTx - it is used to name Commit and Rollback
+type instrumentedTx struct {
+	tx  driver.Tx
+	ctx context.Context
+	*instrumentation
+}
+
+func (t *instrumentedTx) Commit() (err error) {
+	li := t.start(t.ctx, OperationCommit, "COMMIT")
+	defer func() { li.Done(err) }()
+	return t.tx.Commit()
+}
+
+func (t *instrumentedTx) Rollback() (err error) {
+	li := t.start(t.ctx, OperationRollback, "ROLLBACK")
+	defer func() { li.Done(err) }()
+	return t.tx.Rollback()
+}
+
+func namedValuesToArgs(args []driver.NamedValue) []interface{} {
+	result := make([]interface{}, len(args))
+	for i, a := range args {
+		result[i] = a.Value
+	}
+	return result
+}
+
+func namedValuesToValues(args []driver.NamedValue) []driver.Value {
+	result := make([]driver.Value, len(args))
+	for i, a := range args {
+		result[i] = a.Value
+	}
+	return result
+}
+
+func valuesToNamedValues(args []driver.Value) []driver.NamedValue {
+	result := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		result[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return result
+}
@@ -0,0 +1,188 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInstrumentedDB(t *testing.T) {
+	var calls []PostCallbackData
+	m := &sync.Mutex{}
+	callbacks := &Callbacks{PostCallbackFunc: func(data PostCallbackData) {
+		m.Lock()
+		defer m.Unlock()
+		calls = append(calls, data)
+	}}
+	names := func() []string {
+		m.Lock()
+		defer m.Unlock()
+		var result []string
+		for _, c := range calls {
+			result = append(result, c.Name)
+		}
+		calls = nil
+		return result
+	}
+
+	config := &MySQLConfig{EnableSqlQueryLogging: true}
+	db := sql.OpenDB(NewInstrumentedConnector(&fakeConnector{}, gox.NewNoOpCrossFunction(), config, callbacks))
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, "UPDATE jobs SET state=? WHERE id=?", 1, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{OperationExec}, names())
+
+	rows, err := db.QueryContext(WithDbCallName(ctx, "find_jobs"), "SELECT id FROM jobs")
+	assert.NoError(t, err)
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, []string{"find_jobs"}, names())
+
+	stmt, err := db.PrepareContext(ctx, "SELECT id FROM jobs WHERE id=?")
+	assert.NoError(t, err)
+	row := stmt.QueryRowContext(WithDbCallName(ctx, "find_job"), "a")
+	assert.ErrorIs(t, row.Scan(new(string)), sql.ErrNoRows)
+	assert.NoError(t, stmt.Close())
+	assert.Equal(t, []string{OperationPrepare, "find_job"}, names())
+
+	txCtx := WithDbCallName(ctx, "business")
+	tx, err := db.BeginTx(txCtx, nil)
+	assert.NoError(t, err)
+	_, err = tx.ExecContext(txCtx, "fail")
+	assert.Error(t, err)
+	assert.NoError(t, tx.Rollback())
+
+	m.Lock()
+	assert.Len(t, calls, 3)
+	assert.Error(t, calls[1].Err, "error of the call is given to callback")
+	m.Unlock()
+	assert.Equal(t, []string{"business", "business", "business"}, names())
+}
+
+// fakeConnector gives connections which count queries and fail them with queryErr (if set)
+type fakeConnector struct {
+	connects int32
+	queries  int32
+	queryErr error
+
+	// executed keeps all queries run by Exec and Query
+	executed sync.Map
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	atomic.AddInt32(&c.connects, 1)
+	return &fakeConn{connector: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	connector *fakeConnector
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{connector: c.connector, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.connector.executed.Store(query, true)
+	if query == "fail" {
+		return nil, errors.New("bad query")
+	} else if strings.HasPrefix(query, "UPDATE slow") {
+		time.Sleep(20 * time.Millisecond)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	atomic.AddInt32(&c.connector.queries, 1)
+	c.connector.executed.Store(query, true)
+	if c.connector.queryErr != nil {
+		return nil, c.connector.queryErr
+	}
+	if strings.HasPrefix(query, "EXPLAIN ") && len(args) > 0 {
+		// Same as MySQL driver without InterpolateParams - a query with args must be prepared
+		return nil, driver.ErrSkip
+	}
+	return &fakeRows{columns: []string{"id"}}, nil
+}
+
+type fakeStmt struct {
+	connector *fakeConnector
+	query     string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.connector != nil {
+		s.connector.executed.Store(s.query, true)
+	}
+	if strings.HasPrefix(s.query, "EXPLAIN ") {
+		return &fakeRows{columns: []string{"table", "type"}, rows: [][]driver.Value{{[]byte("slow"), "ALL"}}}, nil
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeTx struct{}
+
+func (t *fakeTx) Commit() error {
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -2,9 +2,12 @@ package goxSql
 
 import (
 	"context"
+	"database/sql"
 	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/metrics"
 	"github.com/devlibx/gox-base/util"
-	"github.com/rcrowley/go-metrics"
+	pkgErrors "github.com/pkg/errors"
+	goMetrics "github.com/rcrowley/go-metrics"
 	"go.uber.org/zap"
 	"log"
 	"os"
@@ -17,15 +20,32 @@ import (
 var regexToCleanQueryToDump = regexp.MustCompile(`^[^\n]+\n`)
 var startMetricDumpSyncOnce = sync.Once{}
 
+// Metric name and tags of the query timer recorded by LogInfo
+const (
+	QueryTimerMetricName = "db_query"
+	QueryTagCall         = "call"
+	QueryTagDbServer     = "db_server"
+	QueryTagOutcome      = "outcome"
+	QueryTagFingerprint  = "query_fingerprint"
+
+	QueryOutcomeSuccess = "success"
+	QueryOutcomeNoRows  = "no_rows"
+	QueryOutcomeError   = "error"
+)
+
 type LogInfo struct {
 	ctx                         context.Context
 	name                        string
 	startTime                   int64
+	startedAt                   time.Time
 	timeTaken                   int64
 	query                       string
 	cleanQuery                  string
 	logger                      *zap.Logger
-	hist                        metrics.Histogram
+	scope                       metrics.Scope
+	dbServer                    string
+	config                      *MySQLConfig
+	explain                     explainFunc
 	callbacks                   *Callbacks
 	enableSqlQueryLogging       bool
 	enableSqlQueryMetricLogging bool
@@ -36,17 +56,27 @@ func (l LogInfo) Done(err error, args ...interface{}) {
 	endTime := time.Now().UnixMilli()
 	l.timeTaken = endTime - l.startTime
 
-	if l.enableSqlQueryMetricLogging {
-		q := l.cleanQuery
-		l.hist = metrics.GetOrRegisterHistogram(q, metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015))
-		l.hist.Update(l.timeTaken)
+	if l.enableSqlQueryMetricLogging && l.scope != nil {
+		l.scope.Tagged(map[string]string{
+			QueryTagCall:        l.name,
+			QueryTagDbServer:    l.dbServer,
+			QueryTagOutcome:     queryOutcome(err),
+			QueryTagFingerprint: FingerprintId(l.query),
+		}).Timer(QueryTimerMetricName).Record(time.Since(l.startedAt))
+	} else if l.enableSqlQueryMetricLogging {
+		// No metric scope (LogInfo from NewLogInfo or DefaultLogInfoFunc) - keep recording in rcrowley/go-metrics
+		// registry, as it was done before metric scope was used
+		hist := goMetrics.GetOrRegisterHistogram(l.cleanQuery, goMetrics.DefaultRegistry, goMetrics.NewExpDecaySample(1028, 0.015))
+		hist.Update(l.timeTaken)
 	}
 
-	if l.enableSqlQueryLogging {
+	if l.enableSqlQueryLogging && l.logger != nil {
 		l.logger.Info(l.name, zap.Int64("time", l.timeTaken), zap.String("query", l.cleanQuery), zap.Any("args", args))
 	}
 
-	if l.callbacks != nil {
+	l.checkSlowQuery(time.Since(l.startedAt), err, args)
+
+	if l.callbacks != nil && l.callbacks.PostCallbackFunc != nil {
 		l.callbacks.PostCallbackFunc(PostCallbackData{
 			Ctx:       l.ctx,
 			Name:      l.name,
@@ -58,21 +88,39 @@ func (l LogInfo) Done(err error, args ...interface{}) {
 	}
 }
 
+func queryOutcome(err error) string {
+	if err == nil {
+		return QueryOutcomeSuccess
+	} else if pkgErrors.Is(err, sql.ErrNoRows) {
+		return QueryOutcomeNoRows
+	}
+	return QueryOutcomeError
+}
+
 func cleanQuery(query string) string {
 	result := regexToCleanQueryToDump.ReplaceAllString(query, "")
 	result = strings.ReplaceAll(result, "\n", " ")
 	return strings.TrimSpace(result)
 }
 
+// NewLogInfoExt gives a LogInfo which records query time with the metric scope of cross function (tagged by call name,
+// db server and outcome), and reports slow queries as per config
 func NewLogInfoExt(ctx context.Context, cf gox.CrossFunction, query string, config *MySQLConfig, callbacks *Callbacks) LogInfo {
-	return NewLogInfo(ctx, query, cf.Logger(), config.EnableSqlQueryLogging, config.EnableSqlQueryMetricLogging, callbacks)
+	l := NewLogInfo(ctx, query, cf.Logger(), config.EnableSqlQueryLogging, config.EnableSqlQueryMetricLogging, callbacks)
+	l.scope = cf.Metric()
+	l.dbServer = config.ServerName
+	l.config = config
+	return l
 }
 
-// NewLogInfo will return a LogInfo object which is initialized with default and other values
+// NewLogInfo will return a LogInfo object which is initialized with default and other values. It has no metric scope, so
+// query time is recorded (if enableSqlQueryMetricLogging is set) in a histogram per query in rcrowley/go-metrics
+// DefaultRegistry - use NewLogInfoExt to record it with the metric scope of CrossFunction
 func NewLogInfo(ctx context.Context, query string, logger *zap.Logger, enableSqlQueryLogging bool, enableSqlQueryMetricLogging bool, callbacks *Callbacks) LogInfo {
 	return LogInfo{
 		ctx:                         ctx,
 		startTime:                   time.Now().UnixMilli(),
+		startedAt:                   time.Now(),
 		name:                        util.GetMethodNameName(5),
 		query:                       query,
 		cleanQuery:                  cleanQuery(query),
@@ -84,16 +132,17 @@ func NewLogInfo(ctx context.Context, query string, logger *zap.Logger, enableSql
 }
 
 // StartMetricDump should be called if you want to dump the metrics to console - this is mostly used in debugging or
-// perf testing
+// perf testing. Only query time of LogInfo without a metric scope (see NewLogInfo) is in the rcrowley/go-metrics
+// registry - LogInfo from NewLogInfoExt records it with the metric scope of CrossFunction
 func StartMetricDump(ctx context.Context, config *MySQLConfig) {
 	// Start metric dumping - start only once
 	startMetricDumpSyncOnce.Do(func() {
 
 		// Dump all metric every 10 sec
 		if config.MetricDumpIntervalSec > 0 {
-			go metrics.Log(metrics.DefaultRegistry, time.Duration(config.MetricDumpIntervalSec)*time.Second, log.New(os.Stderr, "metrics: ", log.Lmicroseconds))
+			go goMetrics.Log(goMetrics.DefaultRegistry, time.Duration(config.MetricDumpIntervalSec)*time.Second, log.New(os.Stderr, "metrics: ", log.Lmicroseconds))
 		} else {
-			go metrics.Log(metrics.DefaultRegistry, 10*time.Second, log.New(os.Stderr, "metrics: ", log.Lmicroseconds))
+			go goMetrics.Log(goMetrics.DefaultRegistry, 10*time.Second, log.New(os.Stderr, "metrics: ", log.Lmicroseconds))
 		}
 
 		// Clear all metrics every 10 min and start fresh - this will avoid leak and also will give you fresh stats
@@ -109,7 +158,7 @@ func StartMetricDump(ctx context.Context, config *MySQLConfig) {
 				case <-ctx.Done():
 					goto exit
 				case <-time.After(d):
-					metrics.DefaultRegistry.UnregisterAll()
+					goMetrics.DefaultRegistry.UnregisterAll()
 				}
 			}
 		}()
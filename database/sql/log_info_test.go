@@ -0,0 +1,61 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/errors"
+	mockGox "github.com/devlibx/gox-base/mocks"
+	"github.com/golang/mock/gomock"
+	goMetrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLogInfoRecordsQueryTimer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	scope := mockGox.NewMockScope(ctrl)
+	timer := mockGox.NewMockTimer(ctrl)
+	cf := gox.NewCrossFunction(scope)
+	config := &MySQLConfig{ServerName: "primary", EnableSqlQueryMetricLogging: true}
+
+	query := "SELECT * FROM jobs WHERE id IN (1, 2)"
+	for err, outcome := range map[error]string{
+		errors.New("bad error"):              QueryOutcomeError,
+		errors.Wrap(sql.ErrNoRows, "no job"): QueryOutcomeNoRows,
+		nil:                                  QueryOutcomeSuccess,
+	} {
+		scope.EXPECT().Tagged(map[string]string{
+			QueryTagCall:        "find_jobs",
+			QueryTagDbServer:    "primary",
+			QueryTagOutcome:     outcome,
+			QueryTagFingerprint: FingerprintId("select * from jobs where id in (?)"),
+		}).Return(scope)
+		scope.EXPECT().Timer(QueryTimerMetricName).Return(timer)
+		timer.EXPECT().Record(gomock.Any())
+
+		li := NewLogInfoExt(context.Background(), cf, query, config, nil)
+		li.name = "find_jobs"
+		li.Done(err)
+	}
+
+	// Nothing is recorded if metric logging is disabled
+	li := NewLogInfoExt(context.Background(), cf, query, &MySQLConfig{}, nil)
+	li.Done(nil)
+}
+
+func TestLogInfoWithoutScopeRecordsInDefaultRegistry(t *testing.T) {
+	query := "SELECT * FROM jobs WHERE id = 'log-info-without-scope'"
+	goMetrics.DefaultRegistry.Unregister(query)
+	t.Cleanup(func() { goMetrics.DefaultRegistry.Unregister(query) })
+
+	NewLogInfo(context.Background(), query, nil, false, true, nil).Done(nil)
+	hist, ok := goMetrics.DefaultRegistry.Get(query).(goMetrics.Histogram)
+	if assert.True(t, ok) {
+		assert.Equal(t, int64(1), hist.Count())
+	}
+
+	// Nothing is recorded if metric logging is disabled
+	NewLogInfo(context.Background(), query, nil, false, false, nil).Done(nil)
+	assert.Equal(t, int64(1), hist.Count())
+}
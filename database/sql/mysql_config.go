@@ -2,26 +2,79 @@ package goxSql
 
 import (
 	"context"
+	"crypto/tls"
 	"github.com/devlibx/gox-base/util"
 )
 
 const DbCallNameKeyInCyx = "__SQLCX_DB_CALL_NAME__"
 
 type MySQLConfig struct {
-	ServerName   string `json:"server_name" yaml:"server_name"`
-	Host         string `json:"host" yaml:"host"`
-	Port         int    `json:"port" yaml:"port"`
-	User         string `json:"user" yaml:"user"`
-	Password     string `json:"password" yaml:"password"`
-	Db           string `json:"db" yaml:"db"`
-	TablePrefix  string
-	TablePostfix string
+	ServerName string `json:"server_name" yaml:"server_name"`
+	Host       string `json:"host" yaml:"host"`
+	Port       int    `json:"port" yaml:"port"`
+	User       string `json:"user" yaml:"user"`
+	Password   string `json:"password" yaml:"password"`
+	Db         string `json:"db" yaml:"db"`
+
+	// TablePrefix and TablePostfix are added to all tables in queries, TableNameMapping renames the given tables instead
+	// (see TableNameRewriter) - tables are renamed by the DB opened with Open or OpenInstrumented
+	TablePrefix      string
+	TablePostfix     string
+	TableNameMapping map[string]string `json:"table_name_mapping" yaml:"table_name_mapping"`
+
+	// Connection options used by Open - timeouts are in ms (defaults: connect = 5000, read = 30000, write = 30000).
+	// TLS is the TLS mode of the driver ("true", "skip-verify", "preferred" or a registered name), TLSConfig if set
+	// is used instead of it. Charset defaults to utf8mb4, Location (for time values) to UTC. Params are added to DSN
+	ConnectTimeoutMs int               `json:"connect_timeout_ms" yaml:"connect_timeout_ms"`
+	ReadTimeoutMs    int               `json:"read_timeout_ms" yaml:"read_timeout_ms"`
+	WriteTimeoutMs   int               `json:"write_timeout_ms" yaml:"write_timeout_ms"`
+	TLS              string            `json:"tls" yaml:"tls"`
+	TLSConfig        *tls.Config       `json:"-" yaml:"-"`
+	Charset          string            `json:"charset" yaml:"charset"`
+	Collation        string            `json:"collation" yaml:"collation"`
+	Location         string            `json:"location" yaml:"location"`
+	DisableParseTime bool              `json:"disable_parse_time" yaml:"disable_parse_time"`
+	Params           map[string]string `json:"params" yaml:"params"`
+
+	// Pool options used by Open (defaults: max open = 10, max idle = 10, max lifetime = 60 sec, no max idle time)
+	MaxOpenConnections int `json:"max_open_connections" yaml:"max_open_connections"`
+	MaxIdleConnections int `json:"max_idle_connections" yaml:"max_idle_connections"`
+	ConnMaxLifetimeSec int `json:"conn_max_lifetime_sec" yaml:"conn_max_lifetime_sec"`
+	ConnMaxIdleTimeSec int `json:"conn_max_idle_time_sec" yaml:"conn_max_idle_time_sec"`
+
+	// Open pings the db StartupPingAttempts times (default = 3) with StartupPingBackoffMs (default = 1000) between
+	// attempts, and reports pool stats every PoolStatsReportIntervalSec (default = 10)
+	StartupPingAttempts        int `json:"startup_ping_attempts" yaml:"startup_ping_attempts"`
+	StartupPingBackoffMs       int `json:"startup_ping_backoff_ms" yaml:"startup_ping_backoff_ms"`
+	PoolStatsReportIntervalSec int `json:"pool_stats_report_interval_sec" yaml:"pool_stats_report_interval_sec"`
+
+	// Replicas are read replicas of this db (see Router) - user, password and db are same as the primary
+	Replicas       []MySQLReplicaConfig `json:"replicas" yaml:"replicas"`
+	ReplicaRouting ReplicaRoutingConfig `json:"replica_routing" yaml:"replica_routing"`
+
+	// CircuitBreaker fails calls fast when the db is degraded, and caps in-flight calls per call name (only with
+	// instrumented DB - see Open and OpenInstrumented)
+	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker" yaml:"circuit_breaker"`
 
 	EnableSqlQueryLogging bool `json:"enable_sql_query_logging" yaml:"enable_sql_query_logging"`
 
 	EnableSqlQueryMetricLogging bool `json:"enable_sql_query_metric_logging" yaml:"enable_sql_query_metric_logging"`
 	MetricDumpIntervalSec       int  `json:"metric_dump_interval_sec" yaml:"metric_dump_interval_sec"`
 	MetricResetAfterEveryNSec   int  `json:"metric_reset_after_every_n_sec" yaml:"metric_reset_after_every_n_sec"`
+
+	// SlowQueryThresholdMs - a query which takes more time is logged as slow query and given to SlowQueryCallbackFunc
+	// (0 = slow query detection is disabled). SlowQueryThresholdMsByCallName overrides it for a call name
+	SlowQueryThresholdMs           int            `json:"slow_query_threshold_ms" yaml:"slow_query_threshold_ms"`
+	SlowQueryThresholdMsByCallName map[string]int `json:"slow_query_threshold_ms_by_call_name" yaml:"slow_query_threshold_ms_by_call_name"`
+
+	// LogSlowQueryArgValues - by default args of a slow query are redacted (only type is logged). If set, values are
+	// logged (strings are truncated to SlowQueryMaxArgLength, default = 64)
+	LogSlowQueryArgValues bool `json:"log_slow_query_arg_values" yaml:"log_slow_query_arg_values"`
+	SlowQueryMaxArgLength int  `json:"slow_query_max_arg_length" yaml:"slow_query_max_arg_length"`
+
+	// SlowQueryExplainSampleRate is the fraction [0, 1] of slow queries for which EXPLAIN is captured (only with
+	// instrumented DB - see OpenInstrumented)
+	SlowQueryExplainSampleRate float64 `json:"slow_query_explain_sample_rate" yaml:"slow_query_explain_sample_rate"`
 }
 
 func (m *MySQLConfig) SetupDefaults() {
@@ -40,10 +93,123 @@ func (m *MySQLConfig) SetupDefaults() {
 	if util.IsStringEmpty(m.Db) {
 		m.Db = "conversation"
 	}
+	if m.ConnectTimeoutMs <= 0 {
+		m.ConnectTimeoutMs = 5000
+	}
+	if m.ReadTimeoutMs <= 0 {
+		m.ReadTimeoutMs = 30000
+	}
+	if m.WriteTimeoutMs <= 0 {
+		m.WriteTimeoutMs = 30000
+	}
+	if util.IsStringEmpty(m.Charset) {
+		m.Charset = "utf8mb4"
+	}
+	if util.IsStringEmpty(m.Location) {
+		m.Location = "UTC"
+	}
+	if m.MaxOpenConnections <= 0 {
+		m.MaxOpenConnections = 10
+	}
+	if m.MaxIdleConnections <= 0 {
+		m.MaxIdleConnections = 10
+	}
+	if m.ConnMaxLifetimeSec <= 0 {
+		m.ConnMaxLifetimeSec = 60
+	}
+	if m.StartupPingAttempts <= 0 {
+		m.StartupPingAttempts = 3
+	}
+	if m.StartupPingBackoffMs <= 0 {
+		m.StartupPingBackoffMs = 1000
+	}
+	if m.PoolStatsReportIntervalSec <= 0 {
+		m.PoolStatsReportIntervalSec = 10
+	}
+}
+
+// MySQLReplicaConfig is a read replica endpoint
+type MySQLReplicaConfig struct {
+	ServerName string `json:"server_name" yaml:"server_name"`
+	Host       string `json:"host" yaml:"host"`
+	Port       int    `json:"port" yaml:"port"`
+}
+
+// ReplicaRoutingConfig controls how Router picks a replica and when it ejects a replica
+type ReplicaRoutingConfig struct {
+	// Selection is ReplicaSelectionRoundRobin (default) or ReplicaSelectionLeastLatency
+	Selection string `json:"selection" yaml:"selection"`
+
+	// A replica which fails EjectAfterErrors (default = 3) calls in a row is not used for EjectForSec (default = 30)
+	EjectAfterErrors int `json:"eject_after_errors" yaml:"eject_after_errors"`
+	EjectForSec      int `json:"eject_for_sec" yaml:"eject_for_sec"`
+}
+
+func (r *ReplicaRoutingConfig) SetupDefaults() {
+	if r.Selection == "" {
+		r.Selection = ReplicaSelectionRoundRobin
+	}
+	if r.EjectAfterErrors <= 0 {
+		r.EjectAfterErrors = 3
+	}
+	if r.EjectForSec <= 0 {
+		r.EjectForSec = 30
+	}
+}
+
+// CircuitBreakerConfig controls when CircuitBreaker opens, and the bulkhead (max in-flight calls per call name)
+type CircuitBreakerConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Circuit opens if in last WindowSec (default = 10) there are at least MinCalls (default = 20) calls, and the
+	// fraction of failed calls is ErrorRateThreshold (default = 0.5) or more, or the fraction of calls slower than
+	// SlowCallThresholdMs (default = 1000) is SlowCallRateThreshold (default = 0.8) or more
+	WindowSec             int     `json:"window_sec" yaml:"window_sec"`
+	MinCalls              int     `json:"min_calls" yaml:"min_calls"`
+	ErrorRateThreshold    float64 `json:"error_rate_threshold" yaml:"error_rate_threshold"`
+	SlowCallThresholdMs   int     `json:"slow_call_threshold_ms" yaml:"slow_call_threshold_ms"`
+	SlowCallRateThreshold float64 `json:"slow_call_rate_threshold" yaml:"slow_call_rate_threshold"`
+
+	// Open circuit rejects calls for OpenForSec (default = 30), then it is half-open - HalfOpenCalls (default = 5) trial
+	// calls are let through. Circuit closes if all of them pass, and opens again if any one fails
+	OpenForSec    int `json:"open_for_sec" yaml:"open_for_sec"`
+	HalfOpenCalls int `json:"half_open_calls" yaml:"half_open_calls"`
+
+	// MaxConcurrentCalls caps in-flight calls of each call name (0 = no cap). MaxConcurrentCallsByCallName overrides it
+	// for a call name
+	MaxConcurrentCalls           int            `json:"max_concurrent_calls" yaml:"max_concurrent_calls"`
+	MaxConcurrentCallsByCallName map[string]int `json:"max_concurrent_calls_by_call_name" yaml:"max_concurrent_calls_by_call_name"`
+}
+
+func (c *CircuitBreakerConfig) SetupDefaults() {
+	if c.WindowSec <= 0 {
+		c.WindowSec = 10
+	}
+	if c.MinCalls <= 0 {
+		c.MinCalls = 20
+	}
+	if c.ErrorRateThreshold <= 0 {
+		c.ErrorRateThreshold = 0.5
+	}
+	if c.SlowCallThresholdMs <= 0 {
+		c.SlowCallThresholdMs = 1000
+	}
+	if c.SlowCallRateThreshold <= 0 {
+		c.SlowCallRateThreshold = 0.8
+	}
+	if c.OpenForSec <= 0 {
+		c.OpenForSec = 30
+	}
+	if c.HalfOpenCalls <= 0 {
+		c.HalfOpenCalls = 5
+	}
 }
 
 type Callbacks struct {
 	PostCallbackFunc PostCallbackFunc
+
+	// SlowQueryCallbackFunc is called for each query slower than the slow query threshold (see MySQLConfig)
+	SlowQueryCallbackFunc SlowQueryCallbackFunc
 }
 
 type PostCallbackData struct {
@@ -53,6 +219,9 @@ type PostCallbackData struct {
 	EndTime   int64           `json:"end_time"`
 	TimeTaken int64           `json:"time_taken"`
 	Err       error           `json:"error"`
+
+	// Attempts is the no of times the txn was tried (set by RunInTx)
+	Attempts int `json:"attempts,omitempty"`
 }
 
 func (p *PostCallbackData) GetDbCallNameForTracing() string {
@@ -0,0 +1,212 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/metrics"
+	"github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+	"io"
+	"time"
+)
+
+// Gauges of db pool stats reported by Open (tagged with db_server)
+const (
+	PoolStatsMaxOpen           = "db_pool_max_open"
+	PoolStatsOpen              = "db_pool_open"
+	PoolStatsInUse             = "db_pool_in_use"
+	PoolStatsIdle              = "db_pool_idle"
+	PoolStatsWaitCount         = "db_pool_wait_count"
+	PoolStatsWaitDurationMs    = "db_pool_wait_duration_ms"
+	PoolStatsMaxIdleClosed     = "db_pool_max_idle_closed"
+	PoolStatsMaxLifetimeClosed = "db_pool_max_lifetime_closed"
+)
+
+// DriverConfig gives the go-sql-driver/mysql config (with all DSN options) for this config
+func (m *MySQLConfig) DriverConfig() (*mysql.Config, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = m.User
+	cfg.Passwd = m.Password
+	cfg.Net = "tcp"
+	cfg.Addr = fmt.Sprintf("%s:%d", m.Host, m.Port)
+	cfg.DBName = m.Db
+	cfg.Timeout = time.Duration(m.ConnectTimeoutMs) * time.Millisecond
+	cfg.ReadTimeout = time.Duration(m.ReadTimeoutMs) * time.Millisecond
+	cfg.WriteTimeout = time.Duration(m.WriteTimeoutMs) * time.Millisecond
+	cfg.ParseTime = !m.DisableParseTime
+	if m.Collation != "" {
+		cfg.Collation = m.Collation
+	}
+
+	if m.Location != "" {
+		loc, err := time.LoadLocation(m.Location)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad location in mysql config: location=%s", m.Location)
+		}
+		cfg.Loc = loc
+	}
+
+	if m.TLSConfig != nil {
+		cfg.TLS = m.TLSConfig.Clone()
+	} else if m.TLS != "" {
+		cfg.TLSConfig = m.TLS
+	}
+
+	cfg.Params = map[string]string{}
+	if m.Charset != "" {
+		cfg.Params["charset"] = m.Charset
+	}
+	for k, v := range m.Params {
+		cfg.Params[k] = v
+	}
+
+	// Parse the DSN back - it validates the options (e.g. TLS name) the same way as sql.Open would
+	if _, err := mysql.ParseDSN(cfg.FormatDSN()); err != nil && m.TLSConfig == nil {
+		return nil, errors.Wrap(err, "bad mysql config: server=%s", m.ServerName)
+	}
+	return cfg, nil
+}
+
+// Open gives a pooled and instrumented (see OpenInstrumented) DB for the config. It pings the db at startup (with
+// retry) and reports pool stats as gauges until the DB is closed
+func Open(cf gox.CrossFunction, config MySQLConfig) (*sql.DB, error) {
+	return OpenWithCallbacks(cf, config, nil)
+}
+
+// OpenWithCallbacks is same as Open - callbacks are called for every db call
+func OpenWithCallbacks(cf gox.CrossFunction, config MySQLConfig, callbacks *Callbacks) (*sql.DB, error) {
+	if cf == nil {
+		cf = gox.NewNoOpCrossFunction()
+	}
+	config.SetupDefaults()
+
+	cfg, err := config.DriverConfig()
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open db: server=%s", config.ServerName)
+	}
+
+	ctx, stopReporter := context.WithCancel(context.Background())
+	db := OpenInstrumentedDB(&closeNotifyingConnector{
+		Connector: NewInstrumentedConnector(connector, cf, &config, callbacks),
+		onClose:   stopReporter,
+	})
+	db.SetMaxOpenConns(config.MaxOpenConnections)
+	db.SetMaxIdleConns(config.MaxIdleConnections)
+	db.SetConnMaxLifetime(time.Duration(config.ConnMaxLifetimeSec) * time.Second)
+	if config.ConnMaxIdleTimeSec > 0 {
+		db.SetConnMaxIdleTime(time.Duration(config.ConnMaxIdleTimeSec) * time.Second)
+	}
+
+	if err = pingWithRetry(db, config, cf.Logger()); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	go StartPoolStatsReporter(ctx, cf.Metric(), config.ServerName, db, time.Duration(config.PoolStatsReportIntervalSec)*time.Second)
+	return db, nil
+}
+
+func pingWithRetry(db *sql.DB, config MySQLConfig, logger *zap.Logger) (err error) {
+	for attempt := 1; attempt <= config.StartupPingAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ConnectTimeoutMs)*time.Millisecond)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		logger.Warn("failed to ping db", zap.String("server", config.ServerName), zap.Int("attempt", attempt), zap.Error(err))
+		if attempt < config.StartupPingAttempts {
+			time.Sleep(time.Duration(config.StartupPingBackoffMs) * time.Millisecond)
+		}
+	}
+	return errors.Wrap(err, "failed to ping db: server=%s, host=%s, attempts=%d", config.ServerName, config.Host, config.StartupPingAttempts)
+}
+
+// StartPoolStatsReporter reports pool stats of the DB as gauges every interval till ctx is done
+func StartPoolStatsReporter(ctx context.Context, scope metrics.Scope, serverName string, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ReportPoolStats(scope, serverName, db.Stats())
+		}
+	}
+}
+
+// ReportPoolStats reports the pool stats as gauges tagged with db server
+func ReportPoolStats(scope metrics.Scope, serverName string, stats sql.DBStats) {
+	s := scope.Tagged(map[string]string{QueryTagDbServer: serverName})
+	s.Gauge(PoolStatsMaxOpen).Update(float64(stats.MaxOpenConnections))
+	s.Gauge(PoolStatsOpen).Update(float64(stats.OpenConnections))
+	s.Gauge(PoolStatsInUse).Update(float64(stats.InUse))
+	s.Gauge(PoolStatsIdle).Update(float64(stats.Idle))
+	s.Gauge(PoolStatsWaitCount).Update(float64(stats.WaitCount))
+	s.Gauge(PoolStatsWaitDurationMs).Update(float64(stats.WaitDuration.Milliseconds()))
+	s.Gauge(PoolStatsMaxIdleClosed).Update(float64(stats.MaxIdleClosed))
+	s.Gauge(PoolStatsMaxLifetimeClosed).Update(float64(stats.MaxLifetimeClosed))
+}
+
+// closeNotifyingConnector calls onClose when the DB is closed (sql.DB closes a connector which is an io.Closer)
+type closeNotifyingConnector struct {
+	driver.Connector
+	onClose func()
+}
+
+func (c *closeNotifyingConnector) Close() error {
+	c.onClose()
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// OpenRouter opens the primary and all replicas of the config (see Open) and gives a Router over them
+func OpenRouter(cf gox.CrossFunction, config MySQLConfig) (*Router, error) {
+	primary, err := Open(cf, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var replicas []Replica
+	closeAll := func() {
+		_ = primary.Close()
+		for _, r := range replicas {
+			_ = r.DB.Close()
+		}
+	}
+	for i, rc := range config.Replicas {
+		replicaConfig := config
+		replicaConfig.ServerName = rc.ServerName
+		if replicaConfig.ServerName == "" {
+			replicaConfig.ServerName = fmt.Sprintf("%s-replica-%d", config.ServerName, i)
+		}
+		replicaConfig.Host = rc.Host
+		replicaConfig.Port = rc.Port
+		replicaConfig.Replicas = nil
+
+		var db *sql.DB
+		if db, err = Open(cf, replicaConfig); err != nil {
+			closeAll()
+			return nil, errors.Wrap(err, "failed to open replica: server=%s", replicaConfig.ServerName)
+		}
+		replicas = append(replicas, Replica{Name: replicaConfig.ServerName, DB: db})
+	}
+
+	router, err := NewRouter(cf, primary, replicas, config.ReplicaRouting)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	return router, nil
+}
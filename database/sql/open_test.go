@@ -0,0 +1,110 @@
+package goxSql
+
+import (
+	"crypto/tls"
+	"database/sql"
+	mockGox "github.com/devlibx/gox-base/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMySQLConfig_DriverConfig(t *testing.T) {
+	t.Run("Defaults are set in driver config", func(t *testing.T) {
+		config := MySQLConfig{Host: "db.local", Port: 3307, User: "user", Password: "pass", Db: "jobs"}
+		config.SetupDefaults()
+		cfg, err := config.DriverConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, "db.local:3307", cfg.Addr)
+		assert.Equal(t, "jobs", cfg.DBName)
+		assert.True(t, cfg.ParseTime)
+		assert.Equal(t, 5*time.Second, cfg.Timeout)
+		assert.Equal(t, 30*time.Second, cfg.ReadTimeout)
+		assert.Equal(t, 30*time.Second, cfg.WriteTimeout)
+		assert.Equal(t, time.UTC, cfg.Loc)
+		assert.Equal(t, "utf8mb4", cfg.Params["charset"])
+		assert.Equal(t, "user:pass@tcp(db.local:3307)/jobs?parseTime=true&readTimeout=30s&timeout=5s&writeTimeout=30s&charset=utf8mb4", cfg.FormatDSN())
+	})
+
+	t.Run("Options are set in driver config", func(t *testing.T) {
+		config := MySQLConfig{
+			Host:             "db.local",
+			Port:             3306,
+			Db:               "jobs",
+			TLS:              "skip-verify",
+			Collation:        "utf8mb4_bin",
+			Location:         "Asia/Kolkata",
+			DisableParseTime: true,
+			Params:           map[string]string{"sql_mode": "'STRICT_ALL_TABLES'"},
+		}
+		config.SetupDefaults()
+		cfg, err := config.DriverConfig()
+		assert.NoError(t, err)
+		assert.False(t, cfg.ParseTime)
+		assert.Equal(t, "skip-verify", cfg.TLSConfig)
+		assert.Equal(t, "utf8mb4_bin", cfg.Collation)
+		assert.Equal(t, "Asia/Kolkata", cfg.Loc.String())
+		assert.Equal(t, "'STRICT_ALL_TABLES'", cfg.Params["sql_mode"])
+
+		config.TLSConfig = &tls.Config{ServerName: "db.local"}
+		cfg, err = config.DriverConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, "db.local", cfg.TLS.ServerName)
+	})
+
+	t.Run("Bad TLS or location is an error", func(t *testing.T) {
+		config := MySQLConfig{TLS: "not-registered"}
+		config.SetupDefaults()
+		_, err := config.DriverConfig()
+		assert.Error(t, err)
+
+		config = MySQLConfig{Location: "Not/A_Zone"}
+		config.SetupDefaults()
+		_, err = config.DriverConfig()
+		assert.Error(t, err)
+	})
+}
+
+func TestOpen_PingFails(t *testing.T) {
+	start := time.Now()
+	db, err := Open(nil, MySQLConfig{
+		ServerName:           "test",
+		Host:                 "127.0.0.1",
+		Port:                 1,
+		ConnectTimeoutMs:     100,
+		StartupPingAttempts:  2,
+		StartupPingBackoffMs: 10,
+	})
+	assert.Error(t, err)
+	assert.Nil(t, db)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestReportPoolStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scope := mockGox.NewMockScope(ctrl)
+	gauge := mockGox.NewMockGauge(ctrl)
+	scope.EXPECT().Tagged(map[string]string{QueryTagDbServer: "primary"}).Return(scope)
+	scope.EXPECT().Gauge(gomock.Any()).Return(gauge).Times(8)
+	gauge.EXPECT().Update(float64(4))
+	gauge.EXPECT().Update(float64(3))
+	gauge.EXPECT().Update(float64(2))
+	gauge.EXPECT().Update(float64(1))
+	gauge.EXPECT().Update(float64(0)).Times(4)
+
+	ReportPoolStats(scope, "primary", sql.DBStats{MaxOpenConnections: 4, OpenConnections: 3, InUse: 2, Idle: 1})
+}
+
+func TestOpen_ClosingDbStopsReporter(t *testing.T) {
+	stopped := make(chan struct{})
+	db := sql.OpenDB(&closeNotifyingConnector{Connector: &fakeConnector{}, onClose: func() { close(stopped) }})
+	assert.NoError(t, db.Close())
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("close of db did not notify the connector")
+	}
+}
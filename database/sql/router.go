@@ -0,0 +1,275 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	mysqlerrnum "github.com/bombsimon/mysql-error-numbers"
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/go-sql-driver/mysql"
+	pkgErrors "github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Replica selection used by Router
+const (
+	ReplicaSelectionRoundRobin   = "round_robin"
+	ReplicaSelectionLeastLatency = "least_latency"
+)
+
+const forcePrimaryKey = "__SQLCX_FORCE_PRIMARY__"
+
+// latencyDecay is the weight of the latest call in the moving average latency of a replica
+const latencyDecay = 0.2
+
+// WithForcePrimary gives a ctx whose reads go to the primary - use it to read your own writes
+func WithForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryKey, true)
+}
+
+// IsForcePrimary returns true if reads with this ctx must go to the primary
+func IsForcePrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, ok := ctx.Value(forcePrimaryKey).(bool)
+	return ok && v
+}
+
+// Replica is a read replica used by Router
+type Replica struct {
+	Name string
+	DB   *sql.DB
+}
+
+// Router sends writes to the primary and reads to a healthy replica. A read goes to the primary if ctx has a goxSql txn
+// (it is run in that txn), if ctx is marked with WithForcePrimary, or if no replica is healthy. A replica is ejected for
+// some time if it fails many calls in a row (see ReplicaRoutingConfig)
+type Router struct {
+	primary  *sql.DB
+	replicas []*replicaState
+	config   ReplicaRoutingConfig
+	logger   *zap.Logger
+	next     uint32
+}
+
+type replicaState struct {
+	Replica
+	mu           sync.Mutex
+	errors       int
+	ejectedUntil time.Time
+	latency      float64
+}
+
+// NewRouter gives a router over the primary and replicas - routing config comes from MySQLConfig.ReplicaRouting
+func NewRouter(cf gox.CrossFunction, primary *sql.DB, replicas []Replica, config ReplicaRoutingConfig) (*Router, error) {
+	if primary == nil {
+		return nil, errors.New("primary db is required to build router")
+	}
+	config.SetupDefaults()
+	if config.Selection != ReplicaSelectionRoundRobin && config.Selection != ReplicaSelectionLeastLatency {
+		return nil, errors.New("unknown replica selection: %s", config.Selection)
+	}
+	if cf == nil {
+		cf = gox.NewNoOpCrossFunction()
+	}
+
+	r := &Router{primary: primary, config: config, logger: cf.Logger()}
+	for _, replica := range replicas {
+		if replica.DB == nil {
+			return nil, errors.New("replica db is missing: name=%s", replica.Name)
+		}
+		r.replicas = append(r.replicas, &replicaState{Replica: replica})
+	}
+	return r, nil
+}
+
+// Primary gives the primary db
+func (r *Router) Primary() *sql.DB {
+	return r.primary
+}
+
+// TxnBeginner gives a TxnBeginner for the primary - use it with Begin or RunInTx
+func (r *Router) TxnBeginner() TxnBeginner {
+	return NewTxnBeginner(r.primary)
+}
+
+// ExecContext runs the statement on the primary (in the goxSql txn of ctx if there is one)
+func (r *Router) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx.ExecContext(ctx, query, args...)
+	}
+	return r.primary.ExecContext(ctx, query, args...)
+}
+
+// BeginTx begins a txn on the primary
+func (r *Router) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return r.primary.BeginTx(ctx, opts)
+}
+
+// QueryContext runs the query on a replica (see Router for when it goes to the primary)
+func (r *Router) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx.QueryContext(ctx, query, args...)
+	}
+	replica := r.pickReplica(ctx)
+	if replica == nil {
+		return r.primary.QueryContext(ctx, query, args...)
+	}
+	start := time.Now()
+	rows, err := replica.DB.QueryContext(ctx, query, args...)
+	r.done(replica, start, err)
+	return rows, err
+}
+
+// QueryRowContext runs the query on a replica (see Router for when it goes to the primary)
+func (r *Router) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx.QueryRowContext(ctx, query, args...)
+	}
+	replica := r.pickReplica(ctx)
+	if replica == nil {
+		return r.primary.QueryRowContext(ctx, query, args...)
+	}
+	start := time.Now()
+	row := replica.DB.QueryRowContext(ctx, query, args...)
+	r.done(replica, start, row.Err())
+	return row
+}
+
+// ReadDB gives the db to read from - a replica, or the primary (see Router). Calls made directly on it are not used
+// to track health of the replica
+func (r *Router) ReadDB(ctx context.Context) *sql.DB {
+	if !IsTxnInContext(ctx) {
+		if replica := r.pickReplica(ctx); replica != nil {
+			return replica.DB
+		}
+	}
+	return r.primary
+}
+
+// Close closes the primary and all replicas
+func (r *Router) Close() error {
+	err := r.primary.Close()
+	for _, replica := range r.replicas {
+		if e := replica.DB.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// HealthyReplicas gives the names of replicas which are not ejected
+func (r *Router) HealthyReplicas() []string {
+	now := time.Now()
+	var names []string
+	for _, replica := range r.replicas {
+		if replica.isHealthy(now) {
+			names = append(names, replica.Name)
+		}
+	}
+	return names
+}
+
+// pickReplica gives nil if the read must go to the primary
+func (r *Router) pickReplica(ctx context.Context) *replicaState {
+	if len(r.replicas) == 0 || IsForcePrimary(ctx) {
+		return nil
+	}
+
+	now := time.Now()
+	if r.config.Selection == ReplicaSelectionLeastLatency {
+		var best *replicaState
+		bestLatency := 0.0
+		for _, replica := range r.replicas {
+			if !replica.isHealthy(now) {
+				continue
+			}
+			if latency := replica.avgLatency(); best == nil || latency < bestLatency {
+				best, bestLatency = replica, latency
+			}
+		}
+		return best
+	}
+
+	start := atomic.AddUint32(&r.next, 1)
+	for i := 0; i < len(r.replicas); i++ {
+		replica := r.replicas[(int(start)+i)%len(r.replicas)]
+		if replica.isHealthy(now) {
+			return replica
+		}
+	}
+	return nil
+}
+
+// done tracks latency and errors of a call made on the replica
+func (r *Router) done(replica *replicaState, start time.Time, err error) {
+	replica.mu.Lock()
+	defer replica.mu.Unlock()
+
+	if !isDbHealthError(err) {
+		replica.errors = 0
+		latency := float64(time.Since(start))
+		if replica.latency == 0 {
+			replica.latency = latency
+		} else {
+			replica.latency = latencyDecay*latency + (1-latencyDecay)*replica.latency
+		}
+		return
+	}
+
+	if replica.errors++; replica.errors >= r.config.EjectAfterErrors {
+		replica.errors = 0
+		replica.ejectedUntil = time.Now().Add(time.Duration(r.config.EjectForSec) * time.Second)
+		r.logger.Warn("replica ejected", zap.String("replica", replica.Name), zap.Time("until", replica.ejectedUntil), zap.Error(err))
+	}
+}
+
+func (s *replicaState) isHealthy(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !now.Before(s.ejectedUntil)
+}
+
+func (s *replicaState) avgLatency() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latency
+}
+
+// isDbHealthError returns true if err shows that the db (or replica) is not healthy (connection errors, timeouts, server
+// overloaded or shutting down) - errors of the query itself (e.g. no rows, bad sql, duplicate key) and any other error
+// which is not listed here do not count
+func isDbHealthError(err error) bool {
+	if err == nil || pkgErrors.Is(err, sql.ErrNoRows) || pkgErrors.Is(err, context.Canceled) {
+		return false
+	}
+
+	// Connection lost or broken, or the call timed out
+	if pkgErrors.Is(err, driver.ErrBadConn) || pkgErrors.Is(err, mysql.ErrInvalidConn) || pkgErrors.Is(err, mysql.ErrPktSync) ||
+		pkgErrors.Is(err, mysql.ErrPktSyncMul) || pkgErrors.Is(err, context.DeadlineExceeded) || pkgErrors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// Network errors e.g. connection refused or reset, dial or read timeout
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlerrnum.ER_CON_COUNT_ERROR, mysqlerrnum.ER_TOO_MANY_USER_CONNECTIONS, mysqlerrnum.ER_SERVER_SHUTDOWN,
+			mysqlerrnum.ER_OUT_OF_RESOURCES, mysqlerrnum.ER_NET_READ_ERROR:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+)
+
+func newRouterForTest(t *testing.T, selection string) (*Router, *fakeConnector, []*fakeConnector) {
+	primary := &fakeConnector{}
+	replicas := []*fakeConnector{{}, {}}
+	router, err := NewRouter(nil, sql.OpenDB(primary), []Replica{
+		{Name: "r1", DB: sql.OpenDB(replicas[0])},
+		{Name: "r2", DB: sql.OpenDB(replicas[1])},
+	}, ReplicaRoutingConfig{Selection: selection, EjectAfterErrors: 2, EjectForSec: 60})
+	assert.NoError(t, err)
+	return router, primary, replicas
+}
+
+func query(t *testing.T, ctx context.Context, router *Router) error {
+	rows, err := router.QueryContext(ctx, "SELECT id FROM jobs")
+	if err == nil {
+		assert.NoError(t, rows.Close())
+	}
+	return err
+}
+
+func TestRouter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Reads are spread over replicas round robin and writes go to primary", func(t *testing.T) {
+		router, primary, replicas := newRouterForTest(t, "")
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, query(t, ctx, router))
+		}
+		assert.Equal(t, int32(0), atomic.LoadInt32(&primary.queries))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&replicas[0].queries))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&replicas[1].queries))
+
+		assert.NoError(t, query(t, WithForcePrimary(ctx), router))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&primary.queries))
+		assert.Equal(t, router.Primary(), router.ReadDB(WithForcePrimary(ctx)))
+	})
+
+	t.Run("Replica is ejected after errors", func(t *testing.T) {
+		router, primary, replicas := newRouterForTest(t, ReplicaSelectionLeastLatency)
+		replicas[0].queryErr = errConnectionRefused
+		replicas[1].queryErr = &mysql.MySQLError{Number: 1064, Message: "bad sql"}
+
+		// A bad query is not a health problem of the replica
+		for i := 0; i < 4; i++ {
+			_ = query(t, ctx, router)
+		}
+		assert.Equal(t, []string{"r2"}, router.HealthyReplicas())
+
+		// All replicas are down - reads go to primary
+		replicas[1].queryErr = &mysql.MySQLError{Number: 1040, Message: "too many connections"}
+		_ = query(t, ctx, router)
+		_ = query(t, ctx, router)
+		assert.Empty(t, router.HealthyReplicas())
+		assert.NoError(t, query(t, ctx, router))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&primary.queries))
+	})
+
+	t.Run("Reads inside a goxSql txn run in the txn", func(t *testing.T) {
+		router, primary, replicas := newRouterForTest(t, "")
+		txMock := NewMockTx(gomock.NewController(t))
+		txMock.EXPECT().QueryContext(gomock.Any(), "SELECT id FROM jobs").Return(nil, errors.New("from txn"))
+		txCtx, _, err := Begin(ctx, TxBeginOptions{TxnBeginner: &tb{tx: txMock}})
+		assert.NoError(t, err)
+
+		assert.EqualError(t, query(t, txCtx, router), "from txn")
+		assert.Equal(t, int32(0), atomic.LoadInt32(&primary.queries)+atomic.LoadInt32(&replicas[0].queries)+atomic.LoadInt32(&replicas[1].queries))
+	})
+
+	t.Run("Writes inside a goxSql txn run in the txn with ctx", func(t *testing.T) {
+		router, _, _ := newRouterForTest(t, "")
+		txMock := NewMockTx(gomock.NewController(t))
+		txCtx, _, err := Begin(ctx, TxBeginOptions{TxnBeginner: &tb{tx: txMock}})
+		assert.NoError(t, err)
+		txMock.EXPECT().Exec("UPDATE jobs SET state=?", 1).Return(driver.RowsAffected(1), nil)
+
+		// Tx which is not a TxWithExecContext falls back to Exec
+		_, err = router.ExecContext(txCtx, "UPDATE jobs SET state=?", 1)
+		assert.NoError(t, err)
+
+		withCtx := &execContextTx{MockTx: NewMockTx(gomock.NewController(t))}
+		txCtx, _, err = Begin(ctx, TxBeginOptions{TxnBeginner: &tb{tx: withCtx}})
+		assert.NoError(t, err)
+		_, err = router.ExecContext(txCtx, "UPDATE jobs SET state=?", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, txCtx, withCtx.ctx)
+	})
+
+	_, err := NewRouter(nil, nil, nil, ReplicaRoutingConfig{})
+	assert.Error(t, err)
+	_, err = NewRouter(nil, sql.OpenDB(&fakeConnector{}), nil, ReplicaRoutingConfig{Selection: "random"})
+	assert.Error(t, err)
+}
+
+// execContextTx is a TxWithExecContext which keeps the ctx it was called with
+type execContextTx struct {
+	*MockTx
+	ctx context.Context
+}
+
+func (e *execContextTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e.ctx = ctx
+	return driver.RowsAffected(1), nil
+}
+
+func TestIsDbHealthError(t *testing.T) {
+	for err, expected := range map[error]bool{
+		nil:                  false,
+		sql.ErrNoRows:        false,
+		context.Canceled:     false,
+		errors.New("random"): false,
+		&mysql.MySQLError{Number: 1062, Message: "duplicate entry"}:   false,
+		&mysql.MySQLError{Number: 1205, Message: "lock wait timeout"}: false,
+		driver.ErrBadConn:        true,
+		mysql.ErrInvalidConn:     true,
+		context.DeadlineExceeded: true,
+		errConnectionRefused:     true,
+		errors.Wrap(errConnectionRefused, "failed to read job"):          true,
+		&mysql.MySQLError{Number: 1040, Message: "too many connections"}: true,
+		&mysql.MySQLError{Number: 1053, Message: "server shutdown"}:      true,
+	} {
+		assert.Equal(t, expected, isDbHealthError(err), "%v", err)
+	}
+}
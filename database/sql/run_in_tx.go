@@ -0,0 +1,143 @@
+package goxSql
+
+import (
+	"context"
+	"fmt"
+	mysqlerrnum "github.com/bombsimon/mysql-error-numbers"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/go-sql-driver/mysql"
+	"math/rand"
+	"runtime/debug"
+	"time"
+)
+
+// RunInTxOptions are the options for RunInTx
+type RunInTxOptions struct {
+	TxBeginOptions
+
+	// MaxAttempts is the max no of times the txn is tried if it fails with a deadlock or lock wait timeout (default = 3)
+	MaxAttempts int
+
+	// RetryBackoff is the wait before the first retry, it is doubled (with jitter) on every retry up to MaxRetryBackoff
+	// (default = 50ms and 1s)
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	// Callbacks if set, PostCallbackFunc is called once at the end with the no of attempts
+	Callbacks *Callbacks
+}
+
+func (o *RunInTxOptions) setupDefaults() {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 3
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 50 * time.Millisecond
+	}
+	if o.MaxRetryBackoff <= 0 {
+		o.MaxRetryBackoff = time.Second
+	}
+}
+
+// ErrTxnPanicked is returned by RunInTx if the function panicked - the txn is rolled back
+type ErrTxnPanicked struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *ErrTxnPanicked) Error() string {
+	return fmt.Sprintf("txn rolled back - function panicked: %v", e.Value)
+}
+
+// RunInTx runs the function in a txn - txn is committed if the function returns nil, and rolled back if it returns an
+// error or panics. The ctx given to the function carries the txn, so a goxSql.Begin (or RunInTx) with
+// ContinueExistingTxnIfExists inside it joins this txn. The tx given to the function is a TxWithHooks - OnRollback hooks
+// get the error returned by the function (or ErrTxnPanicked) as the cause.
+//
+// If ContinueExistingTxnIfExists is set and ctx has a txn, the function runs as a child of that txn and is not retried
+// (parent txn is lost on a deadlock). Otherwise, if the function or the commit fails with a MySQL deadlock (1213) or lock
+// wait timeout (1205), the whole txn is tried again with backoff - so the function must be safe to run again
+func RunInTx(ctx context.Context, options RunInTxOptions, f func(ctx context.Context, tx Tx) error) (err error) {
+	options.setupDefaults()
+	startTime := time.Now()
+	attempts := 0
+	defer func() {
+		if options.Callbacks != nil && options.Callbacks.PostCallbackFunc != nil {
+			endTime := time.Now()
+			options.Callbacks.PostCallbackFunc(PostCallbackData{
+				Ctx:       ctx,
+				Name:      options.Name,
+				StartTime: startTime.UnixMilli(),
+				EndTime:   endTime.UnixMilli(),
+				TimeTaken: endTime.Sub(startTime).Milliseconds(),
+				Err:       err,
+				Attempts:  attempts,
+			})
+		}
+	}()
+
+	joined := options.ContinueExistingTxnIfExists && IsTxnInContext(ctx)
+	backoff := options.RetryBackoff
+	for {
+		attempts++
+		if err = runOnceInTx(ctx, options.TxBeginOptions, f); err == nil {
+			return nil
+		} else if joined || attempts >= options.MaxAttempts || !IsRetryableTxnError(err) {
+			return err
+		}
+
+		// Wait with jitter (50% - 100% of backoff) before trying again
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(err, "txn failed and ctx is done before it could be retried: attempts=%d", attempts)
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > options.MaxRetryBackoff {
+			backoff = options.MaxRetryBackoff
+		}
+	}
+}
+
+func runOnceInTx(ctx context.Context, options TxBeginOptions, f func(ctx context.Context, tx Tx) error) (err error) {
+	var tx Tx
+	if ctx, tx, err = Begin(ctx, options); err != nil {
+		return errors.Wrap(err, "failed to begin txn: name=%s", options.Name)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = &ErrTxnPanicked{Value: p, Stack: debug.Stack()}
+			rollbackWithCause(tx, err)
+		}
+	}()
+
+	if err = f(ctx, tx); err != nil {
+		rollbackWithCause(tx, err)
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		// Rollback after a failed commit - it is a no-op if txn is already done
+		_ = tx.Rollback()
+	}
+	return err
+}
+
+// rollbackWithCause rolls back the txn - the cause is given to OnRollback hooks
+func rollbackWithCause(tx Tx, cause error) {
+	if t, ok := tx.(*txImpl); ok {
+		_ = t.rollbackWithCause(cause)
+	} else {
+		_ = tx.Rollback()
+	}
+}
+
+// IsRetryableTxnError returns true if err is a MySQL deadlock (1213) or lock wait timeout (1205) - the txn is rolled
+// back by MySQL (or can be rolled back) and can be tried again
+func IsRetryableTxnError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlerrnum.ER_LOCK_DEADLOCK || mysqlErr.Number == mysqlerrnum.ER_LOCK_WAIT_TIMEOUT
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRunInTx(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	t.Run("Commit if function returns no error", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Commit().Return(nil).Times(1)
+
+		var data PostCallbackData
+		err := RunInTx(context.Background(), RunInTxOptions{
+			TxBeginOptions: TxBeginOptions{TxnBeginner: &tb{tx: txMock}, Name: "test"},
+			Callbacks:      &Callbacks{PostCallbackFunc: func(d PostCallbackData) { data = d }},
+		}, func(ctx context.Context, tx Tx) error {
+			assert.True(t, IsTxnInContext(ctx))
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "test", data.Name)
+		assert.Equal(t, 1, data.Attempts)
+	})
+
+	t.Run("Rollback if function returns error", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Commit().Times(0)
+		txMock.EXPECT().Rollback().Return(nil).Times(1)
+
+		calls := 0
+		err := RunInTx(context.Background(), RunInTxOptions{TxBeginOptions: TxBeginOptions{TxnBeginner: &tb{tx: txMock}}}, func(ctx context.Context, tx Tx) error {
+			calls++
+			return errors.New("bad error")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls, "error which is not a deadlock or lock wait timeout must not be retried")
+	})
+
+	t.Run("Rollback if function panics", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Rollback().Return(nil).Times(1)
+
+		err := RunInTx(context.Background(), RunInTxOptions{TxBeginOptions: TxBeginOptions{TxnBeginner: &tb{tx: txMock}}}, func(ctx context.Context, tx Tx) error {
+			panic("something bad")
+		})
+		var e *ErrTxnPanicked
+		assert.True(t, errors.As(err, &e))
+		assert.Equal(t, "something bad", e.Value)
+	})
+
+	t.Run("Retry on deadlock and lock wait timeout", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Rollback().Return(nil).Times(2)
+		txMock.EXPECT().Commit().Return(nil).Times(1)
+
+		var data PostCallbackData
+		retryableErrors := []error{&mysql.MySQLError{Number: 1213}, errors.Wrap(&mysql.MySQLError{Number: 1205}, "wrapped")}
+		err := RunInTx(context.Background(), RunInTxOptions{
+			TxBeginOptions: TxBeginOptions{TxnBeginner: &tb{tx: txMock}},
+			RetryBackoff:   1,
+			Callbacks:      &Callbacks{PostCallbackFunc: func(d PostCallbackData) { data = d }},
+		}, func(ctx context.Context, tx Tx) error {
+			if len(retryableErrors) > 0 {
+				e := retryableErrors[0]
+				retryableErrors = retryableErrors[1:]
+				return e
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, data.Attempts)
+		assert.NoError(t, data.Err)
+	})
+
+	t.Run("Give up after max attempts", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Rollback().Return(nil).Times(2)
+
+		calls := 0
+		err := RunInTx(context.Background(), RunInTxOptions{
+			TxBeginOptions: TxBeginOptions{TxnBeginner: &tb{tx: txMock}},
+			MaxAttempts:    2,
+			RetryBackoff:   1,
+		}, func(ctx context.Context, tx Tx) error {
+			calls++
+			return &mysql.MySQLError{Number: 1213}
+		})
+		assert.True(t, IsRetryableTxnError(err))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Child joins txn from context and is not retried", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Commit().Times(0)
+		txMock.EXPECT().Rollback().Return(nil).Times(1)
+
+		// Parent is tried once - so we can see that child did not retry on its own
+		err := RunInTx(context.Background(), RunInTxOptions{TxBeginOptions: TxBeginOptions{TxnBeginner: &tb{tx: txMock}, Name: "parent"}, MaxAttempts: 1}, func(ctx context.Context, tx Tx) error {
+			calls := 0
+			err := RunInTx(ctx, RunInTxOptions{TxBeginOptions: TxBeginOptions{Name: "child", ContinueExistingTxnIfExists: true}}, func(ctx context.Context, tx Tx) error {
+				calls++
+				return &mysql.MySQLError{Number: 1213}
+			})
+			assert.Equal(t, 1, calls)
+			return err
+		})
+		assert.True(t, IsRetryableTxnError(err))
+	})
+
+	t.Run("Isolation level needs TxnBeginnerWithOptions", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		err := RunInTx(context.Background(), RunInTxOptions{
+			TxBeginOptions: TxBeginOptions{TxnBeginner: &tb{tx: txMock}, Isolation: sql.LevelSerializable},
+		}, func(ctx context.Context, tx Tx) error {
+			return nil
+		})
+		assert.Error(t, err)
+
+		txMock.EXPECT().Commit().Return(nil).Times(1)
+		beginner := &tbWithOptions{tb: tb{tx: txMock}}
+		err = RunInTx(context.Background(), RunInTxOptions{
+			TxBeginOptions: TxBeginOptions{TxnBeginner: beginner, Isolation: sql.LevelSerializable, ReadOnly: true},
+		}, func(ctx context.Context, tx Tx) error {
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}, beginner.opts)
+	})
+}
+
+type tbWithOptions struct {
+	tb
+	opts *sql.TxOptions
+}
+
+func (t *tbWithOptions) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	t.opts = opts
+	return t.tx, t.err
+}
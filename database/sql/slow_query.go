@@ -0,0 +1,224 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// SlowQueryData is given to SlowQueryCallbackFunc for a query which was slower than its threshold
+type SlowQueryData struct {
+	Ctx         context.Context `json:"-"`
+	Name        string          `json:"name"`
+	DbServer    string          `json:"db_server"`
+	Query       string          `json:"query"`
+	Fingerprint string          `json:"fingerprint"`
+
+	// Args are redacted unless MySQLConfig.LogSlowQueryArgValues is set
+	Args      []interface{} `json:"args"`
+	TimeTaken int64         `json:"time_taken"`
+	Threshold int64         `json:"threshold"`
+	Err       error         `json:"error"`
+
+	// Explain is the result of EXPLAIN of the query (one map per row) - it is set only for sampled slow queries
+	Explain      []map[string]string `json:"explain,omitempty"`
+	ExplainError error               `json:"explain_error,omitempty"`
+}
+
+type SlowQueryCallbackFunc func(data SlowQueryData)
+
+// explainFunc runs EXPLAIN of the query - it is set by instrumented DB
+type explainFunc func(ctx context.Context, query string, args []interface{}) ([]map[string]string, error)
+
+// SlowQueryThreshold gives the slow query threshold of the call name (0 = no threshold)
+func (m *MySQLConfig) SlowQueryThreshold(name string) time.Duration {
+	if ms, ok := m.SlowQueryThresholdMsByCallName[name]; ok {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return time.Duration(m.SlowQueryThresholdMs) * time.Millisecond
+}
+
+// checkSlowQuery logs the query (and calls the slow query callback) if it took more time than its threshold. EXPLAIN
+// of a sampled slow query is captured in background, the log and callback are done once it is captured
+func (l LogInfo) checkSlowQuery(timeTaken time.Duration, err error, args []interface{}) {
+	if l.config == nil {
+		return
+	}
+	threshold := l.config.SlowQueryThreshold(l.name)
+	if threshold <= 0 || timeTaken < threshold {
+		return
+	}
+
+	data := SlowQueryData{
+		Ctx:         l.ctx,
+		Name:        l.name,
+		DbServer:    l.config.ServerName,
+		Query:       l.cleanQuery,
+		Fingerprint: FingerprintQuery(l.query),
+		Args:        redactArgs(args, l.config.LogSlowQueryArgValues, l.config.SlowQueryMaxArgLength),
+		TimeTaken:   timeTaken.Milliseconds(),
+		Threshold:   threshold.Milliseconds(),
+		Err:         err,
+	}
+
+	if l.explain != nil && isExplainable(l.query) && l.config.SlowQueryExplainSampleRate > 0 && rand.Float64() < l.config.SlowQueryExplainSampleRate {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			data.Explain, data.ExplainError = l.explain(ctx, l.query, args)
+			l.reportSlowQuery(data)
+		}()
+	} else {
+		l.reportSlowQuery(data)
+	}
+}
+
+func (l LogInfo) reportSlowQuery(data SlowQueryData) {
+	if l.logger != nil {
+		fields := []zap.Field{
+			zap.String("name", data.Name),
+			zap.String("db_server", data.DbServer),
+			zap.Int64("time", data.TimeTaken),
+			zap.Int64("threshold", data.Threshold),
+			zap.String("query", data.Query),
+			zap.Any("args", data.Args),
+		}
+		if data.Err != nil {
+			fields = append(fields, zap.Error(data.Err))
+		}
+		if data.Explain != nil {
+			fields = append(fields, zap.Any("explain", data.Explain))
+		} else if data.ExplainError != nil {
+			fields = append(fields, zap.NamedError("explain_error", data.ExplainError))
+		}
+		l.logger.Warn("slow query", fields...)
+	}
+	if l.callbacks != nil && l.callbacks.SlowQueryCallbackFunc != nil {
+		l.callbacks.SlowQueryCallbackFunc(data)
+	}
+}
+
+// redactArgs gives the args to log - only type of each arg if values are not to be logged, else values with long
+// strings truncated
+func redactArgs(args []interface{}, logValues bool, maxLength int) []interface{} {
+	if maxLength <= 0 {
+		maxLength = 64
+	}
+	result := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			result[i] = nil
+		case []byte:
+			result[i] = fmt.Sprintf("<[]byte len=%d>", len(v))
+		case string:
+			if !logValues {
+				result[i] = fmt.Sprintf("<string len=%d>", len(v))
+			} else if len(v) > maxLength {
+				result[i] = v[:maxLength] + "..."
+			} else {
+				result[i] = v
+			}
+		default:
+			if logValues {
+				result[i] = v
+			} else {
+				result[i] = fmt.Sprintf("<%T>", v)
+			}
+		}
+	}
+	return result
+}
+
+// isExplainable returns true for queries which MySQL can EXPLAIN
+func isExplainable(query string) bool {
+	fields := strings.Fields(FingerprintQuery(query))
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "select", "insert", "update", "delete", "replace", "with":
+		return true
+	}
+	return false
+}
+
+// explain runs EXPLAIN on a connection borrowed from the pool - the connection of the slow query may still be reading
+// rows. It runs on the driver connection (EXPLAIN is not logged, timed or counted by circuit breaker)
+func (i *instrumentation) explain(ctx context.Context, query string, args []interface{}) (result []map[string]string, err error) {
+	if i.db == nil {
+		return nil, fmt.Errorf("explain needs a db opened with goxSql.Open or OpenInstrumentedDB")
+	}
+	conn, err := i.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*instrumentedConn)
+		if !ok {
+			return fmt.Errorf("db connection is not instrumented: %T", driverConn)
+		}
+		result, err = explainWithConn(ctx, c.conn, query, args)
+		return err
+	})
+	return
+}
+
+// explainWithConn runs EXPLAIN as a prepared statement - the driver may not run a query with args without it (e.g.
+// MySQL driver gives driver.ErrSkip if InterpolateParams is off)
+func explainWithConn(ctx context.Context, conn driver.Conn, query string, args []interface{}) (result []map[string]string, err error) {
+	var stmt driver.Stmt
+	if p, ok := conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, "EXPLAIN "+query)
+	} else {
+		stmt, err = conn.Prepare("EXPLAIN " + query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	namedArgs := make([]driver.NamedValue, len(args))
+	for idx, arg := range args {
+		namedArgs[idx] = driver.NamedValue{Ordinal: idx + 1, Value: arg}
+	}
+	var rows driver.Rows
+	if q, ok := stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, namedArgs)
+	} else {
+		rows, err = stmt.Query(namedValuesToValues(namedArgs))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := rows.Columns()
+	values := make([]driver.Value, len(columns))
+	for {
+		if err = rows.Next(values); err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return result, err
+		}
+		row := map[string]string{}
+		for idx, c := range columns {
+			switch v := values[idx].(type) {
+			case nil:
+				row[c] = ""
+			case []byte:
+				row[c] = string(v)
+			default:
+				row[c] = fmt.Sprint(v)
+			}
+		}
+		result = append(result, row)
+	}
+}
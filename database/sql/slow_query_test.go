@@ -0,0 +1,87 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/devlibx/gox-base"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSlowQueryThreshold(t *testing.T) {
+	config := &MySQLConfig{SlowQueryThresholdMs: 100, SlowQueryThresholdMsByCallName: map[string]int{"report": 5000, "off": 0}}
+	assert.Equal(t, 100*time.Millisecond, config.SlowQueryThreshold("find_jobs"))
+	assert.Equal(t, 5*time.Second, config.SlowQueryThreshold("report"))
+	assert.Equal(t, time.Duration(0), config.SlowQueryThreshold("off"))
+}
+
+func TestRedactArgs(t *testing.T) {
+	args := []interface{}{"secret", 10, nil, []byte("abc")}
+	assert.Equal(t, []interface{}{"<string len=6>", "<int>", nil, "<[]byte len=3>"}, redactArgs(args, false, 0))
+	assert.Equal(t, []interface{}{"sec...", 10, nil, "<[]byte len=3>"}, redactArgs(args, true, 3))
+}
+
+func TestSlowQueryCallbackWithExplain(t *testing.T) {
+	slowQueries := make(chan SlowQueryData, 10)
+	callbacks := &Callbacks{SlowQueryCallbackFunc: func(data SlowQueryData) { slowQueries <- data }}
+	config := &MySQLConfig{
+		ServerName:                     "primary",
+		SlowQueryThresholdMs:           10,
+		SlowQueryThresholdMsByCallName: map[string]int{"batch": 1000},
+		SlowQueryExplainSampleRate:     1,
+	}
+	connector := &fakeConnector{}
+	db := OpenInstrumentedDB(NewInstrumentedConnector(connector, gox.NewNoOpCrossFunction(), config, callbacks))
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	ctx := context.Background()
+
+	// Fast query and a slow query with higher threshold for its call name are not reported
+	_, err := db.ExecContext(ctx, "UPDATE fast SET a=?", "x")
+	assert.NoError(t, err)
+	_, err = db.ExecContext(WithDbCallName(ctx, "batch"), "UPDATE slow SET a=?", "x")
+	assert.NoError(t, err)
+
+	_, err = db.ExecContext(WithDbCallName(ctx, "update_slow"), "UPDATE slow SET a=? WHERE id=1", "secret")
+	assert.NoError(t, err)
+
+	select {
+	case data := <-slowQueries:
+		assert.Equal(t, "update_slow", data.Name)
+		assert.Equal(t, "primary", data.DbServer)
+		assert.Equal(t, "update slow set a=? where id=?", data.Fingerprint)
+		assert.Equal(t, []interface{}{"<string len=6>"}, data.Args)
+		assert.Equal(t, int64(10), data.Threshold)
+		assert.GreaterOrEqual(t, data.TimeTaken, int64(10))
+		assert.NoError(t, data.ExplainError)
+		assert.Equal(t, []map[string]string{{"table": "slow", "type": "ALL"}}, data.Explain)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "slow query was not reported")
+	}
+	assert.Len(t, slowQueries, 0)
+
+	// EXPLAIN is prepared, and it runs on the connection of the pool
+	_, prepared := connector.executed.Load("EXPLAIN UPDATE slow SET a=? WHERE id=1")
+	assert.True(t, prepared)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connector.connects))
+}
+
+func TestSlowQueryExplainNeedsInstrumentedDb(t *testing.T) {
+	slowQueries := make(chan SlowQueryData, 1)
+	callbacks := &Callbacks{SlowQueryCallbackFunc: func(data SlowQueryData) { slowQueries <- data }}
+	config := &MySQLConfig{SlowQueryThresholdMs: 10, SlowQueryExplainSampleRate: 1}
+	db := sql.OpenDB(NewInstrumentedConnector(&fakeConnector{}, gox.NewNoOpCrossFunction(), config, callbacks))
+	defer db.Close()
+
+	_, err := db.ExecContext(context.Background(), "UPDATE slow SET a=?", "x")
+	assert.NoError(t, err)
+	select {
+	case data := <-slowQueries:
+		assert.Error(t, data.ExplainError)
+		assert.Nil(t, data.Explain)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "slow query was not reported")
+	}
+}
@@ -0,0 +1,331 @@
+package goxSql
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxCachedRewrites is the max no of queries whose rewritten query is cached by a TableNameRewriter
+const maxCachedRewrites = 10000
+
+// TableNameRewriter renames tables in SQL queries. A table is renamed by the mapping if it has one, else the prefix and
+// postfix are added to it (a rewriter with only a mapping keeps other tables as is).
+//
+// The query is tokenized, so only table names are renamed - a table name in a string literal, comment or column name
+// (e.g. jobs_count for table jobs) is kept as is. A name is a table if it comes after FROM, JOIN, INTO, UPDATE or TABLE
+// (or in the table list of FROM/UPDATE), or if it qualifies a column (jobs.id) and is a table of the query
+type TableNameRewriter struct {
+	prefix  string
+	postfix string
+	mapping map[string]string
+
+	cache      sync.Map
+	cacheCount int64
+}
+
+// NewTableNameRewriter gives a rewriter which adds prefix and postfix to tables, or renames them as per mapping
+func NewTableNameRewriter(prefix string, postfix string, mapping map[string]string) *TableNameRewriter {
+	m := map[string]string{}
+	for k, v := range mapping {
+		m[k] = v
+	}
+	return &TableNameRewriter{prefix: prefix, postfix: postfix, mapping: m}
+}
+
+// NewTableNameRewriterFromConfig gives rewriter for TablePrefix, TablePostfix and TableNameMapping of config - it is nil
+// if config does not rename any table
+func NewTableNameRewriterFromConfig(config *MySQLConfig) *TableNameRewriter {
+	if config == nil || (config.TablePrefix == "" && config.TablePostfix == "" && len(config.TableNameMapping) == 0) {
+		return nil
+	}
+	return NewTableNameRewriter(config.TablePrefix, config.TablePostfix, config.TableNameMapping)
+}
+
+// TableName gives the new name of the table
+func (r *TableNameRewriter) TableName(table string) string {
+	if name, ok := r.mapping[table]; ok {
+		return name
+	}
+	return r.prefix + table + r.postfix
+}
+
+// RewriteQuery gives the query with tables renamed
+func (r *TableNameRewriter) RewriteQuery(query string) string {
+	if r == nil {
+		return query
+	}
+	if v, ok := r.cache.Load(query); ok {
+		return v.(string)
+	}
+	result := r.rewriteQuery(query)
+	if atomic.AddInt64(&r.cacheCount, 1) <= maxCachedRewrites {
+		r.cache.Store(query, result)
+	}
+	return result
+}
+
+func (r *TableNameRewriter) rewriteQuery(query string) string {
+	tokens := tokenizeSql(query)
+	ctes := findCommonTableExpressions(tokens)
+	var tables []int
+	for _, i := range findTables(tokens) {
+		if !ctes[tokens[i].name()] {
+			tables = append(tables, i)
+		}
+	}
+	if len(tables) == 0 {
+		return query
+	}
+
+	// Table names used as qualifier of a column are renamed too (e.g. jobs.id)
+	names := map[string]bool{}
+	for _, i := range tables {
+		names[tokens[i].name()] = true
+	}
+	isTable := map[int]bool{}
+	for _, i := range tables {
+		isTable[i] = true
+	}
+	for i, t := range tokens {
+		if t.isIdentifier() && names[t.name()] && nextSignificant(tokens, i).text == "." && !isAfterDot(tokens, i) {
+			isTable[i] = true
+		}
+	}
+
+	sb := strings.Builder{}
+	sb.Grow(len(query) + len(tables)*(len(r.prefix)+len(r.postfix)))
+	for i, t := range tokens {
+		if !isTable[i] {
+			sb.WriteString(t.text)
+		} else if t.kind == sqlTokenQuotedIdentifier {
+			sb.WriteString("`" + strings.ReplaceAll(r.TableName(t.name()), "`", "``") + "`")
+		} else {
+			sb.WriteString(r.TableName(t.name()))
+		}
+	}
+	return sb.String()
+}
+
+type sqlTokenKind int
+
+const (
+	sqlTokenSpace sqlTokenKind = iota
+	sqlTokenComment
+	sqlTokenString
+	sqlTokenWord
+	sqlTokenQuotedIdentifier
+	sqlTokenSymbol
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+func (t sqlToken) isIdentifier() bool {
+	return t.kind == sqlTokenQuotedIdentifier || (t.kind == sqlTokenWord && !isDigit(t.text[0]))
+}
+
+// name gives the identifier without quotes
+func (t sqlToken) name() string {
+	if t.kind == sqlTokenQuotedIdentifier && len(t.text) >= 2 {
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], "``", "`")
+	}
+	return t.text
+}
+
+func (t sqlToken) keyword() string {
+	if t.kind != sqlTokenWord {
+		return ""
+	}
+	return strings.ToUpper(t.text)
+}
+
+// tokenizeSql splits the query into tokens - joining text of all tokens gives back the query
+func tokenizeSql(query string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(query); {
+		start := i
+		c := query[i]
+		kind := sqlTokenSymbol
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			kind = sqlTokenSpace
+			for i < len(query) && (query[i] == ' ' || query[i] == '\t' || query[i] == '\n' || query[i] == '\r') {
+				i++
+			}
+
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "--")):
+			kind = sqlTokenComment
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			kind = sqlTokenComment
+			if end := strings.Index(query[i+2:], "*/"); end < 0 {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+
+		case c == '\'' || c == '"' || c == '`':
+			// Quote is escaped by doubling it, or by a backslash in a string literal
+			kind = sqlTokenString
+			if c == '`' {
+				kind = sqlTokenQuotedIdentifier
+			}
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' && c != '`' {
+					i++
+				} else if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			if i++; i > len(query) {
+				i = len(query)
+			}
+
+		case isIdentifierChar(c):
+			kind = sqlTokenWord
+			for i < len(query) && isIdentifierChar(query[i]) {
+				i++
+			}
+
+		default:
+			i++
+		}
+		tokens = append(tokens, sqlToken{kind: kind, text: query[start:i]})
+	}
+	return tokens
+}
+
+// findTables gives the index of tokens which are table names
+func findTables(tokens []sqlToken) []int {
+	var tables []int
+
+	// parens keeps if each open paren is a sub query - FROM in a function (e.g. EXTRACT(YEAR FROM at)) is not a table
+	parens := []bool{true}
+	expectTable := false
+	inTableList := false
+	previous := ""
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind == sqlTokenSpace || t.kind == sqlTokenComment {
+			continue
+		}
+
+		switch {
+		case t.text == "(":
+			parens = append(parens, false)
+			expectTable, inTableList = false, false
+
+		case t.text == ")":
+			if len(parens) > 1 {
+				parens = parens[:len(parens)-1]
+			}
+			inTableList = false
+
+		case t.text == ",":
+			expectTable = inTableList
+
+		case t.kind == sqlTokenWord && isTableKeyword(t.keyword()):
+			keyword := t.keyword()
+			if (keyword == "SELECT" || keyword == "WITH") && previous == "(" {
+				parens[len(parens)-1] = true
+			}
+			subQuery := parens[len(parens)-1]
+			switch keyword {
+			case "FROM":
+				expectTable, inTableList = subQuery, subQuery
+			case "JOIN", "INTO":
+				expectTable, inTableList = subQuery, false
+			case "TABLE":
+				expectTable, inTableList = true, false
+			case "UPDATE":
+				// Not a table in "ON DUPLICATE KEY UPDATE" and "FOR UPDATE"
+				update := previous != "KEY" && previous != "FOR"
+				expectTable, inTableList = update, update
+			case "IF", "NOT", "EXISTS", "IGNORE", "LOW_PRIORITY", "AS":
+				// IF NOT EXISTS after TABLE, IGNORE after UPDATE and alias (AS a) keep the state
+			default:
+				expectTable, inTableList = false, false
+			}
+
+		case expectTable && t.isIdentifier() && previous != "@":
+			// Table may be qualified with db (db.jobs) - last name is the table
+			j := i
+			for nextSignificant(tokens, j).text == "." {
+				k := indexOfNextSignificant(tokens, j)
+				if n := indexOfNextSignificant(tokens, k); n < len(tokens) && tokens[n].isIdentifier() {
+					j = n
+				} else {
+					break
+				}
+			}
+			tables = append(tables, j)
+			i = j
+			expectTable = false
+		}
+		previous = strings.ToUpper(tokens[i].text)
+	}
+	return tables
+}
+
+// findCommonTableExpressions gives names of CTEs (WITH name AS (...)) - they are not tables, so are not renamed
+func findCommonTableExpressions(tokens []sqlToken) map[string]bool {
+	ctes := map[string]bool{}
+	for i, t := range tokens {
+		if !t.isIdentifier() || t.keyword() == "WITH" {
+			continue
+		}
+		as := indexOfNextSignificant(tokens, i)
+		if as < len(tokens) && tokens[as].keyword() == "AS" && nextSignificant(tokens, as).text == "(" {
+			ctes[t.name()] = true
+		}
+	}
+	return ctes
+}
+
+// isTableKeyword is true for keywords which start or end a list of tables
+func isTableKeyword(keyword string) bool {
+	switch keyword {
+	case "SELECT", "WITH", "FROM", "JOIN", "INTO", "UPDATE", "TABLE", "IF", "NOT", "EXISTS", "IGNORE", "LOW_PRIORITY", "AS",
+		"WHERE", "SET", "ON", "USING", "GROUP", "ORDER", "HAVING", "LIMIT", "UNION", "VALUES", "VALUE", "FOR", "LOCK",
+		"WINDOW", "PARTITION", "LEFT", "RIGHT", "INNER", "OUTER", "CROSS", "NATURAL", "STRAIGHT_JOIN", "USE", "FORCE",
+		"DUPLICATE", "KEY", "SKIP", "NOWAIT", "SHARE", "RETURNING", "OUTFILE", "DUMPFILE":
+		return true
+	}
+	return false
+}
+
+func indexOfNextSignificant(tokens []sqlToken, i int) int {
+	for i++; i < len(tokens); i++ {
+		if tokens[i].kind != sqlTokenSpace && tokens[i].kind != sqlTokenComment {
+			return i
+		}
+	}
+	return len(tokens)
+}
+
+func nextSignificant(tokens []sqlToken, i int) sqlToken {
+	if n := indexOfNextSignificant(tokens, i); n < len(tokens) {
+		return tokens[n]
+	}
+	return sqlToken{}
+}
+
+// isAfterDot is true if token is qualified by another name (e.g. jobs in db.jobs.id or j.jobs)
+func isAfterDot(tokens []sqlToken, i int) bool {
+	for i--; i >= 0; i-- {
+		if tokens[i].kind != sqlTokenSpace && tokens[i].kind != sqlTokenComment {
+			return tokens[i].text == "."
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package goxSql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTableNameRewriter(t *testing.T) {
+	r := NewTableNameRewriter("app_", "_v2", map[string]string{"jobs_data": "otp_jobs_data"})
+	for query, expected := range map[string]string{
+		"SELECT id FROM jobs WHERE id=?":                                                           "SELECT id FROM app_jobs_v2 WHERE id=?",
+		"SELECT jobs_count, 'jobs' FROM jobs -- from jobs":                                         "SELECT jobs_count, 'jobs' FROM app_jobs_v2 -- from jobs",
+		"select jobs.id from jobs, jobs_data d where jobs.id=d.id":                                 "select app_jobs_v2.id from app_jobs_v2, otp_jobs_data d where app_jobs_v2.id=d.id",
+		"SELECT * FROM jobs_data d INNER JOIN jobs j ON j.id=d.id":                                 "SELECT * FROM otp_jobs_data d INNER JOIN app_jobs_v2 j ON j.id=d.id",
+		"SELECT * FROM `jobs` AS j":                                                                "SELECT * FROM `app_jobs_v2` AS j",
+		"SELECT * FROM db.jobs":                                                                    "SELECT * FROM db.app_jobs_v2",
+		"UPDATE jobs SET state=? WHERE id=?":                                                       "UPDATE app_jobs_v2 SET state=? WHERE id=?",
+		"DELETE FROM jobs WHERE id IN (SELECT id FROM jobs_data)":                                  "DELETE FROM app_jobs_v2 WHERE id IN (SELECT id FROM otp_jobs_data)",
+		"SELECT EXTRACT(YEAR FROM created_at) FROM jobs":                                           "SELECT EXTRACT(YEAR FROM created_at) FROM app_jobs_v2",
+		"SELECT MIN(id) FROM jobs WHERE tenant=? FOR UPDATE SKIP LOCKED":                           "SELECT MIN(id) FROM app_jobs_v2 WHERE tenant=? FOR UPDATE SKIP LOCKED",
+		"CREATE TABLE IF NOT EXISTS jobs (id INT)":                                                 "CREATE TABLE IF NOT EXISTS app_jobs_v2 (id INT)",
+		"WITH recent AS (SELECT id FROM jobs) SELECT id FROM recent":                               "WITH recent AS (SELECT id FROM app_jobs_v2) SELECT id FROM recent",
+		"INSERT INTO jobs_pause (paused) VALUES (?) ON DUPLICATE KEY UPDATE paused=VALUES(paused)": "INSERT INTO app_jobs_pause_v2 (paused) VALUES (?) ON DUPLICATE KEY UPDATE paused=VALUES(paused)",
+	} {
+		assert.Equal(t, expected, r.RewriteQuery(query), query)
+	}
+
+	// Cached result is the same
+	assert.Equal(t, "SELECT id FROM app_jobs_v2 WHERE id=?", r.RewriteQuery("SELECT id FROM jobs WHERE id=?"))
+
+	// Only mapped tables are renamed if there is no prefix or postfix
+	r = NewTableNameRewriter("", "", map[string]string{"jobs": "otp_jobs"})
+	assert.Equal(t, "SELECT * FROM otp_jobs j JOIN jobs_data d ON j.id=d.id", r.RewriteQuery("SELECT * FROM jobs j JOIN jobs_data d ON j.id=d.id"))
+
+	assert.Nil(t, NewTableNameRewriterFromConfig(&MySQLConfig{}))
+	assert.Equal(t, "SELECT 1", (*TableNameRewriter)(nil).RewriteQuery("SELECT 1"))
+}
+
+func TestInstrumentedDbRewritesTableNames(t *testing.T) {
+	connector := &fakeConnector{}
+	db := sql.OpenDB(NewInstrumentedConnector(connector, nil, &MySQLConfig{TablePrefix: "app_"}, nil))
+	defer db.Close()
+
+	_, err := db.ExecContext(context.Background(), "UPDATE jobs SET state=1")
+	assert.NoError(t, err)
+	rows, err := db.QueryContext(context.Background(), "SELECT id FROM jobs")
+	assert.NoError(t, err)
+	assert.NoError(t, rows.Close())
+
+	_, ok := connector.executed.Load("UPDATE app_jobs SET state=1")
+	assert.True(t, ok)
+	_, ok = connector.executed.Load("SELECT id FROM app_jobs")
+	assert.True(t, ok)
+}
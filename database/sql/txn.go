@@ -16,6 +16,33 @@ type TxnBeginner interface {
 	Begin() (Tx, error)
 }
 
+// TxnBeginnerWithOptions is a TxnBeginner which can begin a transaction with isolation level and read-only options.
+// If TxnBeginner given to Begin implements it, the transaction is started with BeginTx
+type TxnBeginnerWithOptions interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+}
+
+// NewTxnBeginner gives a TxnBeginner (which is also a TxnBeginnerWithOptions) for the given DB
+func NewTxnBeginner(db *sql.DB) TxnBeginner {
+	return &dbTxnBeginner{db: db}
+}
+
+type dbTxnBeginner struct {
+	db *sql.DB
+}
+
+func (d *dbTxnBeginner) Begin() (Tx, error) {
+	return d.BeginTx(context.Background(), nil)
+}
+
+func (d *dbTxnBeginner) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := d.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
 //go:generate mockgen -source=txn.go -destination=./mock_txn.go -package=goxSql
 type Tx interface {
 	// Commit commits the transaction.
@@ -59,6 +86,16 @@ type Tx interface {
 	Stmt(stmt *sql.Stmt) *sql.Stmt
 }
 
+// TxWithExecContext is a Tx which can execute a SQL statement using the provided context - *sql.Tx is one. A Tx which is
+// not a TxWithExecContext falls back to Exec
+type TxWithExecContext interface {
+	Tx
+
+	// ExecContext executes a SQL statement within the transaction, using the provided context.
+	// It returns a sql.Result object and an error.
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
 type txImpl struct {
 	Tx
 
@@ -71,6 +108,19 @@ type txImpl struct {
 	mu             *sync.Mutex
 	rollbackTx     *txImpl
 	isCommitCalled bool
+
+	// done is set in the top level txn once it is committed or rolled back - it can not be joined after that
+	done bool
+
+	// savepoint is set for a child txn which was started with a SAVEPOINT (see TxBeginOptions.UseSavepoint)
+	savepoint      string
+	savepointCount int
+
+	// Hooks are kept in the top level txn - hookMark is the no of hooks registered before the savepoint of this child
+	commitHooks   []func()
+	rollbackHooks []func(cause error)
+	hooksDone     bool
+	hookMark      hookMark
 }
 
 func NewTxExt(tx Tx) Tx {
@@ -81,6 +131,14 @@ func NewTxExt(tx Tx) Tx {
 	}
 }
 
+// ExecContext runs the statement with ctx if the underlying Tx is a TxWithExecContext, else it runs it with Exec
+func (tx *txImpl) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if e, ok := tx.Tx.(TxWithExecContext); ok {
+		return e.ExecContext(ctx, query, args...)
+	}
+	return tx.Tx.Exec(query, args...)
+}
+
 func (tx *txImpl) WithName(name string) Tx {
 	tx.name = name
 	return tx
@@ -88,9 +146,21 @@ func (tx *txImpl) WithName(name string) Tx {
 
 func (tx *txImpl) Commit() (err error) {
 	tx.mu.Lock()
-	defer tx.mu.Unlock()
+	var hooks func()
+	defer func() {
+		tx.mu.Unlock()
+		if hooks != nil {
+			hooks()
+		}
+	}()
 
 	if tx.isChild {
+		// Release the savepoint - work done after savepoint is now part of the parent txn
+		if tx.savepoint != "" && !tx.isCommitCalled {
+			if _, err = tx.Tx.Exec("RELEASE SAVEPOINT " + tx.savepoint); err != nil {
+				return errors.Wrap(err, "failed to release savepoint: txn=%s", tx.String())
+			}
+		}
 		tx.isCommitCalled = true
 	} else {
 		// If this is a parent then we do the final commit
@@ -103,20 +173,51 @@ func (tx *txImpl) Commit() (err error) {
 				ChildFailedTxn: tx.rollbackTx,
 			}
 		}
+		tx.done = true
+		hooks = tx.takeHooks(err)
 	}
 	return err
 }
 
 func (tx *txImpl) Rollback() (err error) {
+	return tx.rollbackWithCause(nil)
+}
+
+// rollbackWithCause rolls back the txn - cause is given to OnRollback hooks (default = ErrTxnRolledBack)
+func (tx *txImpl) rollbackWithCause(cause error) (err error) {
 	tx.mu.Lock()
-	defer tx.mu.Unlock()
+	var hooks func()
+	defer func() {
+		tx.mu.Unlock()
+		if hooks != nil {
+			hooks()
+		}
+	}()
+
+	if cause == nil {
+		cause = ErrTxnRolledBack
+		if tx.root().rollbackTx != nil {
+			cause = &ErrCommitFailedDueToChildTxnFailed{Tx: tx.root(), ChildFailedTxn: tx.root().rollbackTx}
+		}
+	}
 
 	if tx.isChild {
 		if !tx.isCommitCalled {
-			tx.topLevelTx.rollbackTx = tx
+			tx.isCommitCalled = true
+			if tx.savepoint == "" {
+				tx.topLevelTx.rollbackTx = tx
+			} else if _, err = tx.Tx.Exec("ROLLBACK TO SAVEPOINT " + tx.savepoint); err != nil {
+				// We could not undo the work of this child, so parent must not commit it
+				tx.topLevelTx.rollbackTx = tx
+				err = errors.Wrap(err, "failed to rollback to savepoint: txn=%s", tx.String())
+			} else {
+				hooks = tx.takeHooksSinceSavepoint(cause)
+			}
 		}
 	} else {
 		err = tx.Tx.Rollback()
+		tx.done = true
+		hooks = tx.takeHooks(cause)
 	}
 	return err
 }
@@ -125,6 +226,9 @@ func (tx *txImpl) String() string {
 	if tx == nil {
 		return "{nil transaction}"
 	}
+	if tx.savepoint != "" {
+		return fmt.Sprintf("{Name=%s, Child=%t UniqueId=%s Savepoint=%s}", tx.name, tx.isChild, tx.uniqueId, tx.savepoint)
+	}
 	return fmt.Sprintf("{Name=%s, Child=%t UniqueId=%s}", tx.name, tx.isChild, tx.uniqueId)
 }
 
@@ -132,21 +236,36 @@ type TxBeginOptions struct {
 	TxnBeginner                 TxnBeginner
 	Name                        string
 	ContinueExistingTxnIfExists bool
+
+	// UseSavepoint is used with ContinueExistingTxnIfExists. If a txn exists, the child txn starts with a SAVEPOINT and
+	// its Rollback does a ROLLBACK TO SAVEPOINT (Commit does a RELEASE SAVEPOINT). Work of the failed child is undone
+	// and the parent can still commit - without it a rollback in child makes the parent Commit fail with
+	// ErrCommitFailedDueToChildTxnFailed
+	UseSavepoint bool
+
+	// Isolation and ReadOnly are used when a new txn is started - TxnBeginner must be a TxnBeginnerWithOptions to use
+	// them. They are ignored when the txn from context is continued
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
 }
 
 func Begin(ctx context.Context, options TxBeginOptions) (context.Context, Tx, error) {
 	if options.ContinueExistingTxnIfExists && ctx != nil && ctx.Value(txnKey) != nil {
-		if tx, ok := ctx.Value(txnKey).(*txImpl); ok && !tx.isCommitCalled {
-			return ctx,
-				&txImpl{
-					Tx:         tx.Tx,
-					uniqueId:   tx.uniqueId,
-					name:       options.Name,
-					isChild:    true,
-					mu:         tx.mu,
-					topLevelTx: tx,
-				},
-				nil
+		if tx, ok := ctx.Value(txnKey).(*txImpl); ok && tx.isUsable() {
+			child := &txImpl{
+				Tx:         tx.Tx,
+				uniqueId:   tx.uniqueId,
+				name:       options.Name,
+				isChild:    true,
+				mu:         tx.mu,
+				topLevelTx: tx,
+			}
+			if options.UseSavepoint {
+				if err := child.startSavepoint(); err != nil {
+					return ctx, nil, err
+				}
+			}
+			return ctx, child, nil
 		}
 	}
 
@@ -154,7 +273,7 @@ func Begin(ctx context.Context, options TxBeginOptions) (context.Context, Tx, er
 		return ctx, nil, errors.New("missing TxnBeginner in options")
 	}
 
-	if tx, err := options.TxnBeginner.Begin(); err == nil {
+	if tx, err := beginTx(ctx, options); err == nil {
 		t := NewTxExt(tx).(*txImpl)
 		t.isChild = false
 		txWrapper := t.WithName(options.Name)
@@ -165,6 +284,52 @@ func Begin(ctx context.Context, options TxBeginOptions) (context.Context, Tx, er
 	}
 }
 
+func beginTx(ctx context.Context, options TxBeginOptions) (Tx, error) {
+	beginner, ok := options.TxnBeginner.(TxnBeginnerWithOptions)
+	if !ok {
+		if options.Isolation != sql.LevelDefault || options.ReadOnly {
+			return nil, errors.New("TxnBeginner does not support isolation level or read-only txn (it must implement TxnBeginnerWithOptions)")
+		}
+		return options.TxnBeginner.Begin()
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return beginner.BeginTx(ctx, &sql.TxOptions{Isolation: options.Isolation, ReadOnly: options.ReadOnly})
+}
+
+// startSavepoint issues a SAVEPOINT for this child txn - name is unique within the top level txn
+func (tx *txImpl) startSavepoint() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.topLevelTx.savepointCount++
+	savepoint := fmt.Sprintf("gox_sp_%d", tx.topLevelTx.savepointCount)
+	if _, err := tx.Tx.Exec("SAVEPOINT " + savepoint); err != nil {
+		return errors.Wrap(err, "failed to create savepoint: txn=%s", tx.String())
+	}
+	tx.savepoint = savepoint
+	tx.hookMark = hookMark{commit: len(tx.topLevelTx.commitHooks), rollback: len(tx.topLevelTx.rollbackHooks)}
+	return nil
+}
+
+// IsTxnInContext returns true if the context carries a transaction started with Begin which is still usable i.e.
+// a call to Begin with ContinueExistingTxnIfExists=true will join it as a child transaction
+func IsTxnInContext(ctx context.Context) bool {
+	if ctx == nil || ctx.Value(txnKey) == nil {
+		return false
+	}
+	tx, ok := ctx.Value(txnKey).(*txImpl)
+	return ok && tx.isUsable()
+}
+
+// isUsable is false once the txn (or its top level txn) is committed or rolled back
+func (tx *txImpl) isUsable() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return !tx.isCommitCalled && !tx.root().done
+}
+
 type ErrCommitFailedDueToChildTxnFailed struct {
 	Tx             *txImpl
 	ChildFailedTxn *txImpl
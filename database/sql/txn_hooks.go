@@ -0,0 +1,142 @@
+package goxSql
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/errors"
+)
+
+// ErrTxnRolledBack is given to OnRollback hooks when the txn was rolled back by a call to Rollback
+var ErrTxnRolledBack = errors.New("txn rolled back")
+
+// ErrRolledBackToSavepoint is given to OnRollback hooks of a child txn which was rolled back to its savepoint - the
+// parent txn is still alive
+var ErrRolledBackToSavepoint = errors.New("child txn rolled back to savepoint")
+
+// TxWithHooks is a Tx which runs hooks when it ends - a Tx from Begin (or RunInTx) is a TxWithHooks
+type TxWithHooks interface {
+	Tx
+
+	// OnCommit registers a hook which is called after the top level txn is committed. A hook registered in a child txn
+	// is called only if the top level txn commits (and not if the child is rolled back to its savepoint)
+	OnCommit(f func())
+
+	// OnRollback registers a hook which is called once with the cause when the txn is rolled back (or its commit
+	// fails). A hook registered in a child txn with a savepoint is called when the child is rolled back to its savepoint
+	OnRollback(f func(cause error))
+}
+
+type hookMark struct {
+	commit   int
+	rollback int
+}
+
+func (tx *txImpl) root() *txImpl {
+	if tx.topLevelTx != nil {
+		return tx.topLevelTx
+	}
+	return tx
+}
+
+// OnCommit registers a hook which is called after the top level txn is committed - it is not called if the txn is
+// already done
+func (tx *txImpl) OnCommit(f func()) {
+	tx.addHook(f, nil)
+}
+
+// OnRollback registers a hook which is called once with the cause when the txn is rolled back - it is not called if
+// the txn is already done
+func (tx *txImpl) OnRollback(f func(cause error)) {
+	tx.addHook(nil, f)
+}
+
+// addHook gives false if the txn is already done
+func (tx *txImpl) addHook(onCommit func(), onRollback func(cause error)) bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	root := tx.root()
+	if root.hooksDone {
+		return false
+	}
+	if onCommit != nil {
+		root.commitHooks = append(root.commitHooks, onCommit)
+	}
+	if onRollback != nil {
+		root.rollbackHooks = append(root.rollbackHooks, onRollback)
+	}
+	return true
+}
+
+// takeHooks gives the hooks to run when the top level txn ends (commit hooks if err is nil, else rollback hooks). Each
+// hook is given out only once. Must be called with lock held, and the result must be run after the lock is released
+func (tx *txImpl) takeHooks(err error) func() {
+	root := tx.root()
+	if root.hooksDone {
+		return nil
+	}
+	root.hooksDone = true
+	commitHooks, rollbackHooks := root.commitHooks, root.rollbackHooks
+	root.commitHooks, root.rollbackHooks = nil, nil
+	if err == nil {
+		return func() {
+			for _, f := range commitHooks {
+				f()
+			}
+		}
+	}
+	return func() {
+		for _, f := range rollbackHooks {
+			f(err)
+		}
+	}
+}
+
+// takeHooksSinceSavepoint drops commit hooks registered after the savepoint of this child, and gives the rollback hooks
+// registered after it to run. Must be called with lock held
+func (tx *txImpl) takeHooksSinceSavepoint(cause error) func() {
+	root := tx.root()
+	if root.hooksDone {
+		return nil
+	}
+	if tx.hookMark.commit < len(root.commitHooks) {
+		root.commitHooks = root.commitHooks[:tx.hookMark.commit]
+	}
+	if tx.hookMark.rollback >= len(root.rollbackHooks) {
+		return nil
+	}
+	rollbackHooks := append([]func(cause error){}, root.rollbackHooks[tx.hookMark.rollback:]...)
+	root.rollbackHooks = root.rollbackHooks[:tx.hookMark.rollback]
+	if cause == ErrTxnRolledBack {
+		cause = ErrRolledBackToSavepoint
+	}
+	return func() {
+		for _, f := range rollbackHooks {
+			f(cause)
+		}
+	}
+}
+
+// OnCommit registers the hook with the txn in ctx (see TxWithHooks). It returns false if ctx has no txn (or the txn is
+// done) - the caller decides if the hook should run now
+func OnCommit(ctx context.Context, f func()) bool {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx.addHook(f, nil)
+	}
+	return false
+}
+
+// OnRollback registers the hook with the txn in ctx (see TxWithHooks). It returns false if ctx has no txn (or the txn
+// is done)
+func OnRollback(ctx context.Context, f func(cause error)) bool {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx.addHook(nil, f)
+	}
+	return false
+}
+
+func txFromContext(ctx context.Context) (*txImpl, bool) {
+	if !IsTxnInContext(ctx) {
+		return nil, false
+	}
+	tx, ok := ctx.Value(txnKey).(*txImpl)
+	return tx, ok
+}
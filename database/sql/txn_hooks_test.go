@@ -0,0 +1,105 @@
+package goxSql
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTxnHooks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	t.Run("Commit hooks of parent and child run once after top level commit", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		var calls []string
+		txMock.EXPECT().Commit().DoAndReturn(func() error {
+			calls = append(calls, "commit")
+			return nil
+		})
+		txMock.EXPECT().Rollback().Return(nil)
+
+		ctx, tx, err := Begin(context.Background(), TxBeginOptions{TxnBeginner: &tb{tx: txMock}, Name: "parent"})
+		assert.NoError(t, err)
+		tx.(TxWithHooks).OnCommit(func() { calls = append(calls, "parent") })
+		tx.(TxWithHooks).OnRollback(func(cause error) { calls = append(calls, "rollback") })
+
+		_, child, err := Begin(ctx, TxBeginOptions{Name: "child", ContinueExistingTxnIfExists: true})
+		assert.NoError(t, err)
+		child.(TxWithHooks).OnCommit(func() { calls = append(calls, "child") })
+		assert.True(t, OnCommit(ctx, func() { calls = append(calls, "ctx") }))
+		assert.NoError(t, child.Commit())
+		assert.Empty(t, calls, "child commit must not run hooks")
+
+		assert.NoError(t, tx.Commit())
+		_ = tx.Rollback()
+		assert.Equal(t, []string{"commit", "parent", "child", "ctx"}, calls)
+		assert.False(t, OnCommit(ctx, func() {}), "txn is done")
+	})
+
+	t.Run("Rollback hooks run once with the cause of failed commit", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Commit().Times(0)
+		txMock.EXPECT().Rollback().Return(nil)
+
+		var causes []error
+		committed := false
+		ctx, tx, err := Begin(context.Background(), TxBeginOptions{TxnBeginner: &tb{tx: txMock}, Name: "parent"})
+		assert.NoError(t, err)
+		_, child, err := Begin(ctx, TxBeginOptions{Name: "child", ContinueExistingTxnIfExists: true})
+		assert.NoError(t, err)
+		child.(TxWithHooks).OnCommit(func() { committed = true })
+		child.(TxWithHooks).OnRollback(func(cause error) { causes = append(causes, cause) })
+		assert.NoError(t, child.Rollback())
+		assert.Empty(t, causes, "child rollback without savepoint must wait for the top level txn")
+
+		err = tx.Commit()
+		assert.Error(t, err)
+		assert.NoError(t, tx.Rollback())
+		assert.False(t, committed)
+		assert.Len(t, causes, 1)
+		var e *ErrCommitFailedDueToChildTxnFailed
+		assert.True(t, errors.As(causes[0], &e))
+	})
+
+	t.Run("Hooks of a child rolled back to savepoint", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Exec("SAVEPOINT gox_sp_1").Return(nil, nil)
+		txMock.EXPECT().Exec("ROLLBACK TO SAVEPOINT gox_sp_1").Return(nil, nil)
+		txMock.EXPECT().Commit().Return(nil)
+
+		var calls []string
+		ctx, tx, err := Begin(context.Background(), TxBeginOptions{TxnBeginner: &tb{tx: txMock}, Name: "parent"})
+		assert.NoError(t, err)
+		OnCommit(ctx, func() { calls = append(calls, "parent-commit") })
+		OnRollback(ctx, func(cause error) { calls = append(calls, "parent-rollback") })
+
+		_, child, err := Begin(ctx, TxBeginOptions{Name: "child", ContinueExistingTxnIfExists: true, UseSavepoint: true})
+		assert.NoError(t, err)
+		child.(TxWithHooks).OnCommit(func() { calls = append(calls, "child-commit") })
+		child.(TxWithHooks).OnRollback(func(cause error) {
+			assert.Equal(t, ErrRolledBackToSavepoint, cause)
+			calls = append(calls, "child-rollback")
+		})
+		assert.NoError(t, child.Rollback())
+		assert.NoError(t, tx.Commit())
+		assert.Equal(t, []string{"child-rollback", "parent-commit"}, calls)
+	})
+
+	t.Run("RunInTx gives the error of the function to rollback hooks", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Rollback().Return(nil)
+
+		fnErr := errors.New("bad error")
+		var cause error
+		err := RunInTx(context.Background(), RunInTxOptions{TxBeginOptions: TxBeginOptions{TxnBeginner: &tb{tx: txMock}}}, func(ctx context.Context, tx Tx) error {
+			tx.(TxWithHooks).OnRollback(func(c error) { cause = c })
+			return fnErr
+		})
+		assert.Equal(t, fnErr, err)
+		assert.Equal(t, fnErr, cause)
+	})
+
+	assert.False(t, OnRollback(context.Background(), func(cause error) {}))
+}
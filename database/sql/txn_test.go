@@ -162,6 +162,102 @@ func TestCommitForRecursiveTxWithErrorInChildButChildOptedForNewTxn(t *testing.T
 	parentContinueToCommitEvenIfChildFailed(ctx, t, txMock)
 }
 
+func TestCommitForRecursiveTxWithErrorInChildUsingSavepoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	txMock := NewMockTx(ctrl)
+
+	// Parent must commit even if first child failed - work of the failed child is rolled back to its savepoint
+	gomock.InOrder(
+		txMock.EXPECT().Exec("SAVEPOINT gox_sp_1").Return(nil, nil),
+		txMock.EXPECT().Exec("ROLLBACK TO SAVEPOINT gox_sp_1").Return(nil, nil),
+		txMock.EXPECT().Exec("SAVEPOINT gox_sp_2").Return(nil, nil),
+		txMock.EXPECT().Exec("RELEASE SAVEPOINT gox_sp_2").Return(nil, nil),
+		txMock.EXPECT().Commit().Return(nil),
+		txMock.EXPECT().Rollback().Return(nil),
+	)
+
+	child := func(ctx context.Context, t *testing.T, commit bool) {
+		_, tx, err := Begin(ctx, TxBeginOptions{Name: "child", ContinueExistingTxnIfExists: true, UseSavepoint: true})
+		assert.NoError(t, err)
+		defer tx.Rollback()
+		if commit {
+			assert.NoError(t, tx.Commit())
+		}
+	}
+
+	ctx, tx, err := Begin(context.Background(), TxBeginOptions{TxnBeginner: &tb{tx: txMock, err: nil}, Name: "parent", ContinueExistingTxnIfExists: true})
+	assert.NoError(t, err)
+	defer tx.Rollback()
+
+	child(ctx, t, false)
+	child(ctx, t, true)
+	assert.NoError(t, tx.Commit())
+}
+
+func TestSavepointErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	t.Run("Begin fails if savepoint can not be created", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Exec("SAVEPOINT gox_sp_1").Return(nil, errors.New("bad error"))
+		ctx, _, err := Begin(context.Background(), TxBeginOptions{TxnBeginner: &tb{tx: txMock}, Name: "parent"})
+		assert.NoError(t, err)
+		_, _, err = Begin(ctx, TxBeginOptions{Name: "child", ContinueExistingTxnIfExists: true, UseSavepoint: true})
+		assert.Error(t, err)
+	})
+
+	t.Run("Parent commit fails if rollback to savepoint failed", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Exec("SAVEPOINT gox_sp_1").Return(nil, nil)
+		txMock.EXPECT().Exec("ROLLBACK TO SAVEPOINT gox_sp_1").Return(nil, errors.New("bad error"))
+		txMock.EXPECT().Commit().Times(0)
+
+		ctx, tx, err := Begin(context.Background(), TxBeginOptions{TxnBeginner: &tb{tx: txMock}, Name: "parent"})
+		assert.NoError(t, err)
+		_, child, err := Begin(ctx, TxBeginOptions{Name: "child", ContinueExistingTxnIfExists: true, UseSavepoint: true})
+		assert.NoError(t, err)
+		assert.Error(t, child.Rollback())
+		assert.NoError(t, child.Rollback(), "second rollback of child is a no-op")
+
+		err = tx.Commit()
+		_, ok := err.(*ErrCommitFailedDueToChildTxnFailed)
+		assert.True(t, ok)
+	})
+}
+
+func TestIsTxnInContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	txMock := NewMockTx(ctrl)
+	txMock.EXPECT().Commit().Return(nil).Times(1)
+
+	assert.False(t, IsTxnInContext(context.Background()))
+
+	ctx, tx, err := Begin(context.Background(), TxBeginOptions{TxnBeginner: &tb{tx: txMock, err: nil}, Name: "parent"})
+	assert.NoError(t, err)
+	assert.True(t, IsTxnInContext(ctx))
+
+	// A child which joins the txn from context must not need a TxnBeginner
+	_, child, err := Begin(ctx, TxBeginOptions{Name: "child", ContinueExistingTxnIfExists: true})
+	assert.NoError(t, err)
+	assert.NoError(t, child.Commit())
+	assert.NoError(t, tx.Commit())
+
+	// Txn is done - ctx must not give it to a child, and hooks can not be registered with it
+	assert.False(t, IsTxnInContext(ctx))
+	assert.False(t, OnCommit(ctx, func() {}))
+	_, _, err = Begin(ctx, TxBeginOptions{Name: "child", ContinueExistingTxnIfExists: true})
+	assert.Error(t, err, "a done txn must not be joined - with no TxnBeginner a new txn can not be started")
+
+	t.Run("Txn is not in context after rollback", func(t *testing.T) {
+		txMock := NewMockTx(ctrl)
+		txMock.EXPECT().Rollback().Return(nil).Times(1)
+		ctx, tx, err := Begin(context.Background(), TxBeginOptions{TxnBeginner: &tb{tx: txMock, err: nil}, Name: "parent"})
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Rollback())
+		assert.False(t, IsTxnInContext(ctx))
+	})
+}
+
 type tb struct {
 	tx  Tx
 	err error
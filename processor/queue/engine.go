@@ -3,8 +3,10 @@ package queueProcessor
 import (
 	"context"
 	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/queue"
 	"github.com/devlibx/gox-base/util"
 	"github.com/google/uuid"
+	"github.com/opentracing/opentracing-go"
 	"go.uber.org/zap"
 )
 
@@ -42,7 +44,7 @@ func (e *engineImpl) StartProcessing(ctx context.Context, rawEventChannel chan R
 				return
 			case rawEvent, ok := <-rawEventChannel:
 				if ok {
-					processedEvent := e.ProcessEvent(rawEvent)
+					processedEvent := e.process(ctx, rawEvent)
 					if processedEvent.Err == nil {
 						processedEventChannel <- processedEvent
 					} else {
@@ -59,6 +61,26 @@ func (e *engineImpl) StartProcessing(ctx context.Context, rawEventChannel chan R
 	return processedEventChannel
 }
 
+// process runs the processing function - a queue job is processed in a span started from the trace context of the job
+func (e *engineImpl) process(ctx context.Context, rawEvent RawEvent) (processedEvent ProcessedEvent) {
+	if job, ok := rawEvent.OriginalEvent.(*queue.JobDetailsResponse); ok && job != nil {
+		var span opentracing.Span
+		span, ctx = queue.StartSpanForJob(ctx, e.config.Name, job)
+		defer func() {
+			if processedEvent.Err != nil {
+				span.SetTag("error", true)
+				span.LogKV("event", "error", "error.object", processedEvent.Err)
+			}
+			span.Finish()
+		}()
+	}
+
+	if f, ok := e.ProcessingFunction.(ContextProcessingFunction); ok {
+		return f.ProcessEventWithContext(ctx, rawEvent)
+	}
+	return e.ProcessEvent(rawEvent)
+}
+
 // Dummy no op processing function
 type noOpProcessingFunction struct {
 }
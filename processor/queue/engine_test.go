@@ -3,8 +3,11 @@ package queueProcessor
 import (
 	"context"
 	"fmt"
+	"github.com/devlibx/gox-base/queue"
 	"github.com/devlibx/gox-base/test"
 	"github.com/golang/mock/gomock"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -65,3 +68,51 @@ func TestEngine(t *testing.T) {
 	}
 	assert.Equal(t, 2, count)
 }
+
+// spanRecordingProcessingFunction keeps the span which was in the context of each event
+type spanRecordingProcessingFunction struct {
+	noOpProcessingFunction
+	spans []opentracing.Span
+}
+
+func (f *spanRecordingProcessingFunction) ProcessEventWithContext(ctx context.Context, event RawEvent) ProcessedEvent {
+	f.spans = append(f.spans, opentracing.SpanFromContext(ctx))
+	return f.ProcessEvent(event)
+}
+
+func TestEngine_JobIsProcessedInSpanOfScheduler(t *testing.T) {
+	old := opentracing.GlobalTracer()
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	t.Cleanup(func() { opentracing.SetGlobalTracer(old) })
+
+	ctrl := gomock.NewController(t)
+	cf := test.BuildMockCf(t, ctrl)
+
+	// Trace context is stored in the job by schedule
+	parent := tracer.StartSpan("schedule")
+	properties := queue.InjectTraceContext(opentracing.ContextWithSpan(context.Background(), parent), nil)
+	parent.Finish()
+
+	f := &spanRecordingProcessingFunction{}
+	engine := NewEngine(cf, Config{Name: "send_otp", EventBuffer: 1, ProcessingFunction: f})
+	rawEventChannel := make(chan RawEvent, 2)
+	rawEventChannel <- RawEvent{Data: map[string]interface{}{"in": 1}, OriginalEvent: &queue.JobDetailsResponse{Id: "1", Properties: properties}}
+	rawEventChannel <- RawEvent{Data: map[string]interface{}{"in": 2}}
+	close(rawEventChannel)
+
+	count := 0
+	for range engine.StartProcessing(context.Background(), rawEventChannel) {
+		count++
+	}
+	assert.Equal(t, 2, count)
+
+	// Job is processed in a child span of schedule, other event has no span
+	if assert.Len(t, f.spans, 2) && assert.NotNil(t, f.spans[0]) {
+		span := f.spans[0].(*mocktracer.MockSpan)
+		assert.Equal(t, "send_otp", span.OperationName)
+		assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, span.ParentID)
+		assert.Nil(t, f.spans[1])
+	}
+	assert.Len(t, tracer.FinishedSpans(), 2)
+}
@@ -10,6 +10,13 @@ type ProcessingFunction interface {
 	ProcessEvent(event RawEvent) ProcessedEvent
 }
 
+// ContextProcessingFunction is a ProcessingFunction which also gets a context. If the raw event is a queue job, the
+// context has the span of the job (see queue.StartSpanForJob) - use it to trace the work done for the job
+type ContextProcessingFunction interface {
+	ProcessingFunction
+	ProcessEventWithContext(ctx context.Context, event RawEvent) ProcessedEvent
+}
+
 type Config struct {
 	Name               string
 	Script             string
@@ -18,7 +25,10 @@ type Config struct {
 }
 
 type RawEvent struct {
-	Data          gox.StringObjectMap
+	Data gox.StringObjectMap
+
+	// OriginalEvent if it is a queue job (*queue.JobDetailsResponse), the event is processed in a span which continues
+	// the trace of the request which scheduled the job
 	OriginalEvent interface{}
 }
 
@@ -0,0 +1,96 @@
+package queueAdmin
+
+import (
+	"github.com/devlibx/gox-base/queue"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// RegisterRoutes adds admin endpoints to pause/resume a job type for a tenant
+//
+// GET  /queue/admin/tenant/:tenant/job_type/:job_type/pause  - current pause status
+// POST /queue/admin/tenant/:tenant/job_type/:job_type/pause  - pause, body {"paused_by": "...", "reason": "..."}
+// POST /queue/admin/tenant/:tenant/job_type/:job_type/resume - resume, body {"resumed_by": "...", "reason": "..."}
+func RegisterRoutes(router gin.IRouter, q queue.Queue) {
+	h := &handler{queue: q}
+	group := router.Group("/queue/admin/tenant/:tenant/job_type/:job_type")
+	group.GET("/pause", h.pauseStatus)
+	group.POST("/pause", h.pause)
+	group.POST("/resume", h.resume)
+}
+
+type handler struct {
+	queue queue.Queue
+}
+
+func (h *handler) pauseStatus(c *gin.Context) {
+	tenant, jobType, ok := readTenantAndJobType(c)
+	if !ok {
+		return
+	}
+
+	if result, err := h.queue.FetchJobTypePauseStatus(c.Request.Context(), queue.JobTypePauseStatusRequest{Tenant: tenant, JobType: jobType}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *handler) pause(c *gin.Context) {
+	tenant, jobType, ok := readTenantAndJobType(c)
+	if !ok {
+		return
+	}
+
+	req := queue.PauseJobTypeRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body: " + err.Error()})
+		return
+	} else if req.PausedBy == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "paused_by is required for audit"})
+		return
+	}
+	req.Tenant, req.JobType = tenant, jobType
+
+	if _, err := h.queue.PauseJobType(c.Request.Context(), req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"tenant": tenant, "job_type": jobType, "paused": true})
+	}
+}
+
+func (h *handler) resume(c *gin.Context) {
+	tenant, jobType, ok := readTenantAndJobType(c)
+	if !ok {
+		return
+	}
+
+	req := queue.ResumeJobTypeRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body: " + err.Error()})
+		return
+	} else if req.ResumedBy == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resumed_by is required for audit"})
+		return
+	}
+	req.Tenant, req.JobType = tenant, jobType
+
+	if _, err := h.queue.ResumeJobType(c.Request.Context(), req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"tenant": tenant, "job_type": jobType, "paused": false})
+	}
+}
+
+func readTenantAndJobType(c *gin.Context) (tenant int, jobType int, ok bool) {
+	var err error
+	if tenant, err = strconv.Atoi(c.Param("tenant")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant must be a number"})
+		return 0, 0, false
+	} else if jobType, err = strconv.Atoi(c.Param("job_type")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "job_type must be a number"})
+		return 0, 0, false
+	}
+	return tenant, jobType, true
+}
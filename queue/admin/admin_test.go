@@ -0,0 +1,66 @@
+package queueAdmin
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/queue"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type pauseRecordingQueue struct {
+	queue.Queue
+	paused map[[2]int]string
+}
+
+func (p *pauseRecordingQueue) PauseJobType(ctx context.Context, req queue.PauseJobTypeRequest) (*queue.PauseJobTypeResponse, error) {
+	p.paused[[2]int{req.Tenant, req.JobType}] = req.PausedBy
+	return &queue.PauseJobTypeResponse{}, nil
+}
+
+func (p *pauseRecordingQueue) ResumeJobType(ctx context.Context, req queue.ResumeJobTypeRequest) (*queue.ResumeJobTypeResponse, error) {
+	delete(p.paused, [2]int{req.Tenant, req.JobType})
+	return &queue.ResumeJobTypeResponse{}, nil
+}
+
+func (p *pauseRecordingQueue) FetchJobTypePauseStatus(ctx context.Context, req queue.JobTypePauseStatusRequest) (*queue.JobTypePauseStatusResponse, error) {
+	by, paused := p.paused[[2]int{req.Tenant, req.JobType}]
+	return &queue.JobTypePauseStatusResponse{Tenant: req.Tenant, JobType: req.JobType, Paused: paused, UpdatedBy: by}, nil
+}
+
+func TestPauseAndResumeRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	q := &pauseRecordingQueue{paused: map[[2]int]string{}}
+	router := gin.New()
+	RegisterRoutes(router, q)
+
+	call := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := call(http.MethodPost, "/queue/admin/tenant/1/job_type/2/pause", `{"paused_by": "oncall", "reason": "incident"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "oncall", q.paused[[2]int{1, 2}])
+
+	w = call(http.MethodGet, "/queue/admin/tenant/1/job_type/2/pause", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"paused":true`)
+
+	w = call(http.MethodPost, "/queue/admin/tenant/1/job_type/2/resume", `{"resumed_by": "oncall"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, q.paused)
+
+	// Who did it is mandatory for audit
+	w = call(http.MethodPost, "/queue/admin/tenant/1/job_type/2/pause", `{"reason": "incident"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = call(http.MethodPost, "/queue/admin/tenant/abc/job_type/2/pause", `{"paused_by": "oncall"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
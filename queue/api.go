@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/devlibx/gox-base"
+	goxSql "github.com/devlibx/gox-base/database/sql"
 	errors2 "github.com/devlibx/gox-base/errors"
 	"github.com/oklog/ulid/v2"
 	"strings"
@@ -28,6 +29,7 @@ var (
 	SubStatusNoRetryPendingError     = StatusFailed*10 + 3
 	SubStatusRetryPendingError       = StatusFailed*10 + 4
 	SubStatusRetryIgnoredByUserError = StatusFailed*10 + 5
+	SubStatusExpired                 = StatusFailed*10 + 6
 )
 
 // ErrNoMoreRetry indicate that no more retries are needed
@@ -36,13 +38,25 @@ var ErrNoMoreRetry = errors.New("do not retry anymore")
 var NoJobsToRunAtCurrently = errors.New("queue does not have a job to run now")
 
 type MySqlBackedQueueConfig struct {
-	Tenant     int `json:"tenant,omitempty"`
-	MaxJobType int `json:"max_job_type,omitempty"`
+	Tenant     int `json:"tenant,omitempty" yaml:"tenant"`
+	MaxJobType int `json:"max_job_type,omitempty" yaml:"max_job_type"`
 
-	UsePreparedStatement       bool `json:"use_prepared_statement"`
-	UseMinQueryToPickLatestRow bool `json:"use_min_query_to_pick_latest_row"`
+	UsePreparedStatement       bool `json:"use_prepared_statement" yaml:"use_prepared_statement"`
+	UseMinQueryToPickLatestRow bool `json:"use_min_query_to_pick_latest_row" yaml:"use_min_query_to_pick_latest_row"`
 
-	DontRunPoller bool
+	DontRunPoller bool `yaml:"dont_run_poller"`
+
+	// PauseStatusCacheTimeInMs is how long the pause status of a job type is cached before poll reads it again
+	// from DB (default = 1000ms). Pause/resume done by this queue instance are visible immediately
+	PauseStatusCacheTimeInMs int `json:"pause_status_cache_time_in_ms" yaml:"pause_status_cache_time_in_ms"`
+
+	// LongPollMinIntervalInMs and LongPollMaxIntervalInMs bound the adaptive interval used by long poll to check DB
+	// when queue is empty (default = 50ms and 1000ms). The interval doubles on each empty poll and resets on a wakeup
+	LongPollMinIntervalInMs int `json:"long_poll_min_interval_in_ms" yaml:"long_poll_min_interval_in_ms"`
+	LongPollMaxIntervalInMs int `json:"long_poll_max_interval_in_ms" yaml:"long_poll_max_interval_in_ms"`
+
+	// PropertiesCodec if set, job properties are compressed and/or encrypted before they are stored (see NewPropertiesCodec)
+	PropertiesCodec *PropertiesCodecConfig `json:"properties_codec,omitempty" yaml:"properties_codec"`
 }
 
 // Queue is an interface to provide all queue related methods. It allows you to schedule, poll etc
@@ -50,6 +64,7 @@ type Queue interface {
 
 	// Schedule method puts a request on the queue to be executed at a scheduled time.
 	// It takes a context and a ScheduleRequest as input and returns a ScheduleResponse or an error.
+	// A transient DB error (deadlock or lock wait timeout) is not retried - goxSql.IsRetryableTxnError gives true for it
 	Schedule(ctx context.Context, req ScheduleRequest) (*ScheduleResponse, error)
 
 	// Poll method retrieves a request from the queue to be executed immediately.
@@ -71,6 +86,26 @@ type Queue interface {
 	// UpdateJobData updates the data for the given job
 	// It takes a context and a UpdateJobDataRequest as input and returns a UpdateJobDataResponse or an error.
 	UpdateJobData(ctx context.Context, req UpdateJobDataRequest) (result *UpdateJobDataResponse, err error)
+
+	// PauseJobType stops consumption of a job type for a tenant. Poll returns JobTypePausedError until it is resumed.
+	// It takes a context and a PauseJobTypeRequest as input and returns a PauseJobTypeResponse or an error.
+	PauseJobType(ctx context.Context, req PauseJobTypeRequest) (result *PauseJobTypeResponse, err error)
+
+	// ResumeJobType resumes consumption of a job type for a tenant which was paused using PauseJobType.
+	// It takes a context and a ResumeJobTypeRequest as input and returns a ResumeJobTypeResponse or an error.
+	ResumeJobType(ctx context.Context, req ResumeJobTypeRequest) (result *ResumeJobTypeResponse, err error)
+
+	// FetchRetryGroup gives all executions (first run + retries) of a job in the order they were scheduled.
+	// It takes a context and a FetchRetryGroupRequest as input and returns a FetchRetryGroupResponse or an error.
+	FetchRetryGroup(ctx context.Context, req FetchRetryGroupRequest) (result *FetchRetryGroupResponse, err error)
+
+	// FetchJobs gives jobs matching the filter in the order of id, a page at a time (used by Export).
+	// It takes a context and a FetchJobsRequest as input and returns a FetchJobsResponse or an error.
+	FetchJobs(ctx context.Context, req FetchJobsRequest) (result *FetchJobsResponse, err error)
+
+	// FetchJobTypePauseStatus gives the pause status of a job type for a tenant.
+	// It takes a context and a JobTypePauseStatusRequest as input and returns a JobTypePauseStatusResponse or an error.
+	FetchJobTypePauseStatus(ctx context.Context, req JobTypePauseStatusRequest) (result *JobTypePauseStatusResponse, err error)
 }
 
 // ScheduleRequest is a request to schedule a run of this job
@@ -99,14 +134,26 @@ type ScheduleRequest struct {
 
 	Properties map[string]interface{}
 
+	// ExpireAt (optional) is the time after which this job is worthless. Poll skips expired jobs and marks them
+	// failed with SubStatusExpired. It must not be before At
+	ExpireAt time.Time
+
+	// InternalTx if set, the job is inserted in this transaction. Waiting pollers are not woken up for such a job (it is
+	// not visible to them until the caller commits), it is picked by the next poll after the commit.
+	// If it is not set and ctx carries a goxSql transaction (started with goxSql.Begin), the job is inserted as a
+	// child of that transaction i.e. the job is committed or rolled back with the caller's transaction
 	InternalTx           *sql.Tx
 	InternalRetryGroupId string
+
+	// InternalId if set, the job is created with this id instead of a generated one (used by Import to keep ids).
+	// The time in the id must be At truncated to second - queue finds the partition of a job from its id
+	InternalId string
 }
 
 func (s ScheduleRequest) String() string {
 	return fmt.Sprintf(
-		"ScheduleRequest{At:%s, JobType:%d, Tenant:%d, CorrelationId:%s, RemainingExecution:%d, StringUdf1:%s, StringUdf2:%s, IntUdf1:%d, IntUdf2:%d, Properties:%v}",
-		s.At, s.JobType, s.Tenant, s.CorrelationId, s.RemainingExecution, s.StringUdf1, s.StringUdf2, s.IntUdf1, s.IntUdf2, s.Properties,
+		"ScheduleRequest{At:%s, JobType:%d, Tenant:%d, CorrelationId:%s, RemainingExecution:%d, StringUdf1:%s, StringUdf2:%s, IntUdf1:%d, IntUdf2:%d, Properties:%v, ExpireAt:%s}",
+		s.At, s.JobType, s.Tenant, s.CorrelationId, s.RemainingExecution, s.StringUdf1, s.StringUdf2, s.IntUdf1, s.IntUdf2, s.Properties, s.ExpireAt,
 	)
 }
 
@@ -119,6 +166,11 @@ type ScheduleResponse struct {
 type PollRequest struct {
 	Tenant  int
 	JobType int
+
+	// LongPollTimeout if set, Poll waits up to this duration for a job instead of returning NoJobsToRunAtCurrently
+	// or PollResponseError immediately. A job scheduled in the same process wakes the poller at once, jobs scheduled
+	// by other processes are picked by polling with an adaptive interval
+	LongPollTimeout time.Duration
 }
 
 // PollResponse response of schedule
@@ -126,6 +178,18 @@ type PollResponse struct {
 	Id                  string
 	RecordPartitionTime time.Time
 	ProcessAtTimeUsed   time.Time
+
+	// ExpireAt is the deadline of this job (zero if job does not expire)
+	ExpireAt time.Time
+}
+
+// WithDeadline gives a context to process this job - it is cancelled at ExpireAt so late work is abandoned.
+// If the job does not expire, the context is only cancelled when parent is done or cancel func is called
+func (s PollResponse) WithDeadline(parent context.Context) (context.Context, context.CancelFunc) {
+	if s.ExpireAt.IsZero() {
+		return context.WithCancel(parent)
+	}
+	return context.WithDeadline(parent, s.ExpireAt)
 }
 
 type PollResponseError struct {
@@ -137,6 +201,17 @@ func (p PollResponseError) Error() string {
 	return fmt.Sprintf("(PollResponseError) no job avaliable to process now. Wait for %vms", p.WaitForDurationBeforeTrying.Milliseconds())
 }
 
+// JobTypePausedError is returned from Poll if the job type is paused for the tenant
+type JobTypePausedError struct {
+	Tenant                      int
+	JobType                     int
+	WaitForDurationBeforeTrying time.Duration
+}
+
+func (p JobTypePausedError) Error() string {
+	return fmt.Sprintf("(JobTypePausedError) job type is paused: tenant=%d, jobType=%d. Wait for %vms", p.Tenant, p.JobType, p.WaitForDurationBeforeTrying.Milliseconds())
+}
+
 // JobDetailsRequest response of schedule
 type JobDetailsRequest struct {
 	Id string
@@ -146,6 +221,9 @@ type JobDetailsRequest struct {
 type MarkJobFailedWithRetryRequest struct {
 	Id              string
 	ScheduleRetryAt time.Time
+
+	// FailureReason (optional) is kept with the failed execution - it is returned in FetchRetryGroup
+	FailureReason string
 }
 
 // MarkJobFailedWithRetryResponse mark it failed and set for retry
@@ -154,6 +232,95 @@ type MarkJobFailedWithRetryResponse struct {
 	Done       bool
 }
 
+// FetchJobsRequest is the filter of jobs to fetch - empty JobTypes/States match all job types/states
+type FetchJobsRequest struct {
+	Tenant   int
+	JobTypes []int
+	States   []int
+
+	// ProcessAtFrom (inclusive) and ProcessAtTo (exclusive) bound the process time of jobs - zero means no bound
+	ProcessAtFrom time.Time
+	ProcessAtTo   time.Time
+
+	// AfterId is the cursor - use NextAfterId of the previous page (empty for the first page)
+	AfterId string
+
+	// Limit is the max no of jobs in a page (default = 100, max = 1000)
+	Limit int
+}
+
+// FetchJobsResponse is a page of jobs. NextAfterId is empty if there are no more jobs
+type FetchJobsResponse struct {
+	Jobs        []*JobDetailsResponse
+	NextAfterId string
+}
+
+// PageSize gives the no of jobs in a page after applying default and max
+func (r FetchJobsRequest) PageSize() int {
+	if r.Limit <= 0 {
+		return 100
+	} else if r.Limit > 1000 {
+		return 1000
+	}
+	return r.Limit
+}
+
+// Matches gives true if the job (excluding AfterId) matches the filter - helper for queue implementations
+func (r FetchJobsRequest) Matches(tenant int, jobType int, state int, processAt time.Time) bool {
+	if tenant != r.Tenant {
+		return false
+	} else if !r.ProcessAtFrom.IsZero() && processAt.Before(r.ProcessAtFrom) {
+		return false
+	} else if !r.ProcessAtTo.IsZero() && !processAt.Before(r.ProcessAtTo) {
+		return false
+	}
+	return containsOrEmpty(r.JobTypes, jobType) && containsOrEmpty(r.States, state)
+}
+
+func containsOrEmpty(values []int, value int) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateInternalId checks that the time in id is the process time - see ScheduleRequest.InternalId
+func ValidateInternalId(id string, processAt time.Time) error {
+	t, err := RecordIdToTime(id)
+	if err != nil {
+		return err
+	} else if !t.Equal(processAt.Truncate(time.Second)) {
+		return errors2.New("time in id must be the process time of the job: id=%s, idTime=%s, processAt=%s", id, t, processAt)
+	}
+	return nil
+}
+
+// FetchRetryGroupRequest to get all executions of a job - use JobDetailsResponse.RetryGroup as RetryGroupId
+type FetchRetryGroupRequest struct {
+	RetryGroupId string
+}
+
+// FetchRetryGroupResponse has all executions of a job in the order they were scheduled
+type FetchRetryGroupResponse struct {
+	RetryGroupId string
+	Attempts     []JobAttempt
+}
+
+// JobAttempt is a single execution of a job in a retry group
+type JobAttempt struct {
+	Id                 string
+	ScheduledAt        time.Time
+	State              int
+	SubState           int
+	RemainingExecution int
+	FailureReason      string
+}
+
 type MarkJobCompletedRequest struct {
 	Id string
 }
@@ -190,6 +357,13 @@ type JobDetailsResponse struct {
 	IntUdf2    int
 
 	Properties map[string]interface{}
+
+	// RawProperties is the stored json of Properties, if the queue keeps properties as json (nil otherwise). Numbers in
+	// Properties are float64 and lose precision above 2^53 - decode this to read them exactly
+	RawProperties []byte
+
+	// ExpireAt is the deadline of this job (zero if job does not expire)
+	ExpireAt time.Time
 }
 
 func (s PollResponse) String() string {
@@ -208,18 +382,58 @@ type UpdateJobDataRequest struct {
 type UpdateJobDataResponse struct {
 }
 
+// PauseJobTypeRequest pause a job type for a tenant - PausedBy and Reason are kept for audit
+type PauseJobTypeRequest struct {
+	Tenant   int    `json:"tenant"`
+	JobType  int    `json:"job_type"`
+	PausedBy string `json:"paused_by"`
+	Reason   string `json:"reason"`
+}
+
+type PauseJobTypeResponse struct {
+}
+
+// ResumeJobTypeRequest resume a paused job type for a tenant - ResumedBy and Reason are kept for audit
+type ResumeJobTypeRequest struct {
+	Tenant    int    `json:"tenant"`
+	JobType   int    `json:"job_type"`
+	ResumedBy string `json:"resumed_by"`
+	Reason    string `json:"reason"`
+}
+
+type ResumeJobTypeResponse struct {
+}
+
+type JobTypePauseStatusRequest struct {
+	Tenant  int `json:"tenant"`
+	JobType int `json:"job_type"`
+}
+
+// JobTypePauseStatusResponse gives the pause status with who changed it last and when
+type JobTypePauseStatusResponse struct {
+	Tenant    int       `json:"tenant"`
+	JobType   int       `json:"job_type"`
+	Paused    bool      `json:"paused"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
 // MySqlBackedStoreBackendConfig is the config to be used for MySQL backed queue
 type MySqlBackedStoreBackendConfig struct {
-	Host                 string              `json:"host,omitempty"`
-	Port                 int                 `json:"port,omitempty"`
-	User                 string              `json:"user,omitempty"`
-	Password             string              `json:"password,omitempty"`
-	Database             string              `json:"database,omitempty"`
-	MaxIdleConnection    int                 `json:"max_idle_connection"`
-	MaxOpenConnection    int                 `json:"max_open_connection"`
-	ConnMaxLifetimeInSec int                 `json:"conn_max_lifetime_in_sec"`
-	Properties           gox.StringObjectMap `json:"properties,omitempty"`
-	ColumnMapping        map[string]string   `json:"column_mapping,omitempty"`
+	Host                 string              `json:"host,omitempty" yaml:"host"`
+	Port                 int                 `json:"port,omitempty" yaml:"port"`
+	User                 string              `json:"user,omitempty" yaml:"user"`
+	Password             string              `json:"password,omitempty" yaml:"password"`
+	Database             string              `json:"database,omitempty" yaml:"database"`
+	MaxIdleConnection    int                 `json:"max_idle_connection" yaml:"max_idle_connection"`
+	MaxOpenConnection    int                 `json:"max_open_connection" yaml:"max_open_connection"`
+	ConnMaxLifetimeInSec int                 `json:"conn_max_lifetime_in_sec" yaml:"conn_max_lifetime_in_sec"`
+	Properties           gox.StringObjectMap `json:"properties,omitempty" yaml:"properties"`
+	ColumnMapping        map[string]string   `json:"column_mapping,omitempty" yaml:"column_mapping"`
+
+	// CircuitBreaker fails db calls of the queue fast when the db is degraded (see goxSql.CircuitBreaker)
+	CircuitBreaker goxSql.CircuitBreakerConfig `json:"circuit_breaker" yaml:"circuit_breaker"`
 }
 
 func (m *MySqlBackedStoreBackendConfig) SetupDefault() {
@@ -243,6 +457,22 @@ func (m *MySqlBackedStoreBackendConfig) SetupDefault() {
 	}
 }
 
+// MySQLConfig gives the goxSql config (used to open the db) for this store config
+func (m *MySqlBackedStoreBackendConfig) MySQLConfig() goxSql.MySQLConfig {
+	return goxSql.MySQLConfig{
+		ServerName:         m.Database,
+		Host:               m.Host,
+		Port:               m.Port,
+		User:               m.User,
+		Password:           m.Password,
+		Db:                 m.Database,
+		MaxOpenConnections: m.MaxOpenConnection,
+		MaxIdleConnections: m.MaxIdleConnection,
+		ConnMaxLifetimeSec: m.ConnMaxLifetimeInSec,
+		CircuitBreaker:     m.CircuitBreaker,
+	}
+}
+
 // StoreBackend is the backend to be used to give connections to store
 type StoreBackend interface {
 
@@ -260,26 +490,63 @@ type QueryRewriter interface {
 	RewriteQuery(table string, input string) string
 }
 
+// NewUdfAndTableNameQueryRewriter gives query rewriter which renames queue tables (jobs, jobs_data, jobs_pause and
+// jobs_pause_audit) to tables of given name i.e. <tableName>, <tableName>_data, <tableName>_pause ...
 func NewUdfAndTableNameQueryRewriter(tableName string) QueryRewriter {
-	return &UdfAndTableNameQueryRewriter{tableName: tableName}
+	return &UdfAndTableNameQueryRewriter{tableNameRewriter: newQueueTableNameRewriter(tableName)}
 }
 
+// NewUdfAndTableNameQueryRewriterWithUdfColumnNames gives query rewriter for given table which also renames UDF columns
+func NewUdfAndTableNameQueryRewriterWithUdfColumnNames(tableName string, names UdfColumnNames) QueryRewriter {
+	r := &UdfAndTableNameQueryRewriter{tableNameRewriter: newQueueTableNameRewriter(tableName)}
+	r.SetUdfColumnNames(names)
+	return r
+}
+
+func newQueueTableNameRewriter(tableName string) *goxSql.TableNameRewriter {
+	return goxSql.NewTableNameRewriter("", "", map[string]string{
+		"jobs":             tableName,
+		"jobs_data":        tableName + "_data",
+		"jobs_pause":       tableName + "_pause",
+		"jobs_pause_audit": tableName + "_pause_audit",
+	})
+}
+
+// UdfAndTableNameQueryRewriter renames queue tables in queries (only table names are renamed - see
+// goxSql.TableNameRewriter) and UDF columns in jobs_data queries
 type UdfAndTableNameQueryRewriter struct {
-	tableName  string
-	udfString1 string
-	udfString2 string
-	udfInt1    string
-	udfInt2    string
+	tableNameRewriter *goxSql.TableNameRewriter
+	udfString1        string
+	udfString2        string
+	udfInt1           string
+	udfInt2           string
+}
+
+// UdfColumnNames gives the names of UDF columns in jobs_data table, if they are renamed in your table. Empty name
+// means the column is not renamed
+type UdfColumnNames struct {
+	StringUdf1 string `json:"string_udf_1,omitempty" yaml:"string_udf_1"`
+	StringUdf2 string `json:"string_udf_2,omitempty" yaml:"string_udf_2"`
+	IntUdf1    string `json:"int_udf_1,omitempty" yaml:"int_udf_1"`
+	IntUdf2    string `json:"int_udf_2,omitempty" yaml:"int_udf_2"`
+}
+
+// SetUdfColumnNames sets the renamed UDF columns to be used in jobs_data queries
+func (n *UdfAndTableNameQueryRewriter) SetUdfColumnNames(names UdfColumnNames) {
+	n.udfString1 = names.StringUdf1
+	n.udfString2 = names.StringUdf2
+	n.udfInt1 = names.IntUdf1
+	n.udfInt2 = names.IntUdf2
 }
 
 func (n *UdfAndTableNameQueryRewriter) RewriteQuery(table string, input string) string {
 	switch table {
 	case "jobs":
-		input = strings.ReplaceAll(input, "jobs", n.tableName)
+		input = n.tableNameRewriter.RewriteQuery(input)
 		break
 
 	case "jobs_data":
-		input = strings.ReplaceAll(input, "jobs_data", n.tableName+"_data")
+		input = n.tableNameRewriter.RewriteQuery(input)
 		if n.udfString1 != "" {
 			input = strings.ReplaceAll(input, "string_udf_1", n.udfString1)
 		}
@@ -307,10 +574,13 @@ func GeneratePartitionTimeByRecordId(id string) (time.Time, error) {
 }
 
 func RecordIdToTime(id string) (time.Time, error) {
+	if isSnowflakeId(id) {
+		return SnowflakeIdToTime(id)
+	}
 	if i, err := ulid.Parse(id); err == nil {
 		return time.UnixMilli(int64(i.Time())), nil
 	} else {
-		return time.Time{}, errors2.Wrap(err, "failed to get time from id: id=%s", i)
+		return time.Time{}, errors2.Wrap(err, "failed to get time from id: id=%s", id)
 	}
 }
 
@@ -0,0 +1,309 @@
+package queueChaos
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/queue"
+	"github.com/go-sql-driver/mysql"
+	"sync"
+	"time"
+)
+
+// WrapConnector gives a connector whose connections inject faults (as decided by injector) in connect, begin,
+// prepare, exec, query and commit. Use it with sql.OpenDB to get a *sql.DB with faults
+func WrapConnector(c driver.Connector, injector *Injector) driver.Connector {
+	return &connector{connector: c, injector: injector}
+}
+
+type connector struct {
+	connector driver.Connector
+	injector  *Injector
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	d, err := c.injector.before(ctx, OperationDbConnect)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	} else if d.failAfterCall {
+		_ = dc.Close()
+		return nil, d.err
+	}
+	return &conn{conn: dc, injector: c.injector}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+type conn struct {
+	conn     driver.Conn
+	injector *Injector
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (s driver.Stmt, err error) {
+	var d decision
+	if d, err = c.injector.before(ctx, OperationDbPrepare); err != nil {
+		return nil, err
+	}
+	if p, ok := c.conn.(driver.ConnPrepareContext); ok {
+		s, err = p.PrepareContext(ctx, query)
+	} else {
+		s, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	} else if d.failAfterCall {
+		_ = s.Close()
+		return nil, d.err
+	}
+	return &stmt{stmt: s, injector: c.injector}, nil
+}
+
+func (c *conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (t driver.Tx, err error) {
+	var d decision
+	if d, err = c.injector.before(ctx, OperationDbBegin); err != nil {
+		return nil, err
+	}
+	if b, ok := c.conn.(driver.ConnBeginTx); ok {
+		t, err = b.BeginTx(ctx, opts)
+	} else {
+		t, err = c.conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	} else if d.failAfterCall {
+		_ = t.Rollback()
+		return nil, d.err
+	}
+	return &tx{tx: t, injector: c.injector}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	d, err := c.injector.before(ctx, OperationDbExec)
+	if err != nil {
+		return nil, err
+	}
+	result, err := e.ExecContext(ctx, query, args)
+	if err == nil && d.failAfterCall {
+		return nil, d.err
+	}
+	return result, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	d, err := c.injector.before(ctx, OperationDbQuery)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.QueryContext(ctx, query, args)
+	if err == nil && d.failAfterCall {
+		_ = rows.Close()
+		return nil, d.err
+	}
+	return rows, err
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type tx struct {
+	tx       driver.Tx
+	injector *Injector
+}
+
+func (t *tx) Commit() error {
+	d, err := t.injector.before(context.Background(), OperationDbCommit)
+	if err != nil {
+		_ = t.tx.Rollback()
+		return err
+	}
+	if err = t.tx.Commit(); err == nil && d.failAfterCall {
+		return d.err
+	}
+	return err
+}
+
+func (t *tx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+type stmt struct {
+	stmt     driver.Stmt
+	injector *Injector
+}
+
+func (s *stmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *stmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.stmt.Exec(args)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.stmt.Query(args)
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, err error) {
+	var d decision
+	if d, err = s.injector.before(ctx, OperationDbExec); err != nil {
+		return nil, err
+	}
+	if e, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err = e.ExecContext(ctx, args)
+	} else {
+		result, err = s.Exec(namedValuesToValues(args))
+	}
+	if err == nil && d.failAfterCall {
+		return nil, d.err
+	}
+	return result, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	var d decision
+	if d, err = s.injector.before(ctx, OperationDbQuery); err != nil {
+		return nil, err
+	}
+	if q, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Query(namedValuesToValues(args))
+	}
+	if err == nil && d.failAfterCall {
+		_ = rows.Close()
+		return nil, d.err
+	}
+	return rows, err
+}
+
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedValuesToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return values
+}
+
+// storeBackend is a MySQL store backend whose DB injects faults
+type storeBackend struct {
+	db       *sql.DB
+	config   queue.MySqlBackedStoreBackendConfig
+	injector *Injector
+
+	initOnce *sync.Once
+	initErr  error
+}
+
+// NewStoreBackend gives a MySQL store backend (same as mysqlQueue.NewMySqlBackedStore) whose DB injects faults as
+// decided by injector. Use it with mysqlQueue.NewQueue to test how queue and workers behave with a flaky MySQL
+func NewStoreBackend(config queue.MySqlBackedStoreBackendConfig, injector *Injector, init bool) (queue.StoreBackend, error) {
+	s := &storeBackend{config: config, injector: injector, initOnce: &sync.Once{}}
+	if init {
+		if err := s.Init(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *storeBackend) Init() error {
+	s.initOnce.Do(func() {
+		s.config.SetupDefault()
+
+		mysqlConfig := s.config.MySQLConfig()
+		mysqlConfig.SetupDefaults()
+		cfg, err := mysqlConfig.DriverConfig()
+		if err != nil {
+			s.initErr = errors.Wrap(err, "failed to open the db")
+			return
+		}
+		c, err := mysql.NewConnector(cfg)
+		if err != nil {
+			s.initErr = errors.Wrap(err, "failed to open the db")
+			return
+		}
+
+		s.db = sql.OpenDB(WrapConnector(c, s.injector))
+		s.db.SetMaxOpenConns(s.config.MaxOpenConnection)
+		s.db.SetMaxIdleConns(s.config.MaxIdleConnection)
+		s.db.SetConnMaxLifetime(time.Duration(s.config.ConnMaxLifetimeInSec) * time.Second)
+	})
+	return s.initErr
+}
+
+func (s *storeBackend) GetSqlDb() (*sql.DB, error) {
+	if s.db == nil {
+		return nil, errors.New("store is not initialized")
+	}
+	return s.db, nil
+}
+
+func (s *storeBackend) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
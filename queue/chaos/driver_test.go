@@ -0,0 +1,82 @@
+package queueChaos
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// fakeDriver counts statements and commits - enough to check fault injection in driver wrapper
+type fakeDriver struct {
+	execCount   int
+	commitCount int
+}
+
+func (f *fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{driver: f}, nil }
+func (f *fakeDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{driver: f}, nil
+}
+func (f *fakeDriver) Driver() driver.Driver { return f }
+
+type fakeConn struct{ driver *fakeDriver }
+
+func (f *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (f *fakeConn) Close() error              { return nil }
+func (f *fakeConn) Begin() (driver.Tx, error) { return &fakeTx{driver: f.driver}, nil }
+func (f *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	f.driver.execCount++
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct{ driver *fakeDriver }
+
+func (f *fakeTx) Commit() error   { f.driver.commitCount++; return nil }
+func (f *fakeTx) Rollback() error { return nil }
+
+func TestWrapConnector(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("exec fails with mysql error", func(t *testing.T) {
+		fake := &fakeDriver{}
+		db := sql.OpenDB(WrapConnector(fake, NewInjector(1, Fault{Operation: OperationDbExec, Probability: 1, Error: ErrDeadlock})))
+		defer db.Close()
+
+		_, err := db.ExecContext(ctx, "UPDATE jobs SET state=1")
+		var e *mysql.MySQLError
+		assert.True(t, errors.As(err, &e))
+		assert.Equal(t, ErrDeadlock.Number, e.Number)
+		assert.Equal(t, 0, fake.execCount)
+	})
+
+	t.Run("commit goes through but caller gets an error", func(t *testing.T) {
+		fake := &fakeDriver{}
+		db := sql.OpenDB(WrapConnector(fake, NewInjector(1, Fault{Operation: OperationDbCommit, Probability: 1, Error: ErrBadConnection, FailAfterCall: true})))
+		defer db.Close()
+
+		tx, err := db.Begin()
+		assert.NoError(t, err)
+		_, err = tx.ExecContext(ctx, "UPDATE jobs SET state=1")
+		assert.NoError(t, err)
+		assert.Error(t, tx.Commit())
+		assert.Equal(t, 1, fake.execCount)
+		assert.Equal(t, 1, fake.commitCount)
+	})
+
+	t.Run("no fault with zero probability", func(t *testing.T) {
+		fake := &fakeDriver{}
+		db := sql.OpenDB(WrapConnector(fake, NewInjector(1, Fault{Operation: OperationAll, Probability: 0, Error: ErrDeadlock})))
+		defer db.Close()
+
+		for i := 0; i < 10; i++ {
+			_, err := db.ExecContext(ctx, "UPDATE jobs SET state=1")
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 10, fake.execCount)
+	})
+}
@@ -0,0 +1,156 @@
+package queueChaos
+
+import (
+	"context"
+	"database/sql/driver"
+	mysqlerrnum "github.com/bombsimon/mysql-error-numbers"
+	"github.com/go-sql-driver/mysql"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Operation is the operation on which a fault is injected
+type Operation string
+
+const (
+	// OperationAll matches all operations
+	OperationAll Operation = "*"
+
+	OperationSchedule                      Operation = "schedule"
+	OperationPoll                          Operation = "poll"
+	OperationFetchJobDetails               Operation = "fetch_job_details"
+	OperationMarkJobFailedAndScheduleRetry Operation = "mark_job_failed_and_schedule_retry"
+	OperationMarkJobCompleted              Operation = "mark_job_completed"
+	OperationUpdateJobData                 Operation = "update_job_data"
+	OperationPauseJobType                  Operation = "pause_job_type"
+	OperationResumeJobType                 Operation = "resume_job_type"
+	OperationFetchRetryGroup               Operation = "fetch_retry_group"
+	OperationFetchJobTypePauseStatus       Operation = "fetch_job_type_pause_status"
+	OperationFetchJobs                     Operation = "fetch_jobs"
+
+	OperationDbConnect Operation = "db_connect"
+	OperationDbBegin   Operation = "db_begin"
+	OperationDbPrepare Operation = "db_prepare"
+	OperationDbExec    Operation = "db_exec"
+	OperationDbQuery   Operation = "db_query"
+	OperationDbCommit  Operation = "db_commit"
+)
+
+// Errors which MySQL gives under load - use them as Fault.Error
+var (
+	ErrLockWaitTimeout = &mysql.MySQLError{Number: mysqlerrnum.ER_LOCK_WAIT_TIMEOUT, Message: "Lock wait timeout exceeded; try restarting transaction"}
+	ErrDeadlock        = &mysql.MySQLError{Number: mysqlerrnum.ER_LOCK_DEADLOCK, Message: "Deadlock found when trying to get lock; try restarting transaction"}
+	ErrBadConnection   = driver.ErrBadConn
+)
+
+// NewMySQLError gives a MySQL error with given error number e.g. NewMySQLError(mysqlerrnum.ER_QUERY_INTERRUPTED)
+func NewMySQLError(number uint16, message string) *mysql.MySQLError {
+	return &mysql.MySQLError{Number: number, Message: message}
+}
+
+// Fault is a single fault to inject
+type Fault struct {
+	// Operation on which this fault is injected (OperationAll for all operations)
+	Operation Operation
+
+	// Probability (0 to 1) of injecting this fault in a call
+	Probability float64
+
+	// Latency is added to the call
+	Latency time.Duration
+
+	// Error is returned from the call (optional - fault can only add latency)
+	Error error
+
+	// FailAfterCall if true, the call is done and then Error is returned i.e. a partial failure where caller sees an
+	// error but the change is done (e.g. commit went through but connection dropped before the response)
+	FailAfterCall bool
+}
+
+// Injector decides which faults to inject in a call. With the same seed and the same sequence of calls it injects
+// the same faults - calls from many goroutines make the sequence (and faults) non-deterministic
+type Injector struct {
+	m        *sync.Mutex
+	random   *rand.Rand
+	faults   []Fault
+	disabled bool
+	injected map[Operation]int
+}
+
+// NewInjector gives an injector with given seed and faults
+func NewInjector(seed int64, faults ...Fault) *Injector {
+	return &Injector{
+		m:        &sync.Mutex{},
+		random:   rand.New(rand.NewSource(seed)),
+		faults:   faults,
+		injected: map[Operation]int{},
+	}
+}
+
+// SetEnabled enables or disables fault injection e.g. disable it to clean up at the end of a test
+func (i *Injector) SetEnabled(enabled bool) {
+	i.m.Lock()
+	defer i.m.Unlock()
+	i.disabled = !enabled
+}
+
+// Injected gives the no of calls of the operation in which a fault was injected
+func (i *Injector) Injected(operation Operation) int {
+	i.m.Lock()
+	defer i.m.Unlock()
+	return i.injected[operation]
+}
+
+type decision struct {
+	latency       time.Duration
+	err           error
+	failAfterCall bool
+}
+
+func (i *Injector) decide(operation Operation) (d decision) {
+	i.m.Lock()
+	defer i.m.Unlock()
+	if i.disabled {
+		return
+	}
+
+	injected := false
+	for _, f := range i.faults {
+		if f.Operation != operation && f.Operation != OperationAll {
+			continue
+		}
+		if i.random.Float64() >= f.Probability {
+			continue
+		}
+		injected = true
+		d.latency += f.Latency
+		if d.err == nil && f.Error != nil {
+			d.err = f.Error
+			d.failAfterCall = f.FailAfterCall
+		}
+	}
+	if injected {
+		i.injected[operation]++
+	}
+	return
+}
+
+// before is called before the real call - it adds latency and gives the error to return without making the call.
+// If the returned decision has failAfterCall, caller must make the call and then return decision.err
+func (i *Injector) before(ctx context.Context, operation Operation) (decision, error) {
+	d := i.decide(operation)
+	if d.latency > 0 {
+		timer := time.NewTimer(d.latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return d, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if d.err != nil && !d.failAfterCall {
+		return d, d.err
+	}
+	return d, nil
+}
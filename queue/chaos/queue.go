@@ -0,0 +1,82 @@
+package queueChaos
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/queue"
+)
+
+// queueImpl injects faults in calls to the wrapped queue
+type queueImpl struct {
+	queue    queue.Queue
+	injector *Injector
+}
+
+// NewQueue gives a queue which injects faults (as decided by injector) in calls to the given queue
+func NewQueue(q queue.Queue, injector *Injector) queue.Queue {
+	return &queueImpl{queue: q, injector: injector}
+}
+
+func call[Req any, Res any](ctx context.Context, injector *Injector, operation Operation, fn func(context.Context, Req) (Res, error), req Req) (result Res, err error) {
+	var d decision
+	if d, err = injector.before(ctx, operation); err != nil {
+		return
+	}
+	if result, err = fn(ctx, req); err == nil && d.failAfterCall {
+		var empty Res
+		return empty, d.err
+	}
+	return
+}
+
+func (q *queueImpl) Schedule(ctx context.Context, req queue.ScheduleRequest) (*queue.ScheduleResponse, error) {
+	return call(ctx, q.injector, OperationSchedule, q.queue.Schedule, req)
+}
+
+func (q *queueImpl) Poll(ctx context.Context, req queue.PollRequest) (*queue.PollResponse, error) {
+	return call(ctx, q.injector, OperationPoll, q.queue.Poll, req)
+}
+
+func (q *queueImpl) FetchJobDetails(ctx context.Context, req queue.JobDetailsRequest) (*queue.JobDetailsResponse, error) {
+	return call(ctx, q.injector, OperationFetchJobDetails, q.queue.FetchJobDetails, req)
+}
+
+func (q *queueImpl) MarkJobFailedAndScheduleRetry(ctx context.Context, req queue.MarkJobFailedWithRetryRequest) (*queue.MarkJobFailedWithRetryResponse, error) {
+	return call(ctx, q.injector, OperationMarkJobFailedAndScheduleRetry, q.queue.MarkJobFailedAndScheduleRetry, req)
+}
+
+func (q *queueImpl) MarkJobCompleted(ctx context.Context, req queue.MarkJobCompletedRequest) (*queue.MarkJobCompletedResponse, error) {
+	return call(ctx, q.injector, OperationMarkJobCompleted, q.queue.MarkJobCompleted, req)
+}
+
+func (q *queueImpl) UpdateJobData(ctx context.Context, req queue.UpdateJobDataRequest) (*queue.UpdateJobDataResponse, error) {
+	return call(ctx, q.injector, OperationUpdateJobData, q.queue.UpdateJobData, req)
+}
+
+func (q *queueImpl) PauseJobType(ctx context.Context, req queue.PauseJobTypeRequest) (*queue.PauseJobTypeResponse, error) {
+	return call(ctx, q.injector, OperationPauseJobType, q.queue.PauseJobType, req)
+}
+
+func (q *queueImpl) ResumeJobType(ctx context.Context, req queue.ResumeJobTypeRequest) (*queue.ResumeJobTypeResponse, error) {
+	return call(ctx, q.injector, OperationResumeJobType, q.queue.ResumeJobType, req)
+}
+
+func (q *queueImpl) FetchRetryGroup(ctx context.Context, req queue.FetchRetryGroupRequest) (*queue.FetchRetryGroupResponse, error) {
+	return call(ctx, q.injector, OperationFetchRetryGroup, q.queue.FetchRetryGroup, req)
+}
+
+func (q *queueImpl) FetchJobs(ctx context.Context, req queue.FetchJobsRequest) (*queue.FetchJobsResponse, error) {
+	return call(ctx, q.injector, OperationFetchJobs, q.queue.FetchJobs, req)
+}
+
+func (q *queueImpl) FetchJobTypePauseStatus(ctx context.Context, req queue.JobTypePauseStatusRequest) (*queue.JobTypePauseStatusResponse, error) {
+	return call(ctx, q.injector, OperationFetchJobTypePauseStatus, q.queue.FetchJobTypePauseStatus, req)
+}
+
+// IdGenerator gives the id generator of the wrapped queue (nil if it does not tell it), so a wrapped shard queue can
+// still be used in a sharded queue
+func (q *queueImpl) IdGenerator() queue.IdGenerator {
+	if p, ok := q.queue.(queue.IdGeneratorProvider); ok {
+		return p.IdGenerator()
+	}
+	return nil
+}
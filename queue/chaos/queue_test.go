@@ -0,0 +1,75 @@
+package queueChaos
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/queue"
+	memoryQueue "github.com/devlibx/gox-base/queue/memory"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestInjectorIsDeterministic(t *testing.T) {
+	run := func(seed int64) []bool {
+		injector := NewInjector(seed, Fault{Operation: OperationPoll, Probability: 0.5, Error: ErrDeadlock})
+		out := make([]bool, 100)
+		for i := range out {
+			_, err := injector.before(context.Background(), OperationPoll)
+			out[i] = err != nil
+		}
+		return out
+	}
+	assert.Equal(t, run(10), run(10))
+	assert.NotEqual(t, run(10), run(11))
+}
+
+func TestQueueWithFaults(t *testing.T) {
+	ctx := context.Background()
+	memory, err := memoryQueue.NewQueue(nil)
+	assert.NoError(t, err)
+
+	t.Run("mysql error is returned", func(t *testing.T) {
+		injector := NewInjector(1, Fault{Operation: OperationSchedule, Probability: 1, Error: ErrLockWaitTimeout})
+		q := NewQueue(memory, injector)
+		_, err := q.Schedule(ctx, queue.ScheduleRequest{JobType: 1, At: time.Now()})
+		var e *mysql.MySQLError
+		assert.True(t, errors.As(err, &e))
+		assert.Equal(t, ErrLockWaitTimeout.Number, e.Number)
+		assert.Equal(t, 1, injector.Injected(OperationSchedule))
+
+		// Other operations are not affected
+		_, err = q.Poll(ctx, queue.PollRequest{JobType: 1})
+		assert.False(t, errors.As(err, &e))
+
+		// Disabled injector does not inject
+		injector.SetEnabled(false)
+		_, err = q.Schedule(ctx, queue.ScheduleRequest{JobType: 1, At: time.Now()})
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail after call is a partial failure", func(t *testing.T) {
+		q := NewQueue(memory, NewInjector(1, Fault{Operation: OperationSchedule, Probability: 1, Error: ErrBadConnection, FailAfterCall: true}))
+		_, err := q.Schedule(ctx, queue.ScheduleRequest{JobType: 2, At: time.Now()})
+		assert.ErrorIs(t, err, ErrBadConnection)
+
+		// Job was scheduled even if caller got an error
+		_, err = memory.Poll(ctx, queue.PollRequest{JobType: 2})
+		assert.NoError(t, err)
+	})
+
+	t.Run("latency is added", func(t *testing.T) {
+		q := NewQueue(memory, NewInjector(1, Fault{Operation: OperationAll, Probability: 1, Latency: 50 * time.Millisecond}))
+		start := time.Now()
+		_, err := q.FetchJobTypePauseStatus(ctx, queue.JobTypePauseStatusRequest{JobType: 1})
+		assert.NoError(t, err)
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+		// Latency is cut short if context is done
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = q.FetchJobTypePauseStatus(timeoutCtx, queue.JobTypePauseStatusRequest{JobType: 1})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,367 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/devlibx/gox-base/errors"
+	"io"
+	"strings"
+)
+
+// PropertiesCodec encodes job properties (json) before they are stored and decodes them after they are read
+type PropertiesCodec interface {
+	Encode(properties []byte) (string, error)
+	Decode(stored string) ([]byte, error)
+
+	// Rewrap gives stored properties with the data key wrapped by the current key - the properties are not decrypted.
+	// It gives false if there was nothing to do (not encrypted, or already wrapped with the current key)
+	Rewrap(stored string) (string, bool, error)
+}
+
+// Compression is the algorithm used to compress job properties
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// Compressor compresses and decompresses data. Gzip is built in, set a Compressor to use zstd e.g. one built with
+// github.com/klauspost/compress/zstd
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// PropertiesCodecConfig is the config of the properties codec built by NewPropertiesCodec
+type PropertiesCodecConfig struct {
+	// Compression used for properties bigger than CompressionThresholdBytes (default = no compression)
+	Compression Compression `json:"compression" yaml:"compression"`
+
+	// CompressionThresholdBytes - properties smaller than this are not compressed (default = 1024)
+	CompressionThresholdBytes int `json:"compression_threshold_bytes" yaml:"compression_threshold_bytes"`
+
+	// ZstdCompressor is required to read or write zstd compressed properties
+	ZstdCompressor Compressor `json:"-" yaml:"-"`
+
+	// EncryptionKeys are base64 encoded AES keys (16, 24 or 32 bytes) by key id. These keys only wrap the data key of
+	// each row - keep an old key here after rotation till all rows wrapped with it are rewrapped (see Rewrap)
+	EncryptionKeys map[string]string `json:"encryption_keys" yaml:"encryption_keys"`
+
+	// EncryptionKeyId is the id of the key used to wrap data keys of new properties (empty = no encryption)
+	EncryptionKeyId string `json:"encryption_key_id" yaml:"encryption_key_id"`
+}
+
+// encodedPropertiesPrefix marks properties written by the codec - anything else is plain json (e.g. old rows)
+const encodedPropertiesPrefix = "gxq1:"
+
+const (
+	codecCompressionNone byte = 0
+	codecCompressionGzip byte = 1
+	codecCompressionZstd byte = 2
+
+	codecEncryptionNone   byte = 0
+	codecEncryptionAesGcm byte = 1
+
+	// codecDataKeySize is the size of the AES-256 data key generated for each row, and codecDataNonceSize is the
+	// (standard GCM) nonce size used with it
+	codecDataKeySize   = 32
+	codecDataNonceSize = 12
+)
+
+type propertiesCodec struct {
+	compression               byte
+	compressionThresholdBytes int
+	zstdCompressor            Compressor
+	keys                      map[string]cipher.AEAD
+	keyId                     string
+}
+
+// NewPropertiesCodec gives a codec which compresses and/or encrypts properties as per config. Encryption is AES-GCM
+// envelope encryption - each row is encrypted with a new data key, and the data key is wrapped (AES-GCM) by the key of
+// EncryptionKeyId. Properties are stored as "gxq1:" + base64(compression, encryption, key id, wrapped data key, nonce,
+// data); stored properties without this prefix are read as plain json, so rows written before the codec was enabled
+// stay readable
+func NewPropertiesCodec(config PropertiesCodecConfig) (PropertiesCodec, error) {
+	c := &propertiesCodec{
+		compressionThresholdBytes: config.CompressionThresholdBytes,
+		zstdCompressor:            config.ZstdCompressor,
+		keys:                      map[string]cipher.AEAD{},
+		keyId:                     config.EncryptionKeyId,
+	}
+	if c.compressionThresholdBytes <= 0 {
+		c.compressionThresholdBytes = 1024
+	}
+
+	switch config.Compression {
+	case CompressionNone:
+		c.compression = codecCompressionNone
+	case CompressionGzip:
+		c.compression = codecCompressionGzip
+	case CompressionZstd:
+		if config.ZstdCompressor == nil {
+			return nil, errors.New("zstd compressor is required to use zstd compression")
+		}
+		c.compression = codecCompressionZstd
+	default:
+		return nil, errors.New("unknown properties compression: %s", config.Compression)
+	}
+
+	for id, encodedKey := range config.EncryptionKeys {
+		if id == "" || len(id) > 255 {
+			return nil, errors.New("encryption key id must be 1 to 255 chars: keyId=%s", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "encryption key is not base64 encoded: keyId=%s", id)
+		}
+		if c.keys[id], err = newAesGcm(key); err != nil {
+			return nil, errors.Wrap(err, "bad encryption key: keyId=%s", id)
+		}
+	}
+	if c.keyId != "" && c.keys[c.keyId] == nil {
+		return nil, errors.New("encryption key not found: keyId=%s", c.keyId)
+	}
+	return c, nil
+}
+
+func (c *propertiesCodec) Encode(properties []byte) (string, error) {
+	compression := codecCompressionNone
+	data := properties
+	if c.compression != codecCompressionNone && len(properties) >= c.compressionThresholdBytes {
+		var err error
+		if data, err = c.compress(c.compression, properties); err != nil {
+			return "", errors.Wrap(err, "failed to compress properties")
+		}
+		compression = c.compression
+	}
+
+	// Nothing to do - keep it as plain json
+	if compression == codecCompressionNone && c.keyId == "" {
+		return string(properties), nil
+	}
+
+	out := []byte{compression, codecEncryptionNone}
+	if c.keyId != "" {
+		var err error
+		if out, err = c.seal(compression, data); err != nil {
+			return "", errors.Wrap(err, "failed to encrypt properties")
+		}
+	} else {
+		out = append(out, data...)
+	}
+	return encodedPropertiesPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+func (c *propertiesCodec) Decode(stored string) ([]byte, error) {
+	if !strings.HasPrefix(stored, encodedPropertiesPrefix) {
+		return []byte(stored), nil
+	}
+
+	in, err := base64.StdEncoding.DecodeString(stored[len(encodedPropertiesPrefix):])
+	if err != nil {
+		return nil, errors.Wrap(err, "encoded properties are not base64")
+	} else if len(in) < 2 {
+		return nil, errors.New("encoded properties are too short")
+	}
+
+	compression, encryption := in[0], in[1]
+	data := in[2:]
+	switch encryption {
+	case codecEncryptionNone:
+	case codecEncryptionAesGcm:
+		if data, err = c.open(in); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unknown properties encryption: %d", encryption)
+	}
+
+	if compression == codecCompressionNone {
+		return data, nil
+	}
+	if data, err = c.decompress(compression, data); err != nil {
+		return nil, errors.Wrap(err, "failed to decompress properties")
+	}
+	return data, nil
+}
+
+func (c *propertiesCodec) Rewrap(stored string) (string, bool, error) {
+	if !strings.HasPrefix(stored, encodedPropertiesPrefix) {
+		return stored, false, nil
+	}
+	in, err := base64.StdEncoding.DecodeString(stored[len(encodedPropertiesPrefix):])
+	if err != nil {
+		return "", false, errors.Wrap(err, "encoded properties are not base64")
+	} else if len(in) < 2 {
+		return "", false, errors.New("encoded properties are too short")
+	} else if in[1] != codecEncryptionAesGcm {
+		return stored, false, nil
+	}
+
+	e, err := c.parseEnvelope(in)
+	if err != nil {
+		return "", false, err
+	} else if e.keyId == c.keyId {
+		return stored, false, nil
+	} else if c.keyId == "" {
+		return "", false, errors.New("encryption key id is required to rewrap properties")
+	}
+
+	dataKey, err := e.kek.Open(nil, e.wrapNonce, e.wrappedKey, e.keyHeader)
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to unwrap data key: keyId=%s", e.keyId)
+	}
+	out := []byte{in[0], in[1]}
+	if out, err = c.appendWrappedKey(out, dataKey); err != nil {
+		return "", false, err
+	}
+	out = append(append(out, e.nonce...), e.ciphertext...)
+	return encodedPropertiesPrefix + base64.StdEncoding.EncodeToString(out), true, nil
+}
+
+// seal encrypts data with a new data key, and keeps the data key wrapped by the current key in the output. The data is
+// authenticated with (compression, encryption) only, so the data key can be rewrapped without decrypting the data
+func (c *propertiesCodec) seal(compression byte, data []byte) ([]byte, error) {
+	dataKey := make([]byte, codecDataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, errors.Wrap(err, "failed to generate data key")
+	}
+	aead, err := newAesGcm(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []byte{compression, codecEncryptionAesGcm}
+	if out, err = c.appendWrappedKey(out, dataKey); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce to encrypt properties")
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, out[:2]), nil
+}
+
+// appendWrappedKey appends key id, nonce and the data key wrapped by the current key to out (compression, encryption)
+func (c *propertiesCodec) appendWrappedKey(out []byte, dataKey []byte) ([]byte, error) {
+	kek := c.keys[c.keyId]
+	out = append(append(out, byte(len(c.keyId))), c.keyId...)
+	keyHeader := append([]byte{}, out...)
+	nonce := make([]byte, kek.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce to wrap data key")
+	}
+	out = append(out, nonce...)
+	return kek.Seal(out, nonce, dataKey, keyHeader), nil
+}
+
+// open decrypts the data of an encrypted envelope
+func (c *propertiesCodec) open(in []byte) ([]byte, error) {
+	e, err := c.parseEnvelope(in)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := e.kek.Open(nil, e.wrapNonce, e.wrappedKey, e.keyHeader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unwrap data key: keyId=%s", e.keyId)
+	}
+	aead, err := newAesGcm(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := aead.Open(nil, e.nonce, e.ciphertext, in[:2])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt properties: keyId=%s", e.keyId)
+	}
+	return data, nil
+}
+
+// envelope is an encrypted properties row split in parts
+type envelope struct {
+	keyId      string
+	kek        cipher.AEAD
+	keyHeader  []byte
+	wrapNonce  []byte
+	wrappedKey []byte
+	nonce      []byte
+	ciphertext []byte
+}
+
+func (c *propertiesCodec) parseEnvelope(in []byte) (*envelope, error) {
+	if len(in) < 3 || len(in) < 3+int(in[2]) {
+		return nil, errors.New("encoded properties are too short")
+	}
+	e := &envelope{keyId: string(in[3 : 3+int(in[2])])}
+	if e.kek = c.keys[e.keyId]; e.kek == nil {
+		return nil, errors.New("encryption key not found to decrypt properties: keyId=%s", e.keyId)
+	}
+
+	p := 3 + len(e.keyId)
+	wrappedKeySize := codecDataKeySize + e.kek.Overhead()
+	if len(in) < p+e.kek.NonceSize()+wrappedKeySize {
+		return nil, errors.New("encoded properties are too short")
+	}
+	e.keyHeader = in[:p]
+	e.wrapNonce = in[p : p+e.kek.NonceSize()]
+	p += e.kek.NonceSize()
+	e.wrappedKey = in[p : p+wrappedKeySize]
+	p += wrappedKeySize
+
+	if len(in) < p+codecDataNonceSize {
+		return nil, errors.New("encoded properties are too short")
+	}
+	e.nonce = in[p : p+codecDataNonceSize]
+	e.ciphertext = in[p+codecDataNonceSize:]
+	return e, nil
+}
+
+func newAesGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "bad encryption key")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build aes-gcm")
+	}
+	return aead, nil
+}
+
+func (c *propertiesCodec) compress(compression byte, data []byte) ([]byte, error) {
+	if compression == codecCompressionZstd {
+		return c.zstdCompressor.Compress(data)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	} else if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *propertiesCodec) decompress(compression byte, data []byte) ([]byte, error) {
+	switch compression {
+	case codecCompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case codecCompressionZstd:
+		if c.zstdCompressor == nil {
+			return nil, errors.New("zstd compressor is required to read zstd compressed properties")
+		}
+		return c.zstdCompressor.Decompress(data)
+	}
+	return nil, errors.New("unknown properties compression: %d", compression)
+}
@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+var (
+	testKey1 = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	testKey2 = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 16))
+)
+
+// reverseCompressor is a fake zstd compressor for tests
+type reverseCompressor struct{}
+
+func (reverseCompressor) Compress(data []byte) ([]byte, error) {
+	return reverse(data), nil
+}
+
+func (reverseCompressor) Decompress(data []byte) ([]byte, error) {
+	return reverse(data), nil
+}
+
+func reverse(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i := range data {
+		out[len(data)-1-i] = data[i]
+	}
+	return out
+}
+
+func TestPropertiesCodec_PlainJson(t *testing.T) {
+	codec, err := NewPropertiesCodec(PropertiesCodecConfig{})
+	assert.NoError(t, err)
+
+	stored, err := codec.Encode([]byte(`{"name":"harish"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"harish"}`, stored)
+
+	data, err := codec.Decode(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"harish"}`, string(data))
+}
+
+func TestPropertiesCodec_CompressionThreshold(t *testing.T) {
+	codec, err := NewPropertiesCodec(PropertiesCodecConfig{Compression: CompressionGzip, CompressionThresholdBytes: 100})
+	assert.NoError(t, err)
+
+	small := []byte(`{"name":"harish"}`)
+	stored, err := codec.Encode(small)
+	assert.NoError(t, err)
+	assert.Equal(t, string(small), stored)
+
+	large := []byte(`{"name":"` + strings.Repeat("harish", 100) + `"}`)
+	stored, err = codec.Encode(large)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored, encodedPropertiesPrefix))
+	assert.Less(t, len(stored), len(large))
+
+	data, err := codec.Decode(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, large, data)
+}
+
+func TestPropertiesCodec_Zstd(t *testing.T) {
+	_, err := NewPropertiesCodec(PropertiesCodecConfig{Compression: CompressionZstd})
+	assert.Error(t, err)
+
+	codec, err := NewPropertiesCodec(PropertiesCodecConfig{Compression: CompressionZstd, CompressionThresholdBytes: 1, ZstdCompressor: reverseCompressor{}})
+	assert.NoError(t, err)
+	stored, err := codec.Encode([]byte(`{"name":"harish"}`))
+	assert.NoError(t, err)
+
+	data, err := codec.Decode(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"harish"}`, string(data))
+
+	// Gzip only codec can not read zstd data
+	gzipCodec, _ := NewPropertiesCodec(PropertiesCodecConfig{Compression: CompressionGzip})
+	_, err = gzipCodec.Decode(stored)
+	assert.Error(t, err)
+}
+
+func TestPropertiesCodec_EncryptionWithKeyRotation(t *testing.T) {
+	_, err := NewPropertiesCodec(PropertiesCodecConfig{EncryptionKeyId: "k1"})
+	assert.Error(t, err, "key id must be in keys")
+
+	oldCodec, err := NewPropertiesCodec(PropertiesCodecConfig{
+		Compression:               CompressionGzip,
+		CompressionThresholdBytes: 10,
+		EncryptionKeys:            map[string]string{"k1": testKey1},
+		EncryptionKeyId:           "k1",
+	})
+	assert.NoError(t, err)
+	storedWithK1, err := oldCodec.Encode([]byte(`{"phone":"9999999999"}`))
+	assert.NoError(t, err)
+	assert.NotContains(t, storedWithK1, "9999999999")
+
+	// Rotate to k2 - data written with k1 is still readable
+	newCodec, err := NewPropertiesCodec(PropertiesCodecConfig{
+		EncryptionKeys:  map[string]string{"k1": testKey1, "k2": testKey2},
+		EncryptionKeyId: "k2",
+	})
+	assert.NoError(t, err)
+	data, err := newCodec.Decode(storedWithK1)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"phone":"9999999999"}`, string(data))
+
+	storedWithK2, err := newCodec.Encode([]byte(`{"phone":"8888888888"}`))
+	assert.NoError(t, err)
+	data, err = newCodec.Decode(storedWithK2)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"phone":"8888888888"}`, string(data))
+
+	// Old rows which are plain json are still readable
+	data, err = newCodec.Decode(`{"phone":"7777777777"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"phone":"7777777777"}`, string(data))
+
+	// Codec without k2 can not read data written with k2
+	_, err = oldCodec.Decode(storedWithK2)
+	assert.Error(t, err)
+}
+
+func TestPropertiesCodec_RewrapRetiresOldKey(t *testing.T) {
+	oldCodec, err := NewPropertiesCodec(PropertiesCodecConfig{EncryptionKeys: map[string]string{"k1": testKey1}, EncryptionKeyId: "k1"})
+	assert.NoError(t, err)
+	storedWithK1, err := oldCodec.Encode([]byte(`{"phone":"9999999999"}`))
+	assert.NoError(t, err)
+
+	// Rewrap with k2 as current key - only the data key is wrapped again, data is not re-encrypted
+	newCodec, err := NewPropertiesCodec(PropertiesCodecConfig{
+		EncryptionKeys:  map[string]string{"k1": testKey1, "k2": testKey2},
+		EncryptionKeyId: "k2",
+	})
+	assert.NoError(t, err)
+	rewrapped, changed, err := newCodec.Rewrap(storedWithK1)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	before, _ := base64.StdEncoding.DecodeString(storedWithK1[len(encodedPropertiesPrefix):])
+	after, _ := base64.StdEncoding.DecodeString(rewrapped[len(encodedPropertiesPrefix):])
+	assert.Equal(t, before[len(before)-20:], after[len(after)-20:])
+
+	// k1 is not needed anymore
+	k2Only, err := NewPropertiesCodec(PropertiesCodecConfig{EncryptionKeys: map[string]string{"k2": testKey2}, EncryptionKeyId: "k2"})
+	assert.NoError(t, err)
+	data, err := k2Only.Decode(rewrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"phone":"9999999999"}`, string(data))
+	_, err = k2Only.Decode(storedWithK1)
+	assert.Error(t, err)
+
+	// Nothing to do for rows wrapped with the current key or not encrypted
+	_, changed, err = k2Only.Rewrap(rewrapped)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	plain, changed, err := k2Only.Rewrap(`{"phone":"7777777777"}`)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, `{"phone":"7777777777"}`, plain)
+}
+
+func TestPropertiesCodec_TamperedData(t *testing.T) {
+	codec, err := NewPropertiesCodec(PropertiesCodecConfig{EncryptionKeys: map[string]string{"k1": testKey1}, EncryptionKeyId: "k1"})
+	assert.NoError(t, err)
+	stored, err := codec.Encode([]byte(`{"phone":"9999999999"}`))
+	assert.NoError(t, err)
+
+	raw, _ := base64.StdEncoding.DecodeString(stored[len(encodedPropertiesPrefix):])
+	raw[len(raw)-1] ^= 0xff
+	_, err = codec.Decode(encodedPropertiesPrefix + base64.StdEncoding.EncodeToString(raw))
+	assert.Error(t, err)
+
+	// Wrapped data key is changed
+	raw, _ = base64.StdEncoding.DecodeString(stored[len(encodedPropertiesPrefix):])
+	raw[3+len("k1")+12] ^= 0xff
+	_, err = codec.Decode(encodedPropertiesPrefix + base64.StdEncoding.EncodeToString(raw))
+	assert.Error(t, err)
+
+	_, err = codec.Decode(encodedPropertiesPrefix + "not base64")
+	assert.Error(t, err)
+}
+
+func TestPropertiesCodec_BadConfig(t *testing.T) {
+	_, err := NewPropertiesCodec(PropertiesCodecConfig{Compression: "lz4"})
+	assert.Error(t, err)
+	_, err = NewPropertiesCodec(PropertiesCodecConfig{EncryptionKeys: map[string]string{"k1": "not base64"}})
+	assert.Error(t, err)
+	_, err = NewPropertiesCodec(PropertiesCodecConfig{EncryptionKeys: map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/serialization"
+	"regexp"
+	"time"
+)
+
+// Config is the full config to build a MySQL backed queue. It can be read from a yaml file with per-environment
+// values using ReadConfigFile e.g.
+//
+//	store:
+//	  host: "env:string: prod=db.prod.internal; default=localhost"
+//	  database: jobs_db
+//	table_name: jobs
+//	queue:
+//	  tenant: 1
+//	  use_prepared_statement: true
+//	retry:
+//	  max_execution: 3
+//	  delay_in_ms: 60000
+//	job_types:
+//	  - id: 1
+//	    name: send_otp
+//	    worker_count: 10
+type Config struct {
+	Store          MySqlBackedStoreBackendConfig `json:"store" yaml:"store"`
+	TableName      string                        `json:"table_name" yaml:"table_name"`
+	UdfColumnNames UdfColumnNames                `json:"udf_column_names" yaml:"udf_column_names"`
+	Queue          MySqlBackedQueueConfig        `json:"queue" yaml:"queue"`
+	Retry          RetryConfig                   `json:"retry" yaml:"retry"`
+	JobTypes       []JobTypeConfig               `json:"job_types" yaml:"job_types"`
+}
+
+// JobTypeConfig is the config of a single job type. Retry (if set) overrides the default retry policy of the queue
+type JobTypeConfig struct {
+	Id          int          `json:"id" yaml:"id"`
+	Name        string       `json:"name" yaml:"name"`
+	WorkerCount int          `json:"worker_count" yaml:"worker_count"`
+	Retry       *RetryConfig `json:"retry,omitempty" yaml:"retry"`
+}
+
+// RetryConfig is the retry policy of a job - a failed job is retried after a fixed delay till max execution
+type RetryConfig struct {
+	MaxExecution int `json:"max_execution" yaml:"max_execution"`
+	DelayInMs    int `json:"delay_in_ms" yaml:"delay_in_ms"`
+}
+
+// RetryBackoffAlgo gives the retry backoff algo for this retry policy
+func (r RetryConfig) RetryBackoffAlgo() RetryBackoffAlgo {
+	return NewDefaultRetryBackoffAlgo(time.Duration(r.DelayInMs) * time.Millisecond)
+}
+
+var sqlIdentifierRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// SetupDefault sets default values - table name "jobs" and max job type from the largest configured job type id
+func (c *Config) SetupDefault() {
+	c.Store.SetupDefault()
+	if c.TableName == "" {
+		c.TableName = "jobs"
+	}
+	for _, jt := range c.JobTypes {
+		if jt.Id > c.Queue.MaxJobType {
+			c.Queue.MaxJobType = jt.Id
+		}
+	}
+}
+
+// Validate checks the config and gives error with the first problem found
+func (c *Config) Validate() error {
+	if c.Store.Database == "" {
+		return errors.New("queue config is not valid: store.database is required")
+	} else if !sqlIdentifierRegex.MatchString(c.TableName) {
+		return errors.New("queue config is not valid: table_name must be a valid table name: table_name=%s", c.TableName)
+	} else if c.Queue.Tenant < 0 || c.Queue.Tenant > 255 {
+		return errors.New("queue config is not valid: queue.tenant must be in [0, 255]: tenant=%d", c.Queue.Tenant)
+	} else if c.Queue.MaxJobType > 255 {
+		return errors.New("queue config is not valid: queue.max_job_type must be <= 255: max_job_type=%d", c.Queue.MaxJobType)
+	}
+
+	for name, column := range map[string]string{
+		"string_udf_1": c.UdfColumnNames.StringUdf1,
+		"string_udf_2": c.UdfColumnNames.StringUdf2,
+		"int_udf_1":    c.UdfColumnNames.IntUdf1,
+		"int_udf_2":    c.UdfColumnNames.IntUdf2,
+	} {
+		if column != "" && !sqlIdentifierRegex.MatchString(column) {
+			return errors.New("queue config is not valid: udf_column_names.%s must be a valid column name: column=%s", name, column)
+		}
+	}
+
+	if err := c.Retry.validate("retry"); err != nil {
+		return err
+	}
+
+	if c.Queue.PropertiesCodec != nil {
+		if _, err := NewPropertiesCodec(*c.Queue.PropertiesCodec); err != nil {
+			return errors.Wrap(err, "queue config is not valid: queue.properties_codec")
+		}
+	}
+
+	ids := map[int]bool{}
+	names := map[string]bool{}
+	for _, jt := range c.JobTypes {
+		if jt.Id <= 0 || jt.Id > c.Queue.MaxJobType {
+			return errors.New("queue config is not valid: job type id must be in [1, max_job_type=%d]: id=%d", c.Queue.MaxJobType, jt.Id)
+		} else if ids[jt.Id] {
+			return errors.New("queue config is not valid: duplicate job type id: id=%d", jt.Id)
+		} else if jt.Name != "" && names[jt.Name] {
+			return errors.New("queue config is not valid: duplicate job type name: name=%s", jt.Name)
+		} else if jt.WorkerCount < 0 {
+			return errors.New("queue config is not valid: worker_count must not be negative: id=%d, worker_count=%d", jt.Id, jt.WorkerCount)
+		}
+		if jt.Retry != nil {
+			if err := jt.Retry.validate("job_types.retry"); err != nil {
+				return err
+			}
+		}
+		ids[jt.Id] = true
+		names[jt.Name] = true
+	}
+	return nil
+}
+
+func (r RetryConfig) validate(path string) error {
+	if r.MaxExecution < 0 {
+		return errors.New("queue config is not valid: %s.max_execution must not be negative: max_execution=%d", path, r.MaxExecution)
+	} else if r.DelayInMs < 0 {
+		return errors.New("queue config is not valid: %s.delay_in_ms must not be negative: delay_in_ms=%d", path, r.DelayInMs)
+	}
+	return nil
+}
+
+// JobType gives the config of a job type by its id
+func (c *Config) JobType(id int) (JobTypeConfig, bool) {
+	for _, jt := range c.JobTypes {
+		if jt.Id == id {
+			return jt, true
+		}
+	}
+	return JobTypeConfig{}, false
+}
+
+// RetryConfigForJobType gives the retry policy of the job type - job type retry if set, otherwise the queue default
+func (c *Config) RetryConfigForJobType(id int) RetryConfig {
+	if jt, ok := c.JobType(id); ok && jt.Retry != nil {
+		return *jt.Retry
+	}
+	return c.Retry
+}
+
+// ReadConfigFile reads queue config from a yaml file. Values can be parameterized per environment
+// e.g. "env:int: prod=100; default=10" (see serialization.ReadParameterizedYamlFile)
+func ReadConfigFile(file string, env string) (*Config, error) {
+	cfg := &Config{}
+	if err := serialization.ReadParameterizedYamlFile(file, cfg, env); err != nil {
+		return nil, errors.Wrap(err, "failed to read queue config: file=%s, env=%s", file, env)
+	}
+	return cfg, nil
+}
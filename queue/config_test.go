@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testQueueConfigYaml = `
+store:
+  host: "env:string: prod=db.prod.internal; default=localhost"
+  database: jobs_db
+  max_open_connection: "env:int: prod=100; default=10"
+table_name: otp_jobs
+udf_column_names:
+  string_udf_1: phone
+queue:
+  tenant: 2
+  use_prepared_statement: true
+  dont_run_poller: "env:bool: prod=false; default=true"
+retry:
+  max_execution: 3
+  delay_in_ms: 1000
+job_types:
+  - id: 1
+    name: send_otp
+    worker_count: "env:int: prod=20; default=2"
+  - id: 3
+    name: verify_otp
+    retry:
+      max_execution: 5
+      delay_in_ms: 10
+`
+
+func TestReadConfigFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(testQueueConfigYaml), 0644))
+
+	prod, err := ReadConfigFile(file, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "db.prod.internal", prod.Store.Host)
+	assert.Equal(t, 100, prod.Store.MaxOpenConnection)
+	assert.False(t, prod.Queue.DontRunPoller)
+	assert.Equal(t, 20, prod.JobTypes[0].WorkerCount)
+
+	dev, err := ReadConfigFile(file, "dev")
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost", dev.Store.Host)
+	assert.True(t, dev.Queue.DontRunPoller)
+	assert.Equal(t, 2, dev.JobTypes[0].WorkerCount)
+	assert.Equal(t, "otp_jobs", dev.TableName)
+	assert.Equal(t, "phone", dev.UdfColumnNames.StringUdf1)
+	assert.True(t, dev.Queue.UsePreparedStatement)
+
+	dev.SetupDefault()
+	assert.NoError(t, dev.Validate())
+	assert.Equal(t, 3, dev.Queue.MaxJobType)
+	assert.Equal(t, RetryConfig{MaxExecution: 3, DelayInMs: 1000}, dev.RetryConfigForJobType(1))
+	assert.Equal(t, RetryConfig{MaxExecution: 5, DelayInMs: 10}, dev.RetryConfigForJobType(3))
+
+	_, err = ReadConfigFile(filepath.Join(t.TempDir(), "missing.yaml"), "dev")
+	assert.Error(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := func() Config {
+		c := Config{Store: MySqlBackedStoreBackendConfig{Database: "jobs_db"}, JobTypes: []JobTypeConfig{{Id: 1, Name: "a"}}}
+		c.SetupDefault()
+		return c
+	}
+	c := valid()
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, "jobs", c.TableName)
+
+	for name, update := range map[string]func(c *Config){
+		"missing database":    func(c *Config) { c.Store.Database = "" },
+		"bad table name":      func(c *Config) { c.TableName = "jobs; drop table x" },
+		"bad udf column name": func(c *Config) { c.UdfColumnNames.IntUdf1 = "a b" },
+		"bad tenant":          func(c *Config) { c.Queue.Tenant = 300 },
+		"negative retry":      func(c *Config) { c.Retry.DelayInMs = -1 },
+		"duplicate job type":  func(c *Config) { c.JobTypes = append(c.JobTypes, JobTypeConfig{Id: 1, Name: "b"}) },
+		"job type over max":   func(c *Config) { c.JobTypes = append(c.JobTypes, JobTypeConfig{Id: 2, Name: "b"}) },
+		"negative workers":    func(c *Config) { c.JobTypes[0].WorkerCount = -1 },
+		"missing encryption key": func(c *Config) {
+			c.Queue.PropertiesCodec = &PropertiesCodecConfig{EncryptionKeyId: "k1"}
+		},
+	} {
+		c := valid()
+		update(&c)
+		assert.Error(t, c.Validate(), name)
+	}
+}
+
+func TestUdfAndTableNameQueryRewriter(t *testing.T) {
+	r := NewUdfAndTableNameQueryRewriterWithUdfColumnNames("otp_jobs", UdfColumnNames{StringUdf1: "phone", IntUdf2: "attempt"})
+	assert.Equal(t, "SELECT id FROM otp_jobs", r.RewriteQuery("jobs", "SELECT id FROM jobs"))
+	assert.Equal(t,
+		"SELECT phone, string_udf_2, int_udf_1, attempt FROM otp_jobs_data",
+		r.RewriteQuery("jobs_data", "SELECT string_udf_1, string_udf_2, int_udf_1, int_udf_2 FROM jobs_data"),
+	)
+
+	// Only table names are renamed - not columns or literals which have "jobs" in them
+	assert.Equal(t,
+		"SELECT d.id FROM otp_jobs_data d INNER JOIN otp_jobs j ON j.id=d.id WHERE j.jobs_count>0 AND d.reason='jobs'",
+		r.RewriteQuery("jobs", "SELECT d.id FROM jobs_data d INNER JOIN jobs j ON j.id=d.id WHERE j.jobs_count>0 AND d.reason='jobs'"),
+	)
+	assert.Equal(t,
+		"INSERT INTO otp_jobs_pause_audit (tenant) VALUES (?)",
+		r.RewriteQuery("jobs", "INSERT INTO jobs_pause_audit (tenant) VALUES (?)"),
+	)
+}
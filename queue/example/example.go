@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"github.com/devlibx/gox-base"
 	queue "github.com/devlibx/gox-base/queue"
-	"github.com/devlibx/gox-base/queue/example/perf"
 	mysqlQueue "github.com/devlibx/gox-base/queue/mysql"
 	"github.com/rcrowley/go-metrics"
 	"go.uber.org/zap"
@@ -26,11 +25,6 @@ var globalJobType = 1
 // r := NewRegistry()
 
 func main() {
-	if true {
-		perf.PerfMain()
-		return
-	}
-
 	//	argsWithProg := os.Args
 	argsWithoutProg := os.Args[1:]
 
@@ -55,7 +49,11 @@ func main() {
 
 	go metrics.Log(metrics.DefaultRegistry, 1*time.Minute, log.New(os.Stderr, "metrics: ", log.Lmicroseconds))
 
-	storeBackend, err := mysqlQueue.NewMySqlBackedStore(queue.MySqlBackedStoreBackendConfig{
+	zapConfig := zap.NewDevelopmentConfig()
+	zapConfig.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+	crossFunction := gox.NewCrossFunction(zapConfig.Build())
+
+	storeBackend, err := mysqlQueue.NewMySqlBackedStoreWithCrossFunction(crossFunction, queue.MySqlBackedStoreBackendConfig{
 		Host:                 os.Getenv("DB_URL"),
 		Port:                 3306,
 		User:                 os.Getenv("DB_USER"),
@@ -81,10 +79,6 @@ func main() {
 		panic(err)
 	}
 
-	zapConfig := zap.NewDevelopmentConfig()
-	zapConfig.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-	crossFunction := gox.NewCrossFunction(zapConfig.Build())
-
 	dontRunPoller := argsWithoutProg[0] == "w"
 
 	appQueue, err := mysqlQueue.NewQueue(
@@ -0,0 +1,240 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/google/uuid"
+	"io"
+	"time"
+)
+
+// ExportFormat and ExportFormatVersion are written in the header (first line) of an export. Import reads exports of
+// this and older versions - a new version must keep reading the older ones
+const (
+	ExportFormat        = "gox-queue-jobs"
+	ExportFormatVersion = 1
+)
+
+// ExportHeader is the first line of an export
+type ExportHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// ExportedJob is a job (with its data) in an export - one json per line after the header
+type ExportedJob struct {
+	Id                 string                 `json:"id"`
+	Tenant             int                    `json:"tenant"`
+	JobType            int                    `json:"job_type"`
+	State              int                    `json:"state"`
+	SubState           int                    `json:"sub_state"`
+	CorrelationId      string                 `json:"correlation_id,omitempty"`
+	RetryGroup         string                 `json:"retry_group,omitempty"`
+	ProcessAt          time.Time              `json:"process_at"`
+	ExpireAt           *time.Time             `json:"expire_at,omitempty"`
+	RemainingExecution int                    `json:"remaining_execution"`
+	StringUdf1         string                 `json:"string_udf_1,omitempty"`
+	StringUdf2         string                 `json:"string_udf_2,omitempty"`
+	IntUdf1            int                    `json:"int_udf_1,omitempty"`
+	IntUdf2            int                    `json:"int_udf_2,omitempty"`
+	Properties         map[string]interface{} `json:"properties,omitempty"`
+}
+
+// ExportFilter selects jobs to export - empty JobTypes/States match all job types/states
+type ExportFilter struct {
+	Tenant   int
+	JobTypes []int
+	States   []int
+
+	// ProcessAtFrom (inclusive) and ProcessAtTo (exclusive) bound the process time of jobs - zero means no bound
+	ProcessAtFrom time.Time
+	ProcessAtTo   time.Time
+
+	// PageSize is the no of jobs read from queue in one call (default = 100)
+	PageSize int
+}
+
+// ImportOptions controls how jobs are re-created by Import
+type ImportOptions struct {
+	// PreserveIds re-creates jobs (and retry groups) with the ids in the export. Import fails if a job with the same id
+	// exists. Ids have the process time, so PreserveIds can not be used with RebaseTo.
+	// Without it, jobs of a retry group in the export are re-created in one new retry group (see RetryGroupMapping)
+	PreserveIds bool
+
+	// RebaseTo if set, moves process time (and expire at) of each job by (RebaseTo - export time) i.e. a job which
+	// was due 5 min after export is due 5 min after RebaseTo
+	RebaseTo time.Time
+
+	// Tenant if set, jobs are re-created in this tenant instead of the tenant in the export
+	Tenant *int
+}
+
+// ImportResponse is the result of Import
+type ImportResponse struct {
+	Imported int
+
+	// IdMapping is the id in export to the id of the re-created job
+	IdMapping map[string]string
+
+	// RetryGroupMapping is the retry group in export to the retry group of the re-created jobs
+	RetryGroupMapping map[string]string
+}
+
+// Export writes jobs matching the filter (with their data) as json lines - a header line followed by one line per job
+// in the order of id. It gives the no of exported jobs
+func Export(ctx context.Context, q Queue, filter ExportFilter, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(ExportHeader{Format: ExportFormat, Version: ExportFormatVersion, ExportedAt: time.Now()}); err != nil {
+		return 0, errors.Wrap(err, "failed to write export header")
+	}
+
+	count := 0
+	req := FetchJobsRequest{
+		Tenant:        filter.Tenant,
+		JobTypes:      filter.JobTypes,
+		States:        filter.States,
+		ProcessAtFrom: filter.ProcessAtFrom,
+		ProcessAtTo:   filter.ProcessAtTo,
+		Limit:         filter.PageSize,
+	}
+	for {
+		result, err := q.FetchJobs(ctx, req)
+		if err != nil {
+			return count, errors.Wrap(err, "failed to fetch jobs to export: afterId=%s", req.AfterId)
+		}
+		for _, jd := range result.Jobs {
+			if err = encoder.Encode(toExportedJob(jd)); err != nil {
+				return count, errors.Wrap(err, "failed to write exported job: id=%s", jd.Id)
+			}
+			count++
+		}
+		if result.NextAfterId == "" {
+			return count, nil
+		}
+		req.AfterId = result.NextAfterId
+	}
+}
+
+func toExportedJob(jd *JobDetailsResponse) *ExportedJob {
+	job := &ExportedJob{
+		Id:                 jd.Id,
+		Tenant:             jd.Tenant,
+		JobType:            jd.JobType,
+		State:              jd.State,
+		SubState:           jd.SubState,
+		CorrelationId:      jd.CorrelationId,
+		RetryGroup:         jd.RetryGroup,
+		ProcessAt:          jd.At,
+		RemainingExecution: jd.RemainingExecution,
+		StringUdf1:         jd.StringUdf1,
+		StringUdf2:         jd.StringUdf2,
+		IntUdf1:            jd.IntUdf1,
+		IntUdf2:            jd.IntUdf2,
+		Properties:         jd.Properties,
+	}
+	if !jd.ExpireAt.IsZero() {
+		expireAt := jd.ExpireAt
+		job.ExpireAt = &expireAt
+	}
+	return job
+}
+
+// Import re-creates jobs from an export (written by Export) as scheduled jobs - state in the export is not restored,
+// use ExportFilter.States to pick the jobs to move or replay. Jobs imported before an error are not rolled back
+func Import(ctx context.Context, q Queue, r io.Reader, options ImportOptions) (*ImportResponse, error) {
+	if options.PreserveIds && !options.RebaseTo.IsZero() {
+		return nil, errors.New("ids can not be preserved when process times are rebased - id has the process time")
+	}
+
+	reader := bufio.NewReader(r)
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read export header")
+	}
+	header := ExportHeader{}
+	if err = json.Unmarshal(line, &header); err != nil {
+		return nil, errors.Wrap(err, "failed to read export header")
+	} else if header.Format != ExportFormat {
+		return nil, errors.New("not a job export: format=%s", header.Format)
+	} else if header.Version <= 0 || header.Version > ExportFormatVersion {
+		return nil, errors.New("export version %d is not supported (max supported version is %d)", header.Version, ExportFormatVersion)
+	}
+
+	var shift time.Duration
+	if !options.RebaseTo.IsZero() {
+		shift = options.RebaseTo.Sub(header.ExportedAt)
+	}
+
+	result := &ImportResponse{IdMapping: map[string]string{}, RetryGroupMapping: map[string]string{}}
+	for lineNo := 2; ; lineNo++ {
+		if line, err = readLine(reader); err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return result, errors.Wrap(err, "failed to read export: line=%d", lineNo)
+		} else if len(line) == 0 {
+			continue
+		}
+
+		job := ExportedJob{}
+		if err = json.Unmarshal(line, &job); err != nil {
+			return result, errors.Wrap(err, "failed to read exported job: line=%d", lineNo)
+		}
+
+		req := ScheduleRequest{
+			At:                 job.ProcessAt.Add(shift),
+			JobType:            job.JobType,
+			Tenant:             job.Tenant,
+			CorrelationId:      job.CorrelationId,
+			RemainingExecution: job.RemainingExecution,
+			StringUdf1:         job.StringUdf1,
+			StringUdf2:         job.StringUdf2,
+			IntUdf1:            job.IntUdf1,
+			IntUdf2:            job.IntUdf2,
+			Properties:         job.Properties,
+		}
+		if job.ExpireAt != nil {
+			req.ExpireAt = job.ExpireAt.Add(shift)
+		}
+		if options.Tenant != nil {
+			req.Tenant = *options.Tenant
+		}
+		if options.PreserveIds {
+			req.InternalId = job.Id
+			req.InternalRetryGroupId = job.RetryGroup
+		} else if job.RetryGroup != "" {
+			// Export is in the order of id, so the first job of a retry group picks the new retry group for the rest
+			if _, ok := result.RetryGroupMapping[job.RetryGroup]; !ok {
+				result.RetryGroupMapping[job.RetryGroup] = uuid.NewString()
+			}
+			req.InternalRetryGroupId = result.RetryGroupMapping[job.RetryGroup]
+		}
+
+		var scheduled *ScheduleResponse
+		if scheduled, err = q.Schedule(ctx, req); err != nil {
+			return result, errors.Wrap(err, "failed to import job: id=%s, line=%d", job.Id, lineNo)
+		}
+		result.IdMapping[job.Id] = scheduled.Id
+		if options.PreserveIds && job.RetryGroup != "" {
+			result.RetryGroupMapping[job.RetryGroup] = job.RetryGroup
+		}
+		result.Imported++
+	}
+}
+
+// readLine reads a full line (without new line) - lines can be longer than bufio.Scanner max token size
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
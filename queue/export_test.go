@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImport_BadInput(t *testing.T) {
+	ctx := context.Background()
+	for name, input := range map[string]string{
+		"empty":          "",
+		"not json":       "hello\n",
+		"not an export":  `{"format":"something-else","version":1}` + "\n",
+		"future version": `{"format":"gox-queue-jobs","version":2}` + "\n",
+		"bad job":        `{"format":"gox-queue-jobs","version":1}` + "\n" + "{bad json\n",
+	} {
+		_, err := Import(ctx, &shardStubQueue{}, strings.NewReader(input), ImportOptions{})
+		assert.Error(t, err, name)
+	}
+
+	_, err := Import(ctx, &shardStubQueue{}, strings.NewReader(`{"format":"gox-queue-jobs","version":1}`), ImportOptions{PreserveIds: true, RebaseTo: time.Now()})
+	assert.Error(t, err)
+
+	result, err := Import(ctx, &shardStubQueue{}, strings.NewReader(`{"format":"gox-queue-jobs","version":1}`+"\n"), ImportOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Imported)
+}
+
+// scheduleRecordingQueue keeps schedule requests
+type scheduleRecordingQueue struct {
+	shardStubQueue
+	requests []ScheduleRequest
+}
+
+func (s *scheduleRecordingQueue) Schedule(ctx context.Context, req ScheduleRequest) (*ScheduleResponse, error) {
+	s.requests = append(s.requests, req)
+	return s.shardStubQueue.Schedule(ctx, req)
+}
+
+func TestImport_RetryGroupIsKeptWithNewIds(t *testing.T) {
+	g, _ := NewTimeBasedIdGenerator()
+	q := &scheduleRecordingQueue{shardStubQueue: shardStubQueue{idGenerator: g}}
+	input := `{"format":"gox-queue-jobs","version":1}
+{"id":"1","retry_group":"g1"}
+{"id":"2","retry_group":"g2"}
+{"id":"3","retry_group":"g1"}
+{"id":"4"}
+`
+	result, err := Import(context.Background(), q, strings.NewReader(input), ImportOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.Imported)
+	if assert.Len(t, q.requests, 4) {
+		// Jobs of a retry group in export are in one new retry group
+		assert.NotEmpty(t, q.requests[0].InternalRetryGroupId)
+		assert.NotEqual(t, "g1", q.requests[0].InternalRetryGroupId)
+		assert.Equal(t, q.requests[0].InternalRetryGroupId, q.requests[2].InternalRetryGroupId)
+		assert.NotEqual(t, q.requests[0].InternalRetryGroupId, q.requests[1].InternalRetryGroupId)
+		assert.Empty(t, q.requests[3].InternalRetryGroupId)
+		assert.Equal(t, map[string]string{"g1": q.requests[0].InternalRetryGroupId, "g2": q.requests[1].InternalRetryGroupId}, result.RetryGroupMapping)
+	}
+}
+
+func TestValidateInternalId(t *testing.T) {
+	g, _ := NewTimeBasedIdGenerator()
+	processAt := time.Now().Truncate(time.Second)
+	id := g.GenerateId(processAt)
+	assert.NoError(t, ValidateInternalId(id, processAt))
+	assert.NoError(t, ValidateInternalId(id, processAt.Add(500*time.Millisecond)))
+	assert.Error(t, ValidateInternalId(id, processAt.Add(time.Second)))
+	assert.Error(t, ValidateInternalId("not-a-ulid", processAt))
+}
@@ -13,6 +13,34 @@ type IdGenerator interface {
 	GenerateId(input interface{}) string
 }
 
+// IdGeneratorE is an IdGenerator which gives an error (instead of a panic in GenerateId) when it can not generate an
+// id e.g. input is not time.Time or a snowflake node ran out of sequence. All generators in this package implement it
+type IdGeneratorE interface {
+	IdGenerator
+	GenerateIdE(input interface{}) (string, error)
+}
+
+// GenerateIdE gives an id from the generator - it uses GenerateIdE if generator implements IdGeneratorE, so queues
+// return an error to the caller instead of crashing the process
+func GenerateIdE(generator IdGenerator, input interface{}) (string, error) {
+	if g, ok := generator.(IdGeneratorE); ok {
+		return g.GenerateIdE(input)
+	}
+	return generator.GenerateId(input), nil
+}
+
+// mustGenerateId panics if id can not be generated - it keeps GenerateId of generators backward compatible
+func mustGenerateId(id string, err error) string {
+	if err != nil {
+		panic(err.Error())
+	}
+	return id
+}
+
+// RandomUuidIdGenerator generates random uuids.
+//
+// Deprecated: a uuid can not be parsed back to time, so MySQL queue can not find the partition of a job with such id.
+// Use TimeBasedIdGenerator, MonotonicIdGenerator, LockFreeIdGenerator or SnowflakeIdGenerator
 type RandomUuidIdGenerator struct {
 }
 
@@ -20,30 +48,39 @@ func (r RandomUuidIdGenerator) GenerateId(input interface{}) string {
 	return uuid.NewString()
 }
 
+func (r RandomUuidIdGenerator) GenerateIdE(input interface{}) (string, error) {
+	return uuid.NewString(), nil
+}
+
 func NewRandomUuidIdGenerator() (IdGenerator, error) {
 	return &RandomUuidIdGenerator{}, nil
 }
 
+// TimeBasedIdGenerator generates ULID ids with the given time. Ids with the same millisecond are in random order.
+//
+// NOTE - GenerateId panics (GenerateIdE gives an error) if input is not time.Time or it can not generate an id - an id
+// which can not be parsed back to time breaks partition lookup of the job
 type TimeBasedIdGenerator struct {
 	entropy *rand.Rand
 	m       *sync.Mutex
 }
 
 func (t *TimeBasedIdGenerator) GenerateId(input interface{}) string {
-	if inTime, ok := input.(time.Time); ok {
-		t.m.Lock()
-		defer t.m.Unlock()
-		ms := ulid.Timestamp(inTime)
-		if r, err := ulid.New(ms, t.entropy); err == nil {
-			return r.String()
-		} else {
-			fmt.Println("[WARN] failed to generate ulid from TimeBasedIdGenerator", err)
-			return uuid.NewString()
-		}
-	} else {
-		fmt.Println("[WARN] failed to generate ulid from TimeBasedIdGenerator because input is not time.Time. input=", input)
-		return uuid.NewString()
+	return mustGenerateId(t.GenerateIdE(input))
+}
+
+func (t *TimeBasedIdGenerator) GenerateIdE(input interface{}) (string, error) {
+	inTime, err := timeForId("TimeBasedIdGenerator", input)
+	if err != nil {
+		return "", err
 	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	r, err := ulid.New(ulid.Timestamp(inTime), t.entropy)
+	if err != nil {
+		return "", fmt.Errorf("TimeBasedIdGenerator failed to generate ulid: err=%w", err)
+	}
+	return r.String(), nil
 }
 
 func NewTimeBasedIdGenerator() (IdGenerator, error) {
@@ -54,7 +91,70 @@ func NewTimeBasedIdGenerator() (IdGenerator, error) {
 	return t, nil
 }
 
+// timeForId gives the time to generate id from - it gives an error if input is not time.Time
+func timeForId(generator string, input interface{}) (time.Time, error) {
+	inTime, ok := input.(time.Time)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s needs time.Time to generate id: input=%v", generator, input)
+	}
+	return inTime, nil
+}
+
 // RetryBackoffAlgo will help to schedule next retry
 type RetryBackoffAlgo interface {
 	NextRetryAfter(attempt int, maxExecution int) (time.Duration, error)
 }
+
+// MaxShards is the max no of shards supported by ShardIdGenerator (shard is kept in one byte of the id)
+const MaxShards = 256
+
+// ShardIdGenerator generates ULID based ids (same as TimeBasedIdGenerator) which also keep the shard index in the
+// first byte of ULID entropy. The id is still a valid ULID, so RecordIdToTime and partition lookup work as usual.
+//
+// NOTE - GenerateId panics (GenerateIdE gives an error) if it can not generate an id, a random uuid can not be routed
+// back to its shard
+type ShardIdGenerator struct {
+	shard   byte
+	entropy *rand.Rand
+	m       *sync.Mutex
+}
+
+func (s *ShardIdGenerator) GenerateId(input interface{}) string {
+	return mustGenerateId(s.GenerateIdE(input))
+}
+
+func (s *ShardIdGenerator) GenerateIdE(input interface{}) (string, error) {
+	inTime, err := timeForId("ShardIdGenerator", input)
+	if err != nil {
+		return "", err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	id, err := ulid.New(ulid.Timestamp(inTime), s.entropy)
+	if err != nil {
+		return "", fmt.Errorf("ShardIdGenerator failed to generate ulid: err=%w", err)
+	}
+	id[6] = s.shard
+	return id.String(), nil
+}
+
+// NewShardIdGenerator gives id generator for given shard - shard must be in [0, MaxShards)
+func NewShardIdGenerator(shard int) (IdGenerator, error) {
+	if shard < 0 || shard >= MaxShards {
+		return nil, fmt.Errorf("shard must be in [0, %d): shard=%d", MaxShards, shard)
+	}
+	return &ShardIdGenerator{
+		shard:   byte(shard),
+		entropy: rand.New(rand.NewSource(time.Now().UnixNano())),
+		m:       &sync.Mutex{},
+	}, nil
+}
+
+// ShardFromId gives the shard index of an id generated by ShardIdGenerator
+func ShardFromId(id string) (int, error) {
+	i, err := ulid.Parse(id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get shard from id (id is not a ulid): id=%s, err=%w", id, err)
+	}
+	return int(i[6]), nil
+}
@@ -0,0 +1,233 @@
+package queue
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/oklog/ulid/v2"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MonotonicIdGenerator generates ULID ids (same as TimeBasedIdGenerator) which keep the order of consecutive calls
+// with the same millisecond e.g. jobs scheduled for the same second are polled in the order they were scheduled.
+// GenerateId panics (GenerateIdE gives an error) if it can not generate an id
+type MonotonicIdGenerator struct {
+	entropy *ulid.MonotonicEntropy
+	m       *sync.Mutex
+}
+
+func (g *MonotonicIdGenerator) GenerateId(input interface{}) string {
+	return mustGenerateId(g.GenerateIdE(input))
+}
+
+func (g *MonotonicIdGenerator) GenerateIdE(input interface{}) (string, error) {
+	inTime, err := timeForId("MonotonicIdGenerator", input)
+	if err != nil {
+		return "", err
+	}
+	g.m.Lock()
+	defer g.m.Unlock()
+	id, err := ulid.New(ulid.Timestamp(inTime), g.entropy)
+	if err != nil {
+		return "", fmt.Errorf("MonotonicIdGenerator failed to generate ulid: err=%w", err)
+	}
+	return id.String(), nil
+}
+
+// NewMonotonicIdGenerator gives a monotonic ULID id generator
+func NewMonotonicIdGenerator() (IdGenerator, error) {
+	return &MonotonicIdGenerator{
+		entropy: ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0),
+		m:       &sync.Mutex{},
+	}, nil
+}
+
+// idStripe is a shard of LockFreeIdGenerator - padded so that stripes are not in the same cache line
+type idStripe struct {
+	prefix  uint16
+	counter uint64
+	_       [48]byte
+}
+
+// LockFreeIdGenerator generates ULID ids without a lock. Entropy of an id is a random 16-bit stripe prefix followed by
+// an atomic counter of the stripe, and calls are spread over stripes - so many goroutines do not fight for one mutex.
+// Ids from one stripe are in the order of calls, ids from different stripes with the same millisecond are not.
+// GenerateId panics (GenerateIdE gives an error) if input is not time.Time
+type LockFreeIdGenerator struct {
+	stripes []idStripe
+	next    uint32
+}
+
+func (g *LockFreeIdGenerator) GenerateId(input interface{}) string {
+	return mustGenerateId(g.GenerateIdE(input))
+}
+
+func (g *LockFreeIdGenerator) GenerateIdE(input interface{}) (string, error) {
+	inTime, err := timeForId("LockFreeIdGenerator", input)
+	if err != nil {
+		return "", err
+	}
+	stripe := &g.stripes[atomic.AddUint32(&g.next, 1)%uint32(len(g.stripes))]
+
+	var id ulid.ULID
+	if err = id.SetTime(ulid.Timestamp(inTime)); err != nil {
+		return "", fmt.Errorf("LockFreeIdGenerator failed to generate ulid: err=%w", err)
+	}
+	binary.BigEndian.PutUint16(id[6:8], stripe.prefix)
+	binary.BigEndian.PutUint64(id[8:], atomic.AddUint64(&stripe.counter, 1))
+	return id.String(), nil
+}
+
+// NewLockFreeIdGenerator gives a lock free ULID id generator with given no of stripes (default = GOMAXPROCS)
+func NewLockFreeIdGenerator(stripes int) (IdGenerator, error) {
+	if stripes <= 0 {
+		stripes = runtime.GOMAXPROCS(0)
+	}
+	if stripes > 1<<16 {
+		return nil, fmt.Errorf("stripes must be <= %d: stripes=%d", 1<<16, stripes)
+	}
+
+	// Random prefix and counter start - so two generators (or processes) do not give the same ids
+	seed := make([]byte, 2+8*stripes)
+	if _, err := crand.Read(seed); err != nil {
+		return nil, fmt.Errorf("failed to seed lock free id generator: %w", err)
+	}
+	g := &LockFreeIdGenerator{stripes: make([]idStripe, stripes)}
+	base := binary.BigEndian.Uint16(seed)
+	for i := range g.stripes {
+		g.stripes[i].prefix = base + uint16(i)
+		g.stripes[i].counter = binary.BigEndian.Uint64(seed[2+8*i:])
+	}
+	return g, nil
+}
+
+// Snowflake id layout: 41 bits of milliseconds since SnowflakeEpoch, 10 bits of node id and 12 bits of sequence
+const (
+	SnowflakeMaxNodeId   = 1<<10 - 1
+	snowflakeSequenceMax = 1<<12 - 1
+	snowflakeTimeMax     = 1<<41 - 1
+	snowflakeIdLength    = 19
+
+	// snowflakeSequenceRetention is how long sequences of past milliseconds are kept
+	snowflakeSequenceRetention = time.Hour
+)
+
+// SnowflakeEpoch is the start time of snowflake ids - ids can be generated till 69 years after it
+var SnowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ErrSnowflakeSequenceExhausted is given when a node already gave 4096 ids for the millisecond - use more nodes
+var ErrSnowflakeSequenceExhausted = errors.New("SnowflakeIdGenerator ran out of sequence - use more nodes")
+
+// SnowflakeIdGenerator generates 64-bit snowflake ids (time, node id, sequence) as 19 digit zero padded strings, so
+// that string order is time order. Use a different node id in each process which schedules jobs.
+//
+// A node gives 4096 ids per millisecond. Queue truncates process time to second, so a node can schedule 4096 jobs for
+// the same second - after that GenerateIdE gives ErrSnowflakeSequenceExhausted and schedule fails with it (use more
+// nodes), GenerateId panics. It is also an error if input is not time.Time or is out of the range of snowflake time. Sequences of a millisecond more than 1 hour in the past are dropped, so an id generated
+// for such a time can repeat - insert of the job then fails with duplicate key, it is not silently lost
+type SnowflakeIdGenerator struct {
+	node      int64
+	m         *sync.Mutex
+	sequences map[int64]int64
+	lastPrune time.Time
+}
+
+func (g *SnowflakeIdGenerator) GenerateId(input interface{}) string {
+	return mustGenerateId(g.GenerateIdE(input))
+}
+
+func (g *SnowflakeIdGenerator) GenerateIdE(input interface{}) (string, error) {
+	inTime, err := timeForId("SnowflakeIdGenerator", input)
+	if err != nil {
+		return "", err
+	}
+	ms := inTime.UnixMilli() - SnowflakeEpoch.UnixMilli()
+	if ms < 0 || ms > snowflakeTimeMax {
+		return "", fmt.Errorf("SnowflakeIdGenerator can not generate id for time out of range: time=%s", inTime)
+	}
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.prune()
+	sequence, ok := g.sequences[ms]
+	if ok {
+		sequence++
+	}
+	if sequence > snowflakeSequenceMax {
+		return "", fmt.Errorf("%w: time=%s node=%d", ErrSnowflakeSequenceExhausted, inTime, g.node)
+	}
+	g.sequences[ms] = sequence
+
+	return fmt.Sprintf("%019d", ms<<22|g.node<<12|sequence), nil
+}
+
+// prune drops sequences of old milliseconds (at most once a minute) so memory does not grow with uptime
+func (g *SnowflakeIdGenerator) prune() {
+	now := time.Now()
+	if now.Sub(g.lastPrune) < time.Minute {
+		return
+	}
+	g.lastPrune = now
+	oldest := now.Add(-snowflakeSequenceRetention).UnixMilli() - SnowflakeEpoch.UnixMilli()
+	for ms := range g.sequences {
+		if ms < oldest {
+			delete(g.sequences, ms)
+		}
+	}
+}
+
+// NewSnowflakeIdGenerator gives a snowflake id generator for the node - node must be in [0, SnowflakeMaxNodeId]
+func NewSnowflakeIdGenerator(node int) (IdGenerator, error) {
+	if node < 0 || node > SnowflakeMaxNodeId {
+		return nil, fmt.Errorf("node must be in [0, %d]: node=%d", SnowflakeMaxNodeId, node)
+	}
+	return &SnowflakeIdGenerator{
+		node:      int64(node),
+		m:         &sync.Mutex{},
+		sequences: map[int64]int64{},
+		lastPrune: time.Now(),
+	}, nil
+}
+
+// isSnowflakeId gives true if id looks like an id from SnowflakeIdGenerator (a ULID is 26 chars)
+func isSnowflakeId(id string) bool {
+	if len(id) != snowflakeIdLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SnowflakeIdToTime gives the time of an id generated by SnowflakeIdGenerator
+func SnowflakeIdToTime(id string) (time.Time, error) {
+	if !isSnowflakeId(id) {
+		return time.Time{}, fmt.Errorf("not a snowflake id: id=%s", id)
+	}
+	v, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("not a snowflake id: id=%s, err=%w", id, err)
+	}
+	return time.UnixMilli(SnowflakeEpoch.UnixMilli() + v>>22), nil
+}
+
+// SnowflakeNodeFromId gives the node id of an id generated by SnowflakeIdGenerator
+func SnowflakeNodeFromId(id string) (int, error) {
+	if !isSnowflakeId(id) {
+		return 0, fmt.Errorf("not a snowflake id: id=%s", id)
+	}
+	v, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a snowflake id: id=%s, err=%w", id, err)
+	}
+	return int(v >> 12 & SnowflakeMaxNodeId), nil
+}
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// generateConcurrently generates ids for the same time from many goroutines and checks that all are unique
+func generateConcurrently(t *testing.T, g IdGenerator, at time.Time) []string {
+	const goroutines, perGoroutine = 8, 500
+	ids := make(chan string, goroutines*perGoroutine)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				ids <- g.GenerateId(at)
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	unique := map[string]bool{}
+	var result []string
+	for id := range ids {
+		assert.False(t, unique[id], "duplicate id: %s", id)
+		unique[id] = true
+		result = append(result, id)
+	}
+	assert.Equal(t, goroutines*perGoroutine, len(unique))
+	return result
+}
+
+func TestIdGenerators_UniqueAndParseBackToTime(t *testing.T) {
+	monotonic, _ := NewMonotonicIdGenerator()
+	lockFree, err := NewLockFreeIdGenerator(0)
+	assert.NoError(t, err)
+	snowflake, err := NewSnowflakeIdGenerator(5)
+	assert.NoError(t, err)
+	timeBased, _ := NewTimeBasedIdGenerator()
+
+	at := time.Now().Truncate(time.Second)
+	for name, g := range map[string]IdGenerator{"monotonic": monotonic, "lockFree": lockFree, "snowflake": snowflake, "timeBased": timeBased} {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range generateConcurrently(t, g, at) {
+				idTime, err := RecordIdToTime(id)
+				assert.NoError(t, err)
+				assert.Equal(t, at.UnixMilli(), idTime.UnixMilli())
+			}
+		})
+	}
+}
+
+func TestIdGenerators_OrderWithinMillisecond(t *testing.T) {
+	monotonic, _ := NewMonotonicIdGenerator()
+	lockFree, _ := NewLockFreeIdGenerator(1)
+	snowflake, _ := NewSnowflakeIdGenerator(1)
+
+	at := time.Now().Truncate(time.Second)
+	for name, g := range map[string]IdGenerator{"monotonic": monotonic, "lockFree": lockFree, "snowflake": snowflake} {
+		t.Run(name, func(t *testing.T) {
+			var ids []string
+			for i := 0; i < 1000; i++ {
+				ids = append(ids, g.GenerateId(at))
+			}
+			assert.True(t, sort.StringsAreSorted(ids))
+		})
+	}
+
+	// Ids of a later time sort after ids of an earlier time
+	early, late := snowflake.GenerateId(at), snowflake.GenerateId(at.Add(time.Second))
+	assert.Less(t, early, late)
+}
+
+func TestIdGenerators_FailLoudly(t *testing.T) {
+	monotonic, _ := NewMonotonicIdGenerator()
+	lockFree, _ := NewLockFreeIdGenerator(2)
+	snowflake, _ := NewSnowflakeIdGenerator(1)
+	timeBased, _ := NewTimeBasedIdGenerator()
+	for _, g := range []IdGenerator{monotonic, lockFree, snowflake, timeBased} {
+		assert.Panics(t, func() { g.GenerateId("not-a-time") })
+	}
+
+	// Snowflake can not give ids before its epoch or more than 4096 ids for the same millisecond
+	assert.Panics(t, func() { snowflake.GenerateId(SnowflakeEpoch.Add(-time.Second)) })
+	at := time.Now().Truncate(time.Second)
+	for i := 0; i < 4096; i++ {
+		snowflake.GenerateId(at)
+	}
+	assert.Panics(t, func() { snowflake.GenerateId(at) })
+
+	// GenerateIdE gives the same failures as error
+	for _, g := range []IdGenerator{monotonic, lockFree, snowflake, timeBased} {
+		_, err := GenerateIdE(g, "not-a-time")
+		assert.Error(t, err)
+	}
+	_, err := GenerateIdE(snowflake, at)
+	assert.ErrorIs(t, err, ErrSnowflakeSequenceExhausted)
+	_, err = GenerateIdE(snowflake, SnowflakeEpoch.Add(-time.Second))
+	assert.Error(t, err)
+
+	_, err = NewSnowflakeIdGenerator(SnowflakeMaxNodeId + 1)
+	assert.Error(t, err)
+	_, err = NewSnowflakeIdGenerator(-1)
+	assert.Error(t, err)
+}
+
+func TestSnowflakeId(t *testing.T) {
+	g, _ := NewSnowflakeIdGenerator(SnowflakeMaxNodeId)
+	at := time.Now()
+	id := g.GenerateId(at)
+	assert.Len(t, id, 19)
+
+	node, err := SnowflakeNodeFromId(id)
+	assert.NoError(t, err)
+	assert.Equal(t, SnowflakeMaxNodeId, node)
+
+	idTime, err := SnowflakeIdToTime(id)
+	assert.NoError(t, err)
+	assert.Equal(t, at.UnixMilli(), idTime.UnixMilli())
+
+	_, err = SnowflakeIdToTime("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	assert.Error(t, err)
+	_, err = RecordIdToTime("not-an-id")
+	assert.Error(t, err)
+}
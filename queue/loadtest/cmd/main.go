@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/queue"
+	queueLoadTest "github.com/devlibx/gox-base/queue/loadtest"
+	memoryQueue "github.com/devlibx/gox-base/queue/memory"
+	mysqlQueue "github.com/devlibx/gox-base/queue/mysql"
+	"github.com/devlibx/gox-base/serialization"
+	"go.uber.org/zap"
+	"os"
+)
+
+// Runs a load test on a queue and prints the report e.g.
+//
+//	go run ./queue/loadtest/cmd -backend memory -producers 10 -consumers 10 -duration 30 -job-types 1:3,2:1
+//	go run ./queue/loadtest/cmd -backend mysql -queue-config queue.yaml -env dev -delay uniform:0:5000 -format json
+func main() {
+	backend := flag.String("backend", "memory", "queue to test: memory or mysql")
+	queueConfigFile := flag.String("queue-config", "", "queue config yaml file (required for mysql backend)")
+	env := flag.String("env", "dev", "env used to read parameterized values in queue config")
+	configFile := flag.String("config", "", "load test config yaml file (flags below override it)")
+	producers := flag.Int("producers", 0, "no of producers")
+	consumers := flag.Int("consumers", 0, "no of consumers")
+	duration := flag.Int("duration", 0, "duration of test in sec")
+	rate := flag.Int("rate", 0, "max jobs per sec by each producer (0 = as fast as possible)")
+	jobTypes := flag.String("job-types", "", "job type mix e.g. 1:3,2:1")
+	delay := flag.String("delay", "", "delay distribution e.g. none, fixed:1000, uniform:0:5000, exponential:1000")
+	failureRate := flag.Float64("failure-rate", -1, "fraction of jobs marked failed with retry")
+	tenant := flag.Int("tenant", -1, "tenant of jobs")
+	seed := flag.Int64("seed", 0, "seed of random numbers (0 = current time)")
+	format := flag.String("format", "text", "report format: text or json")
+	out := flag.String("out", "", "file to write the report (default = stdout)")
+	flag.Parse()
+
+	config := queueLoadTest.Config{}
+	if *configFile != "" {
+		if err := serialization.ReadParameterizedYamlFile(*configFile, &config, *env); err != nil {
+			exit(err)
+		}
+	}
+	if *producers > 0 {
+		config.Producers = *producers
+	}
+	if *consumers > 0 {
+		config.Consumers = *consumers
+	}
+	if *duration > 0 {
+		config.DurationInSec = *duration
+	}
+	if *rate > 0 {
+		config.ProducerRatePerSec = *rate
+	}
+	if *failureRate >= 0 {
+		config.FailureRate = *failureRate
+	}
+	if *tenant >= 0 {
+		config.Tenant = *tenant
+	}
+	if *seed != 0 {
+		config.Seed = *seed
+	}
+	if *jobTypes != "" {
+		jt, err := queueLoadTest.ParseJobTypes(*jobTypes)
+		if err != nil {
+			exit(err)
+		}
+		config.JobTypes = jt
+	}
+	if *delay != "" {
+		d, err := queueLoadTest.ParseDelay(*delay)
+		if err != nil {
+			exit(err)
+		}
+		config.Delay = d
+	}
+
+	q, err := newQueue(*backend, *queueConfigFile, *env)
+	if err != nil {
+		exit(err)
+	}
+
+	report, err := queueLoadTest.Run(context.Background(), q, config)
+	if err != nil {
+		exit(err)
+	}
+
+	var output []byte
+	if *format == "json" {
+		if output, err = report.JSON(); err != nil {
+			exit(err)
+		}
+	} else {
+		output = []byte(report.Text())
+	}
+	if *out == "" {
+		fmt.Println(string(output))
+	} else if err = os.WriteFile(*out, output, 0644); err != nil {
+		exit(err)
+	}
+}
+
+func newQueue(backend string, queueConfigFile string, env string) (queue.Queue, error) {
+	switch backend {
+	case "memory":
+		return memoryQueue.NewQueue(nil)
+	case "mysql":
+		if queueConfigFile == "" {
+			return nil, fmt.Errorf("queue-config is required for mysql backend")
+		}
+		cfg, err := queue.ReadConfigFile(queueConfigFile, env)
+		if err != nil {
+			return nil, err
+		}
+		zapConfig := zap.NewProductionConfig()
+		return mysqlQueue.NewFromConfig(gox.NewCrossFunction(zapConfig.Build()), *cfg)
+	}
+	return nil, fmt.Errorf("unknown backend: %s", backend)
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,222 @@
+package queueLoadTest
+
+import (
+	"github.com/devlibx/gox-base/errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DelayType is the distribution of the delay (from now) at which jobs are scheduled
+type DelayType string
+
+const (
+	// DelayNone schedules all jobs to run now
+	DelayNone DelayType = "none"
+
+	// DelayFixed schedules all jobs after MinInMs
+	DelayFixed DelayType = "fixed"
+
+	// DelayUniform schedules jobs after a delay picked uniformly from [MinInMs, MaxInMs]
+	DelayUniform DelayType = "uniform"
+
+	// DelayExponential schedules jobs after MinInMs + a delay picked from an exponential distribution with mean
+	// MeanInMs (capped at MaxInMs if it is set)
+	DelayExponential DelayType = "exponential"
+)
+
+// DelayDistribution is the delay at which producers schedule jobs
+type DelayDistribution struct {
+	Type     DelayType `json:"type" yaml:"type"`
+	MinInMs  int       `json:"min_in_ms" yaml:"min_in_ms"`
+	MaxInMs  int       `json:"max_in_ms" yaml:"max_in_ms"`
+	MeanInMs int       `json:"mean_in_ms" yaml:"mean_in_ms"`
+}
+
+// JobTypeWeight is a job type in the job type mix - producers schedule job types in proportion to their weights
+type JobTypeWeight struct {
+	JobType int `json:"job_type" yaml:"job_type"`
+	Weight  int `json:"weight" yaml:"weight"`
+}
+
+// Config is the config of a load test
+type Config struct {
+	Tenant int `json:"tenant" yaml:"tenant"`
+
+	// Producers and Consumers are the no of goroutines which schedule and process jobs (default = 1 each)
+	Producers int `json:"producers" yaml:"producers"`
+	Consumers int `json:"consumers" yaml:"consumers"`
+
+	// DurationInSec is how long the test runs (default = 10 sec)
+	DurationInSec int `json:"duration_in_sec" yaml:"duration_in_sec"`
+
+	// ProducerRatePerSec is the max no of jobs scheduled per sec by each producer (0 = as fast as possible)
+	ProducerRatePerSec int `json:"producer_rate_per_sec" yaml:"producer_rate_per_sec"`
+
+	// JobTypes is the job type mix (default = job type 1 only)
+	JobTypes []JobTypeWeight `json:"job_types" yaml:"job_types"`
+
+	// Delay is the delay at which jobs are scheduled (default = no delay)
+	Delay DelayDistribution `json:"delay" yaml:"delay"`
+
+	// RemainingExecution of scheduled jobs (default = 1)
+	RemainingExecution int `json:"remaining_execution" yaml:"remaining_execution"`
+
+	// FailureRate is the fraction (0 to 1) of processed jobs which are marked failed, with retry after RetryDelayInMs
+	FailureRate    float64 `json:"failure_rate" yaml:"failure_rate"`
+	RetryDelayInMs int     `json:"retry_delay_in_ms" yaml:"retry_delay_in_ms"`
+
+	// PropertiesSizeBytes is the approx size of properties of each job (0 = no properties)
+	PropertiesSizeBytes int `json:"properties_size_bytes" yaml:"properties_size_bytes"`
+
+	// LongPollTimeoutInMs is used in poll by consumers (0 = no long poll)
+	LongPollTimeoutInMs int `json:"long_poll_timeout_in_ms" yaml:"long_poll_timeout_in_ms"`
+
+	// CallTimeoutInMs is the timeout of each queue call (default = 5000ms)
+	CallTimeoutInMs int `json:"call_timeout_in_ms" yaml:"call_timeout_in_ms"`
+
+	// LatencySampleSize is the no of latencies kept per operation to compute percentiles (default = 100000)
+	LatencySampleSize int `json:"latency_sample_size" yaml:"latency_sample_size"`
+
+	// Seed of random numbers used to pick job types, delays and failures (default = current time)
+	Seed int64 `json:"seed" yaml:"seed"`
+}
+
+// SetupDefault sets default values for missing fields
+func (c *Config) SetupDefault() {
+	if c.Producers <= 0 {
+		c.Producers = 1
+	}
+	if c.Consumers <= 0 {
+		c.Consumers = 1
+	}
+	if c.DurationInSec <= 0 {
+		c.DurationInSec = 10
+	}
+	if len(c.JobTypes) == 0 {
+		c.JobTypes = []JobTypeWeight{{JobType: 1, Weight: 1}}
+	}
+	if c.Delay.Type == "" {
+		c.Delay.Type = DelayNone
+	}
+	if c.RemainingExecution <= 0 {
+		c.RemainingExecution = 1
+	}
+	if c.CallTimeoutInMs <= 0 {
+		c.CallTimeoutInMs = 5000
+	}
+	if c.LatencySampleSize <= 0 {
+		c.LatencySampleSize = 100000
+	}
+	if c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+	}
+}
+
+// Validate checks the config (call SetupDefault before it)
+func (c *Config) Validate() error {
+	if c.FailureRate < 0 || c.FailureRate > 1 {
+		return errors.New("load test config is not valid: failure_rate must be in [0, 1]: failure_rate=%v", c.FailureRate)
+	} else if c.ProducerRatePerSec < 0 {
+		return errors.New("load test config is not valid: producer_rate_per_sec must not be negative")
+	}
+	for _, jt := range c.JobTypes {
+		if jt.JobType <= 0 || jt.Weight <= 0 {
+			return errors.New("load test config is not valid: job type and weight must be positive: %+v", jt)
+		}
+	}
+
+	d := c.Delay
+	switch d.Type {
+	case DelayNone:
+	case DelayFixed:
+		if d.MinInMs < 0 {
+			return errors.New("load test config is not valid: fixed delay must not be negative")
+		}
+	case DelayUniform:
+		if d.MinInMs < 0 || d.MaxInMs < d.MinInMs {
+			return errors.New("load test config is not valid: uniform delay must have 0 <= min <= max: %+v", d)
+		}
+	case DelayExponential:
+		if d.MinInMs < 0 || d.MeanInMs <= 0 || (d.MaxInMs > 0 && d.MaxInMs < d.MinInMs) {
+			return errors.New("load test config is not valid: exponential delay must have mean > 0 and 0 <= min <= max: %+v", d)
+		}
+	default:
+		return errors.New("load test config is not valid: unknown delay type: %s", d.Type)
+	}
+	return nil
+}
+
+// next gives the delay for a job
+func (d DelayDistribution) next(r *rand.Rand) time.Duration {
+	var ms float64
+	switch d.Type {
+	case DelayFixed:
+		ms = float64(d.MinInMs)
+	case DelayUniform:
+		ms = float64(d.MinInMs) + r.Float64()*float64(d.MaxInMs-d.MinInMs)
+	case DelayExponential:
+		ms = float64(d.MinInMs) + r.ExpFloat64()*float64(d.MeanInMs)
+		if d.MaxInMs > 0 {
+			ms = math.Min(ms, float64(d.MaxInMs))
+		}
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// ParseJobTypes parses a job type mix like "1:3,2:1" (job type:weight, weight is 1 if it is missing)
+func ParseJobTypes(s string) ([]JobTypeWeight, error) {
+	var result []JobTypeWeight
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) > 2 {
+			return nil, errors.New("job type mix must be like 1:3,2:1: %s", s)
+		}
+		jt := JobTypeWeight{Weight: 1}
+		var err error
+		if jt.JobType, err = strconv.Atoi(fields[0]); err != nil {
+			return nil, errors.Wrap(err, "bad job type in job type mix: %s", part)
+		}
+		if len(fields) == 2 {
+			if jt.Weight, err = strconv.Atoi(fields[1]); err != nil {
+				return nil, errors.Wrap(err, "bad weight in job type mix: %s", part)
+			}
+		}
+		result = append(result, jt)
+	}
+	return result, nil
+}
+
+// ParseDelay parses a delay distribution like "none", "fixed:1000", "uniform:0:5000" or "exponential:1000" /
+// "exponential:1000:0:60000" (mean, min, max) - all values in ms
+func ParseDelay(s string) (DelayDistribution, error) {
+	fields := strings.Split(s, ":")
+	d := DelayDistribution{Type: DelayType(fields[0])}
+	values := make([]int, len(fields)-1)
+	for i, f := range fields[1:] {
+		var err error
+		if values[i], err = strconv.Atoi(f); err != nil {
+			return d, errors.Wrap(err, "bad value in delay: %s", s)
+		}
+	}
+
+	switch {
+	case d.Type == DelayNone && len(values) == 0:
+	case d.Type == DelayFixed && len(values) == 1:
+		d.MinInMs = values[0]
+	case d.Type == DelayUniform && len(values) == 2:
+		d.MinInMs, d.MaxInMs = values[0], values[1]
+	case d.Type == DelayExponential && len(values) == 1:
+		d.MeanInMs = values[0]
+	case d.Type == DelayExponential && len(values) == 3:
+		d.MeanInMs, d.MinInMs, d.MaxInMs = values[0], values[1], values[2]
+	default:
+		return d, errors.New("delay must be like none, fixed:1000, uniform:0:5000 or exponential:1000[:min:max]: %s", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,114 @@
+package queueLoadTest
+
+import (
+	"context"
+	"encoding/json"
+	memoryQueue "github.com/devlibx/gox-base/queue/memory"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunWithInMemoryQueue(t *testing.T) {
+	q, err := memoryQueue.NewQueue(nil)
+	assert.NoError(t, err)
+
+	report, err := Run(context.Background(), q, Config{
+		Tenant:              1,
+		Producers:           2,
+		Consumers:           2,
+		DurationInSec:       1,
+		ProducerRatePerSec:  200,
+		JobTypes:            []JobTypeWeight{{JobType: 1, Weight: 3}, {JobType: 2, Weight: 1}},
+		RemainingExecution:  2,
+		FailureRate:         0.2,
+		PropertiesSizeBytes: 100,
+		LongPollTimeoutInMs: 50,
+		Seed:                42,
+	})
+	assert.NoError(t, err)
+
+	assert.Greater(t, report.Scheduled, int64(0))
+	assert.Greater(t, report.Completed, int64(0))
+	assert.Greater(t, report.Failed, int64(0))
+	assert.Equal(t, report.Completed+report.Failed, report.Polled)
+	assert.Equal(t, report.Scheduled, report.Latency[OperationSchedule].Count)
+	assert.Equal(t, report.Polled, report.Latency[OperationPoll].Count)
+	assert.Equal(t, report.Polled, report.Lag.Count)
+	assert.Greater(t, report.ScheduleThroughput, 0.0)
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, int64(42), report.Seed)
+
+	b, err := report.JSON()
+	assert.NoError(t, err)
+	fromJson := &Report{}
+	assert.NoError(t, json.Unmarshal(b, fromJson))
+	assert.Equal(t, report.Scheduled, fromJson.Scheduled)
+	assert.Equal(t, report.Latency[OperationPoll], fromJson.Latency[OperationPoll])
+
+	text := report.Text()
+	for _, op := range operations {
+		assert.Contains(t, text, op)
+	}
+	assert.True(t, strings.Contains(text, "Throughput"))
+}
+
+func TestRunWithBadConfig(t *testing.T) {
+	q, _ := memoryQueue.NewQueue(nil)
+	_, err := Run(context.Background(), q, Config{FailureRate: 2})
+	assert.Error(t, err)
+	_, err = Run(context.Background(), q, Config{Delay: DelayDistribution{Type: DelayUniform, MinInMs: 10, MaxInMs: 1}})
+	assert.Error(t, err)
+}
+
+func TestParseJobTypes(t *testing.T) {
+	jobTypes, err := ParseJobTypes("1:3, 2")
+	assert.NoError(t, err)
+	assert.Equal(t, []JobTypeWeight{{JobType: 1, Weight: 3}, {JobType: 2, Weight: 1}}, jobTypes)
+
+	_, err = ParseJobTypes("1:a")
+	assert.Error(t, err)
+	_, err = ParseJobTypes("1:2:3")
+	assert.Error(t, err)
+}
+
+func TestParseDelay(t *testing.T) {
+	for s, expected := range map[string]DelayDistribution{
+		"none":                    {Type: DelayNone},
+		"fixed:1000":              {Type: DelayFixed, MinInMs: 1000},
+		"uniform:0:5000":          {Type: DelayUniform, MaxInMs: 5000},
+		"exponential:1000":        {Type: DelayExponential, MeanInMs: 1000},
+		"exponential:1000:10:500": {Type: DelayExponential, MeanInMs: 1000, MinInMs: 10, MaxInMs: 500},
+	} {
+		d, err := ParseDelay(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+
+	for _, s := range []string{"fixed", "uniform:1", "normal:1", "fixed:a"} {
+		_, err := ParseDelay(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestDelayDistribution(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	assert.Equal(t, time.Duration(0), DelayDistribution{Type: DelayNone}.next(r))
+	assert.Equal(t, time.Second, DelayDistribution{Type: DelayFixed, MinInMs: 1000}.next(r))
+	for i := 0; i < 1000; i++ {
+		d := DelayDistribution{Type: DelayUniform, MinInMs: 100, MaxInMs: 200}.next(r)
+		assert.True(t, d >= 100*time.Millisecond && d <= 200*time.Millisecond)
+
+		d = DelayDistribution{Type: DelayExponential, MeanInMs: 1000, MinInMs: 10, MaxInMs: 500}.next(r)
+		assert.True(t, d >= 10*time.Millisecond && d <= 500*time.Millisecond)
+	}
+}
+
+func TestPickJobType(t *testing.T) {
+	jobTypes := []JobTypeWeight{{JobType: 1, Weight: 3}, {JobType: 2, Weight: 1}}
+	assert.Equal(t, 1, pickJobType(jobTypes, 0))
+	assert.Equal(t, 1, pickJobType(jobTypes, 2))
+	assert.Equal(t, 2, pickJobType(jobTypes, 3))
+}
@@ -0,0 +1,167 @@
+package queueLoadTest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/rcrowley/go-metrics"
+	"strings"
+	"time"
+)
+
+// Operations for which latency and errors are reported
+const (
+	OperationSchedule         = "schedule"
+	OperationPoll             = "poll"
+	OperationFetchJobDetails  = "fetch_job_details"
+	OperationMarkJobCompleted = "mark_job_completed"
+	OperationMarkJobFailed    = "mark_job_failed"
+)
+
+var operations = []string{OperationSchedule, OperationPoll, OperationFetchJobDetails, OperationMarkJobCompleted, OperationMarkJobFailed}
+
+// Latency is the latency summary of an operation
+type Latency struct {
+	Count  int64   `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// LockContention shows how much consumers and producers fought for rows
+type LockContention struct {
+	// PollWaits is the no of polls which did not get a job (queue was empty or rows were locked by other consumers)
+	PollWaits int64 `json:"poll_waits"`
+
+	// LockWaitTimeouts and Deadlocks are the no of calls which failed with MySQL error 1205 and 1213
+	LockWaitTimeouts int64 `json:"lock_wait_timeouts"`
+	Deadlocks        int64 `json:"deadlocks"`
+}
+
+// Report is the result of a load test
+type Report struct {
+	DurationInSec float64 `json:"duration_in_sec"`
+	Producers     int     `json:"producers"`
+	Consumers     int     `json:"consumers"`
+	Seed          int64   `json:"seed"`
+
+	Scheduled int64 `json:"scheduled"`
+	Polled    int64 `json:"polled"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+
+	// ScheduleThroughput and CompleteThroughput are jobs per sec
+	ScheduleThroughput float64 `json:"schedule_throughput"`
+	CompleteThroughput float64 `json:"complete_throughput"`
+
+	// Latency by operation
+	Latency map[string]Latency `json:"latency"`
+
+	// Lag is the time from when a job was due (its process at time) to when it was polled
+	Lag Latency `json:"lag"`
+
+	LockContention LockContention `json:"lock_contention"`
+
+	// Errors by operation
+	Errors map[string]int64 `json:"errors"`
+}
+
+// JSON gives the report as indented json
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Text gives the report as a human-readable table
+func (r *Report) Text() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "Duration: %.1fs  Producers: %d  Consumers: %d  Seed: %d\n", r.DurationInSec, r.Producers, r.Consumers, r.Seed)
+	fmt.Fprintf(sb, "Scheduled: %d  Polled: %d  Completed: %d  Failed: %d\n", r.Scheduled, r.Polled, r.Completed, r.Failed)
+	fmt.Fprintf(sb, "Throughput: schedule=%.1f/s  complete=%.1f/s\n", r.ScheduleThroughput, r.CompleteThroughput)
+	fmt.Fprintf(sb, "Lock contention: poll_waits=%d  lock_wait_timeouts=%d  deadlocks=%d\n", r.LockContention.PollWaits, r.LockContention.LockWaitTimeouts, r.LockContention.Deadlocks)
+	fmt.Fprintf(sb, "\n%-20s %10s %10s %10s %10s %10s %8s\n", "operation", "count", "mean_ms", "p50_ms", "p99_ms", "max_ms", "errors")
+	for _, op := range operations {
+		l := r.Latency[op]
+		fmt.Fprintf(sb, "%-20s %10d %10.2f %10.2f %10.2f %10.2f %8d\n", op, l.Count, l.MeanMs, l.P50Ms, l.P99Ms, l.MaxMs, r.Errors[op])
+	}
+	fmt.Fprintf(sb, "%-20s %10d %10.2f %10.2f %10.2f %10.2f %8s\n", "lag", r.Lag.Count, r.Lag.MeanMs, r.Lag.P50Ms, r.Lag.P99Ms, r.Lag.MaxMs, "-")
+	return sb.String()
+}
+
+// recorder keeps latencies and counters of a running load test
+type recorder struct {
+	latency map[string]metrics.Histogram
+	errors  map[string]metrics.Counter
+	lag     metrics.Histogram
+
+	scheduled, polled, completed, failed   metrics.Counter
+	pollWaits, lockWaitTimeouts, deadlocks metrics.Counter
+}
+
+func newRecorder(sampleSize int) *recorder {
+	r := &recorder{
+		latency:          map[string]metrics.Histogram{},
+		errors:           map[string]metrics.Counter{},
+		lag:              metrics.NewHistogram(metrics.NewUniformSample(sampleSize)),
+		scheduled:        metrics.NewCounter(),
+		polled:           metrics.NewCounter(),
+		completed:        metrics.NewCounter(),
+		failed:           metrics.NewCounter(),
+		pollWaits:        metrics.NewCounter(),
+		lockWaitTimeouts: metrics.NewCounter(),
+		deadlocks:        metrics.NewCounter(),
+	}
+	for _, op := range operations {
+		r.latency[op] = metrics.NewHistogram(metrics.NewUniformSample(sampleSize))
+		r.errors[op] = metrics.NewCounter()
+	}
+	return r
+}
+
+func (r *recorder) report(config Config, duration time.Duration) *Report {
+	report := &Report{
+		DurationInSec: duration.Seconds(),
+		Producers:     config.Producers,
+		Consumers:     config.Consumers,
+		Seed:          config.Seed,
+		Scheduled:     r.scheduled.Count(),
+		Polled:        r.polled.Count(),
+		Completed:     r.completed.Count(),
+		Failed:        r.failed.Count(),
+		Latency:       map[string]Latency{},
+		Lag:           toLatency(r.lag),
+		LockContention: LockContention{
+			PollWaits:        r.pollWaits.Count(),
+			LockWaitTimeouts: r.lockWaitTimeouts.Count(),
+			Deadlocks:        r.deadlocks.Count(),
+		},
+		Errors: map[string]int64{},
+	}
+	if seconds := duration.Seconds(); seconds > 0 {
+		report.ScheduleThroughput = float64(report.Scheduled) / seconds
+		report.CompleteThroughput = float64(report.Completed) / seconds
+	}
+
+	for _, op := range operations {
+		report.Latency[op] = toLatency(r.latency[op])
+		if c := r.errors[op].Count(); c > 0 {
+			report.Errors[op] = c
+		}
+	}
+	return report
+}
+
+// toLatency converts histogram of durations (ns) to latency in ms
+func toLatency(h metrics.Histogram) Latency {
+	s := h.Snapshot()
+	if s.Count() == 0 {
+		return Latency{}
+	}
+	p := s.Percentiles([]float64{0.5, 0.99})
+	return Latency{
+		Count:  s.Count(),
+		MeanMs: s.Mean() / float64(time.Millisecond),
+		P50Ms:  p[0] / float64(time.Millisecond),
+		P99Ms:  p[1] / float64(time.Millisecond),
+		MaxMs:  float64(s.Max()) / float64(time.Millisecond),
+	}
+}
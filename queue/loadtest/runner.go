@@ -0,0 +1,239 @@
+package queueLoadTest
+
+import (
+	"context"
+	mysqlerrnum "github.com/bombsimon/mysql-error-numbers"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/queue"
+	"github.com/go-sql-driver/mysql"
+	pkgErrors "github.com/pkg/errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIdleWait is the max time a consumer waits when none of its job types has a job to run
+const maxIdleWait = 100 * time.Millisecond
+
+// Run runs a load test on the given queue and gives the report. It can be used with any queue.Queue e.g. the in-memory
+// queue to get a baseline, or the MySQL queue. Jobs which are not processed by the end of the test are left in queue
+func Run(ctx context.Context, q queue.Queue, config Config) (*Report, error) {
+	config.SetupDefault()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := newRecorder(config.LatencySampleSize)
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(config.DurationInSec)*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < config.Producers; i++ {
+		wg.Add(1)
+		p := &producer{q: q, config: config, recorder: r, random: rand.New(rand.NewSource(config.Seed + int64(i)))}
+		go func() {
+			defer wg.Done()
+			p.run(runCtx)
+		}()
+	}
+	for i := 0; i < config.Consumers; i++ {
+		wg.Add(1)
+		c := &consumer{q: q, config: config, recorder: r, random: rand.New(rand.NewSource(config.Seed - int64(i) - 1)), offset: i}
+		go func() {
+			defer wg.Done()
+			c.run(runCtx)
+		}()
+	}
+	wg.Wait()
+	return r.report(config, time.Since(start)), nil
+}
+
+type producer struct {
+	q        queue.Queue
+	config   Config
+	recorder *recorder
+	random   *rand.Rand
+}
+
+func (p *producer) run(ctx context.Context) {
+	var ticker *time.Ticker
+	if p.config.ProducerRatePerSec > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(p.config.ProducerRatePerSec))
+		defer ticker.Stop()
+	}
+
+	properties := map[string]interface{}{}
+	if p.config.PropertiesSizeBytes > 0 {
+		properties["data"] = strings.Repeat("x", p.config.PropertiesSizeBytes)
+	}
+
+	totalWeight := 0
+	for _, jt := range p.config.JobTypes {
+		totalWeight += jt.Weight
+	}
+
+	for ctx.Err() == nil {
+		if ticker != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+
+		jobType := pickJobType(p.config.JobTypes, p.random.Intn(totalWeight))
+		req := queue.ScheduleRequest{
+			JobType:            jobType,
+			Tenant:             p.config.Tenant,
+			At:                 time.Now().Add(p.config.Delay.next(p.random)),
+			RemainingExecution: p.config.RemainingExecution,
+			Properties:         properties,
+		}
+		if p.config.PropertiesSizeBytes == 0 {
+			req.Properties = nil
+		}
+
+		callCtx, callCancel := context.WithTimeout(ctx, time.Duration(p.config.CallTimeoutInMs)*time.Millisecond)
+		callStart := time.Now()
+		_, err := p.q.Schedule(callCtx, req)
+		callCancel()
+		if ctx.Err() != nil {
+			return
+		}
+		p.recorder.record(OperationSchedule, callStart, err)
+		if err == nil {
+			p.recorder.scheduled.Inc(1)
+		}
+	}
+}
+
+// pickJobType gives the job type for a weight in [0, total weight)
+func pickJobType(jobTypes []JobTypeWeight, weight int) int {
+	for _, jt := range jobTypes {
+		if weight < jt.Weight {
+			return jt.JobType
+		}
+		weight -= jt.Weight
+	}
+	return jobTypes[len(jobTypes)-1].JobType
+}
+
+type consumer struct {
+	q        queue.Queue
+	config   Config
+	recorder *recorder
+	random   *rand.Rand
+	offset   int
+}
+
+// run polls job types of the mix one after the other - it stays on a job type while it has jobs to run
+func (c *consumer) run(ctx context.Context) {
+	jobTypes := c.config.JobTypes
+	next := c.offset % len(jobTypes)
+	idle := 0
+	for ctx.Err() == nil {
+		if c.pollAndProcess(ctx, jobTypes[next].JobType) {
+			idle = 0
+			continue
+		}
+
+		next = (next + 1) % len(jobTypes)
+		if idle++; idle >= len(jobTypes) {
+			idle = 0
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(maxIdleWait):
+			}
+		}
+	}
+}
+
+// pollAndProcess gives true if a job was polled
+func (c *consumer) pollAndProcess(ctx context.Context, jobType int) bool {
+	timeout := time.Duration(c.config.CallTimeoutInMs+c.config.LongPollTimeoutInMs) * time.Millisecond
+	pollCtx, pollCancel := context.WithTimeout(ctx, timeout)
+	defer pollCancel()
+
+	callStart := time.Now()
+	result, err := c.q.Poll(pollCtx, queue.PollRequest{
+		Tenant:          c.config.Tenant,
+		JobType:         jobType,
+		LongPollTimeout: time.Duration(c.config.LongPollTimeoutInMs) * time.Millisecond,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		} else if isNoJobToRun(err) {
+			c.recorder.pollWaits.Inc(1)
+		} else {
+			c.recorder.record(OperationPoll, callStart, err)
+		}
+		return false
+	}
+	c.recorder.record(OperationPoll, callStart, nil)
+	c.recorder.polled.Inc(1)
+	if !result.ProcessAtTimeUsed.IsZero() {
+		if lag := time.Since(result.ProcessAtTimeUsed); lag > 0 {
+			c.recorder.lag.Update(int64(lag))
+		} else {
+			c.recorder.lag.Update(0)
+		}
+	}
+
+	// A polled job is processed even if the test is over - parent ctx is not used, so that the job is not left
+	// in progress
+	callTimeout := time.Duration(c.config.CallTimeoutInMs) * time.Millisecond
+	callCtx, callCancel := context.WithTimeout(context.Background(), callTimeout)
+	defer callCancel()
+
+	callStart = time.Now()
+	_, err = c.q.FetchJobDetails(callCtx, queue.JobDetailsRequest{Id: result.Id})
+	if c.recorder.record(OperationFetchJobDetails, callStart, err); err != nil {
+		return true
+	}
+
+	callStart = time.Now()
+	if c.config.FailureRate > 0 && c.random.Float64() < c.config.FailureRate {
+		_, err = c.q.MarkJobFailedAndScheduleRetry(callCtx, queue.MarkJobFailedWithRetryRequest{
+			Id:              result.Id,
+			ScheduleRetryAt: time.Now().Add(time.Duration(c.config.RetryDelayInMs) * time.Millisecond),
+		})
+		if c.recorder.record(OperationMarkJobFailed, callStart, err); err == nil {
+			c.recorder.failed.Inc(1)
+		}
+	} else {
+		_, err = c.q.MarkJobCompleted(callCtx, queue.MarkJobCompletedRequest{Id: result.Id})
+		if c.recorder.record(OperationMarkJobCompleted, callStart, err); err == nil {
+			c.recorder.completed.Inc(1)
+		}
+	}
+	return true
+}
+
+// record keeps the latency of a successful call or counts the error of a failed call
+func (r *recorder) record(operation string, start time.Time, err error) {
+	if err == nil {
+		r.latency[operation].Update(int64(time.Since(start)))
+		return
+	}
+
+	r.errors[operation].Inc(1)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlerrnum.ER_LOCK_WAIT_TIMEOUT:
+			r.lockWaitTimeouts.Inc(1)
+		case mysqlerrnum.ER_LOCK_DEADLOCK:
+			r.deadlocks.Inc(1)
+		}
+	}
+}
+
+func isNoJobToRun(err error) bool {
+	var pollResponseError *queue.PollResponseError
+	var pausedError *queue.JobTypePausedError
+	return errors.As(err, &pollResponseError) || errors.As(err, &pausedError) || pkgErrors.Is(err, queue.NoJobsToRunAtCurrently)
+}
@@ -0,0 +1,415 @@
+package memoryQueue
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/queue"
+	"github.com/google/uuid"
+	pkgErrors "github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pausedJobTypeWaitTime is the wait time given to poller if job type is paused - pause/resume is visible immediately
+// in this queue, it is only a hint for the poller
+const pausedJobTypeWaitTime = time.Second
+
+type job struct {
+	id                 string
+	tenant             int
+	jobType            int
+	correlationId      string
+	retryGroup         string
+	processAt          time.Time
+	expireAt           time.Time
+	state              int
+	subState           int
+	remainingExecution int
+	stringUdf1         string
+	stringUdf2         string
+	intUdf1            int
+	intUdf2            int
+	properties         string
+	failureReason      string
+}
+
+type pauseKey struct {
+	tenant  int
+	jobType int
+}
+
+// queueImpl is an in-memory queue which behaves like the MySQL backed queue. It is meant for tests and local runs -
+// jobs are lost when the process exits
+type queueImpl struct {
+	m               *sync.Mutex
+	jobs            map[string]*job
+	pauseStatus     map[pauseKey]*queue.JobTypePauseStatusResponse
+	idGenerator     queue.IdGenerator
+	notificationHub *queue.NotificationHub
+}
+
+// NewQueue gives an in-memory queue. If id generator is nil then ULID based ids are used (same as MySQL queue)
+func NewQueue(idGenerator queue.IdGenerator) (queue.Queue, error) {
+	var err error
+	if idGenerator == nil {
+		if idGenerator, err = queue.NewTimeBasedIdGenerator(); err != nil {
+			return nil, errors.Wrap(err, "id generator is not provided and not able to create default id generator")
+		}
+	}
+	return &queueImpl{
+		m:               &sync.Mutex{},
+		jobs:            map[string]*job{},
+		pauseStatus:     map[pauseKey]*queue.JobTypePauseStatusResponse{},
+		idGenerator:     idGenerator,
+		notificationHub: queue.NewNotificationHub(),
+	}, nil
+}
+
+// IdGenerator gives the id generator used for new jobs
+func (q *queueImpl) IdGenerator() queue.IdGenerator {
+	return q.idGenerator
+}
+
+func (q *queueImpl) Schedule(ctx context.Context, req queue.ScheduleRequest) (*queue.ScheduleResponse, error) {
+	if req.InternalTx != nil {
+		return nil, errors.New("failed to schedule (in-memory queue does not support InternalTx): %v", req)
+	}
+	req.Properties = queue.InjectTraceContext(ctx, req.Properties)
+
+	q.m.Lock()
+	result, err := q.internalSchedule(req)
+	q.m.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	q.notificationHub.Notify(req.Tenant, req.JobType)
+	return result, nil
+}
+
+func (q *queueImpl) internalSchedule(req queue.ScheduleRequest) (*queue.ScheduleResponse, error) {
+	processAt := req.At.Truncate(time.Second)
+	if !req.ExpireAt.IsZero() && req.ExpireAt.Before(processAt) {
+		return nil, errors.New("failed to schedule (expire at is before the scheduled time): %v", req)
+	}
+
+	// Properties are kept as json (same as MySQL) so the caller gets back exactly what MySQL queue would give
+	properties := `{"": ""}`
+	if req.Properties != nil {
+		if b, err := json.Marshal(req.Properties); err != nil {
+			return nil, errors.Wrap(err, "failed to persist (metadata is bad)")
+		} else {
+			properties = string(b)
+		}
+	}
+
+	id := req.InternalId
+	if id == "" {
+		var err error
+		if id, err = queue.GenerateIdE(q.idGenerator, processAt); err != nil {
+			return nil, errors.Wrap(err, "failed to schedule (not able to generate id): %v", req)
+		}
+	} else if err := queue.ValidateInternalId(id, processAt); err != nil {
+		return nil, errors.Wrap(err, "failed to schedule (bad id): %v", req)
+	}
+
+	j := &job{
+		id:                 id,
+		tenant:             req.Tenant,
+		jobType:            req.JobType,
+		correlationId:      req.CorrelationId,
+		retryGroup:         req.InternalRetryGroupId,
+		processAt:          processAt,
+		expireAt:           req.ExpireAt,
+		state:              queue.StatusScheduled,
+		subState:           queue.SubStatusScheduledOk,
+		remainingExecution: req.RemainingExecution,
+		stringUdf1:         req.StringUdf1,
+		stringUdf2:         req.StringUdf2,
+		intUdf1:            req.IntUdf1,
+		intUdf2:            req.IntUdf2,
+		properties:         properties,
+	}
+	if j.remainingExecution <= 0 {
+		j.remainingExecution = 1
+	}
+	if j.retryGroup == "" {
+		j.retryGroup = uuid.NewString()
+	}
+	if _, ok := q.jobs[j.id]; ok {
+		return nil, errors.New("failed to schedule (duplicate job id): id=%s", j.id)
+	}
+	q.jobs[j.id] = j
+	return &queue.ScheduleResponse{Id: j.id}, nil
+}
+
+func (q *queueImpl) Poll(ctx context.Context, req queue.PollRequest) (*queue.PollResponse, error) {
+	if req.LongPollTimeout <= 0 {
+		return q.internalPoll(req)
+	}
+
+	deadline := time.Now().Add(req.LongPollTimeout)
+	for {
+		// Subscribe before we poll - a job scheduled after our poll and before our wait must wake us up
+		wakeup := q.notificationHub.Subscribe(req.Tenant, req.JobType)
+		result, err := q.internalPoll(req)
+		var pollResponseError *queue.PollResponseError
+		if err == nil || (!errors.As(err, &pollResponseError) && !pkgErrors.Is(err, queue.NoJobsToRunAtCurrently)) {
+			return result, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, err
+		} else if pollResponseError != nil && pollResponseError.WaitForDurationBeforeTrying < remaining {
+			remaining = pollResponseError.WaitForDurationBeforeTrying
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Wrap(ctx.Err(), "long poll cancelled: tenant=%d, jobType=%d", req.Tenant, req.JobType)
+		case <-wakeup:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (q *queueImpl) internalPoll(req queue.PollRequest) (*queue.PollResponse, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if status, ok := q.pauseStatus[pauseKey{tenant: req.Tenant, jobType: req.JobType}]; ok && status.Paused {
+		return nil, &queue.JobTypePausedError{Tenant: req.Tenant, JobType: req.JobType, WaitForDurationBeforeTrying: pausedJobTypeWaitTime}
+	}
+
+	// Same as MySQL queue - pick the smallest id (ULID i.e. earliest process at) which is scheduled
+	candidates := make([]*job, 0)
+	for _, j := range q.jobs {
+		if j.tenant == req.Tenant && j.jobType == req.JobType && j.state == queue.StatusScheduled {
+			candidates = append(candidates, j)
+		}
+	}
+	sort.Slice(candidates, func(i, k int) bool { return candidates[i].id < candidates[k].id })
+
+	now := time.Now()
+	for _, j := range candidates {
+		if j.processAt.After(now) {
+			waitTime := j.processAt.UnixMilli() - now.UnixMilli()
+			if waitTime <= 0 {
+				waitTime = 1
+			} else if waitTime > 1000 {
+				waitTime = 1000
+			}
+			return nil, &queue.PollResponseError{
+				WaitForDurationBeforeTrying:       time.Duration(waitTime) * time.Millisecond,
+				NextJobTimeAvailableForProcessing: j.processAt,
+			}
+		}
+
+		// Skip the job if it is expired
+		if !j.expireAt.IsZero() && !j.expireAt.After(now) {
+			j.state, j.subState = queue.StatusFailed, queue.SubStatusExpired
+			continue
+		}
+
+		j.state = queue.StatusProcessing
+		j.remainingExecution--
+		partitionTime, _ := queue.GeneratePartitionTimeByRecordId(j.id)
+		return &queue.PollResponse{Id: j.id, RecordPartitionTime: partitionTime, ProcessAtTimeUsed: j.processAt, ExpireAt: j.expireAt}, nil
+	}
+
+	return nil, errors.Wrap(queue.NoJobsToRunAtCurrently, "jobType=%d tenant=%d", req.JobType, req.Tenant)
+}
+
+func (q *queueImpl) FetchJobDetails(ctx context.Context, req queue.JobDetailsRequest) (*queue.JobDetailsResponse, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	j, ok := q.jobs[req.Id]
+	if !ok {
+		return nil, errors.New("failed to read job details (job not found): id=%s", req.Id)
+	}
+	return q.toJobDetails(j), nil
+}
+
+func (q *queueImpl) toJobDetails(j *job) *queue.JobDetailsResponse {
+	result := &queue.JobDetailsResponse{
+		Id:                 j.id,
+		At:                 j.processAt,
+		JobType:            j.jobType,
+		State:              j.state,
+		SubState:           j.subState,
+		Tenant:             j.tenant,
+		CorrelationId:      j.correlationId,
+		RetryGroup:         j.retryGroup,
+		RemainingExecution: j.remainingExecution,
+		StringUdf1:         j.stringUdf1,
+		StringUdf2:         j.stringUdf2,
+		IntUdf1:            j.intUdf1,
+		IntUdf2:            j.intUdf2,
+		Properties:         map[string]interface{}{},
+		ExpireAt:           j.expireAt,
+	}
+	_ = json.Unmarshal([]byte(j.properties), &result.Properties)
+	return result
+}
+
+func (q *queueImpl) MarkJobFailedAndScheduleRetry(ctx context.Context, req queue.MarkJobFailedWithRetryRequest) (*queue.MarkJobFailedWithRetryResponse, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	j, ok := q.jobs[req.Id]
+	if !ok {
+		return nil, errors.New("failed to get job with id=%s - needed to setup retry", req.Id)
+	}
+	if req.FailureReason != "" {
+		j.failureReason = req.FailureReason
+	}
+
+	result := &queue.MarkJobFailedWithRetryResponse{Done: false}
+	if j.remainingExecution <= 0 {
+		j.state, j.subState = queue.StatusFailed, queue.SubStatusNoRetryPendingError
+	} else if !j.expireAt.IsZero() && req.ScheduleRetryAt.After(j.expireAt) {
+		j.state, j.subState = queue.StatusFailed, queue.SubStatusExpired
+	} else if req.ScheduleRetryAt.IsZero() {
+		j.state, j.subState = queue.StatusFailed, queue.SubStatusRetryIgnoredByUserError
+	} else {
+		jd := q.toJobDetails(j)
+		scheduleResponse, err := q.internalSchedule(queue.ScheduleRequest{
+			At:                   req.ScheduleRetryAt,
+			JobType:              jd.JobType,
+			Tenant:               jd.Tenant,
+			CorrelationId:        jd.CorrelationId,
+			RemainingExecution:   jd.RemainingExecution,
+			StringUdf1:           jd.StringUdf1,
+			StringUdf2:           jd.StringUdf2,
+			IntUdf1:              jd.IntUdf1,
+			IntUdf2:              jd.IntUdf2,
+			Properties:           jd.Properties,
+			ExpireAt:             jd.ExpireAt,
+			InternalRetryGroupId: jd.RetryGroup,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to add new retry jobs (some retries are remaining for this job): id=%s", req.Id)
+		}
+		j.state, j.subState = queue.StatusFailed, queue.SubStatusRetryPendingError
+		result.RetryJobId = scheduleResponse.Id
+		result.Done = true
+		defer q.notificationHub.Notify(j.tenant, j.jobType)
+	}
+	return result, nil
+}
+
+func (q *queueImpl) MarkJobCompleted(ctx context.Context, req queue.MarkJobCompletedRequest) (*queue.MarkJobCompletedResponse, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	j, ok := q.jobs[req.Id]
+	if !ok {
+		return nil, errors.New("failed to update the job (job not found): id=%s", req.Id)
+	}
+	j.state, j.subState = queue.StatusDone, queue.SubStatusDone
+	return &queue.MarkJobCompletedResponse{}, nil
+}
+
+func (q *queueImpl) UpdateJobData(ctx context.Context, req queue.UpdateJobDataRequest) (*queue.UpdateJobDataResponse, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	j, ok := q.jobs[req.Id]
+	if !ok {
+		return nil, errors.New("failed to update the job data (job not found): id=%s", req.Id)
+	}
+
+	if req.Properties != nil {
+		if b, err := json.Marshal(req.Properties); err != nil {
+			return nil, errors.Wrap(err, "failed to persist (metadata is bad)")
+		} else {
+			j.properties = string(b)
+		}
+	}
+	j.stringUdf1, j.stringUdf2, j.intUdf1, j.intUdf2 = req.StringUdf1, req.StringUdf2, req.IntUdf1, req.IntUdf2
+	return &queue.UpdateJobDataResponse{}, nil
+}
+
+func (q *queueImpl) FetchRetryGroup(ctx context.Context, req queue.FetchRetryGroupRequest) (*queue.FetchRetryGroupResponse, error) {
+	if req.RetryGroupId == "" {
+		return nil, errors.New("retry group id is required to fetch retry group")
+	}
+
+	q.m.Lock()
+	defer q.m.Unlock()
+	result := &queue.FetchRetryGroupResponse{RetryGroupId: req.RetryGroupId, Attempts: make([]queue.JobAttempt, 0)}
+	for _, j := range q.jobs {
+		if j.retryGroup == req.RetryGroupId {
+			result.Attempts = append(result.Attempts, queue.JobAttempt{
+				Id:                 j.id,
+				ScheduledAt:        j.processAt,
+				State:              j.state,
+				SubState:           j.subState,
+				RemainingExecution: j.remainingExecution,
+				FailureReason:      j.failureReason,
+			})
+		}
+	}
+	sort.Slice(result.Attempts, func(i, k int) bool { return result.Attempts[i].Id < result.Attempts[k].Id })
+	return result, nil
+}
+
+func (q *queueImpl) FetchJobs(ctx context.Context, req queue.FetchJobsRequest) (*queue.FetchJobsResponse, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	matched := make([]*job, 0)
+	for _, j := range q.jobs {
+		if j.id > req.AfterId && req.Matches(j.tenant, j.jobType, j.state, j.processAt) {
+			matched = append(matched, j)
+		}
+	}
+	sort.Slice(matched, func(i, k int) bool { return matched[i].id < matched[k].id })
+
+	result := &queue.FetchJobsResponse{Jobs: make([]*queue.JobDetailsResponse, 0)}
+	if len(matched) > req.PageSize() {
+		matched = matched[:req.PageSize()]
+		result.NextAfterId = matched[len(matched)-1].id
+	}
+	for _, j := range matched {
+		result.Jobs = append(result.Jobs, q.toJobDetails(j))
+	}
+	return result, nil
+}
+
+func (q *queueImpl) PauseJobType(ctx context.Context, req queue.PauseJobTypeRequest) (*queue.PauseJobTypeResponse, error) {
+	q.updatePauseStatus(req.Tenant, req.JobType, true, req.PausedBy, req.Reason)
+	return &queue.PauseJobTypeResponse{}, nil
+}
+
+func (q *queueImpl) ResumeJobType(ctx context.Context, req queue.ResumeJobTypeRequest) (*queue.ResumeJobTypeResponse, error) {
+	q.updatePauseStatus(req.Tenant, req.JobType, false, req.ResumedBy, req.Reason)
+	q.notificationHub.Notify(req.Tenant, req.JobType)
+	return &queue.ResumeJobTypeResponse{}, nil
+}
+
+func (q *queueImpl) updatePauseStatus(tenant int, jobType int, paused bool, by string, reason string) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.pauseStatus[pauseKey{tenant: tenant, jobType: jobType}] = &queue.JobTypePauseStatusResponse{
+		Tenant:    tenant,
+		JobType:   jobType,
+		Paused:    paused,
+		UpdatedBy: by,
+		Reason:    reason,
+		UpdatedAt: time.Now(),
+	}
+}
+
+func (q *queueImpl) FetchJobTypePauseStatus(ctx context.Context, req queue.JobTypePauseStatusRequest) (*queue.JobTypePauseStatusResponse, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if status, ok := q.pauseStatus[pauseKey{tenant: req.Tenant, jobType: req.JobType}]; ok {
+		result := *status
+		return &result, nil
+	}
+	return &queue.JobTypePauseStatusResponse{Tenant: req.Tenant, JobType: req.JobType}, nil
+}
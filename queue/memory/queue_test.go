@@ -0,0 +1,96 @@
+package memoryQueue
+
+import (
+	"bytes"
+	"context"
+	"github.com/devlibx/gox-base/queue"
+	"github.com/devlibx/gox-base/queue/queuetest"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	queuetest.RunConformance(t, func(t *testing.T) queue.Queue {
+		q, err := NewQueue(nil)
+		assert.NoError(t, err)
+		return q
+	})
+}
+
+func TestScheduleKeepsTraceContext(t *testing.T) {
+	old := opentracing.GlobalTracer()
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(old)
+
+	q, err := NewQueue(nil)
+	assert.NoError(t, err)
+
+	parent := tracer.StartSpan("schedule")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+	scheduled, err := q.Schedule(ctx, queue.ScheduleRequest{At: time.Now(), JobType: queuetest.JobType, Tenant: queuetest.Tenant})
+	assert.NoError(t, err)
+
+	job, err := q.FetchJobDetails(context.Background(), queue.JobDetailsRequest{Id: scheduled.Id})
+	assert.NoError(t, err)
+	span, _ := queue.StartSpanForJob(context.Background(), "process", job)
+	span.Finish()
+	assert.Equal(t, parent.(*mocktracer.MockSpan).SpanContext.SpanID, span.(*mocktracer.MockSpan).ParentID)
+}
+
+func TestScheduleFailsWhenIdCanNotBeGenerated(t *testing.T) {
+	g, _ := queue.NewSnowflakeIdGenerator(1)
+	q, err := NewQueue(g)
+	assert.NoError(t, err)
+
+	// A snowflake node gives 4096 ids for the same process time - schedule gives an error after that (it does not panic)
+	at := time.Now().Add(time.Minute)
+	for i := 0; i < 4096; i++ {
+		_, err = q.Schedule(context.Background(), queue.ScheduleRequest{At: at, JobType: queuetest.JobType, Tenant: queuetest.Tenant})
+		assert.NoError(t, err)
+	}
+	result, err := q.Schedule(context.Background(), queue.ScheduleRequest{At: at, JobType: queuetest.JobType, Tenant: queuetest.Tenant})
+	assert.ErrorIs(t, err, queue.ErrSnowflakeSequenceExhausted)
+	assert.Nil(t, result)
+}
+
+func TestExportImportPreservesIds(t *testing.T) {
+	ctx := context.Background()
+	source, _ := NewQueue(nil)
+	target, _ := NewQueue(nil)
+
+	at := time.Now().Add(time.Minute)
+	scheduled, err := source.Schedule(ctx, queue.ScheduleRequest{At: at, JobType: queuetest.JobType, Tenant: queuetest.Tenant, Properties: map[string]interface{}{"a": "b"}})
+	assert.NoError(t, err)
+	original, _ := source.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: scheduled.Id})
+
+	buf := &bytes.Buffer{}
+	count, err := queue.Export(ctx, source, queue.ExportFilter{Tenant: queuetest.Tenant}, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// Move to another queue with same ids and retry group
+	result, err := queue.Import(ctx, target, bytes.NewReader(buf.Bytes()), queue.ImportOptions{PreserveIds: true})
+	assert.NoError(t, err)
+	assert.Equal(t, scheduled.Id, result.IdMapping[scheduled.Id])
+	moved, err := target.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: scheduled.Id})
+	assert.NoError(t, err)
+	assert.True(t, original.At.Equal(moved.At))
+	moved.At = original.At
+	assert.Equal(t, original, moved)
+
+	// Same ids can not be imported again
+	_, err = queue.Import(ctx, target, bytes.NewReader(buf.Bytes()), queue.ImportOptions{PreserveIds: true})
+	assert.Error(t, err)
+
+	// Import in another tenant
+	tenant := queuetest.Tenant + 1
+	result, err = queue.Import(ctx, target, bytes.NewReader(buf.Bytes()), queue.ImportOptions{Tenant: &tenant})
+	assert.NoError(t, err)
+	other, _ := target.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: result.IdMapping[scheduled.Id]})
+	assert.Equal(t, tenant, other.Tenant)
+	assert.True(t, original.At.Equal(other.At))
+}
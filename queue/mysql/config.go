@@ -0,0 +1,30 @@
+package queue
+
+import (
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/queue"
+)
+
+// NewFromConfig builds a ready to use MySQL backed queue from config - it opens the store, sets up the ULID id
+// generator and the query rewriter for the configured table and UDF column names
+func NewFromConfig(cf gox.CrossFunction, cfg queue.Config) (queue.Queue, error) {
+	cfg.SetupDefault()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	storeBackend, err := NewMySqlBackedStoreWithCrossFunction(cf, cfg.Store, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create store backend for queue: database=%s", cfg.Store.Database)
+	}
+
+	idGenerator, err := queue.NewTimeBasedIdGenerator()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create id generator for queue")
+	}
+
+	queryRewriter := queue.NewUdfAndTableNameQueryRewriterWithUdfColumnNames(cfg.TableName, cfg.UdfColumnNames)
+
+	return NewQueue(cf, storeBackend, cfg.Queue, idGenerator, queryRewriter)
+}
@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/queue"
+	queueChaos "github.com/devlibx/gox-base/queue/chaos"
+	"io"
+	"sync"
+	"testing"
+)
+
+// fakeConnector is a driver which accepts every statement - exec gives 1 row affected and query gives no rows. It is
+// enough to run queue code which does not read rows back (e.g. Schedule) without MySQL
+type fakeConnector struct {
+	mu        sync.Mutex
+	execs     []string
+	commits   int
+	rollbacks int
+
+	// prepareErr if set, gives the error to fail prepare of the query with (nil = prepared)
+	prepareErr func(query string) error
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{connector: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+func (c *fakeConnector) executed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.execs...)
+}
+
+type fakeConn struct {
+	connector *fakeConnector
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.connector.mu.Lock()
+	prepareErr := c.connector.prepareErr
+	c.connector.mu.Unlock()
+	if prepareErr != nil {
+		if err := prepareErr(query); err != nil {
+			return nil, err
+		}
+	}
+	return &fakeStmt{connector: c.connector, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{connector: c.connector}, nil
+}
+
+type fakeTx struct {
+	connector *fakeConnector
+}
+
+func (t *fakeTx) Commit() error {
+	t.connector.mu.Lock()
+	defer t.connector.mu.Unlock()
+	t.connector.commits++
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.connector.mu.Lock()
+	defer t.connector.mu.Unlock()
+	t.connector.rollbacks++
+	return nil
+}
+
+type fakeStmt struct {
+	connector *fakeConnector
+	query     string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.connector.mu.Lock()
+	defer s.connector.mu.Unlock()
+	s.connector.execs = append(s.connector.execs, s.query)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct{}
+
+func (r *fakeRows) Columns() []string {
+	return []string{}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	return io.EOF
+}
+
+// fakeStoreBackend gives a DB over the fake driver - faults are injected by injector (nil = no faults)
+type fakeStoreBackend struct {
+	db *sql.DB
+}
+
+func (f *fakeStoreBackend) Init() error {
+	return nil
+}
+
+func (f *fakeStoreBackend) GetSqlDb() (*sql.DB, error) {
+	return f.db, nil
+}
+
+func (f *fakeStoreBackend) Close() error {
+	return f.db.Close()
+}
+
+// newQueueWithFakeDb gives a queue (without pollers) over the fake driver
+func newQueueWithFakeDb(t *testing.T, injector *queueChaos.Injector) (*queueImpl, *fakeConnector, *sql.DB) {
+	connector := &fakeConnector{}
+	q, db := newQueueWithFakeConnector(t, connector, injector)
+	return q, connector, db
+}
+
+// newQueueWithFakeConnector gives a queue (without pollers) over the given fake driver
+func newQueueWithFakeConnector(t *testing.T, connector *fakeConnector, injector *queueChaos.Injector) (*queueImpl, *sql.DB) {
+	if injector == nil {
+		injector = queueChaos.NewInjector(1)
+	}
+	db := sql.OpenDB(queueChaos.WrapConnector(connector, injector))
+	t.Cleanup(func() { _ = db.Close() })
+
+	q, err := NewQueue(gox.NewNoOpCrossFunction(), &fakeStoreBackend{db: db}, queue.MySqlBackedQueueConfig{
+		Tenant:               testTenant,
+		UsePreparedStatement: true,
+		DontRunPoller:        true,
+	}, nil, queue.NewUdfAndTableNameQueryRewriter("jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q, db
+}
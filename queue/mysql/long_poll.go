@@ -0,0 +1,58 @@
+package queue
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/queue"
+	"time"
+)
+
+// internalLongPoll keeps polling till it gets a job or req.LongPollTimeout is over. Between two polls it waits for
+// a wakeup from the notification hub (job scheduled in this process) or for the adaptive poll interval
+func (q *queueImpl) internalLongPoll(ctx context.Context, req queue.PollRequest) (result *queue.PollResponse, err error) {
+	deadline := time.Now().Add(req.LongPollTimeout)
+	interval := q.longPollMinInterval
+
+	for {
+		// Subscribe before we poll - a job scheduled after our poll and before our wait must wake us up
+		wakeup := q.notificationHub.Subscribe(req.Tenant, req.JobType)
+
+		if result, err = q.internalPollV1(ctx, req); err == nil || !isNoJobToRunNowError(err) {
+			return
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+
+		// Wait for the adaptive interval, but not beyond the next job time or the long poll timeout
+		wait := interval
+		var pollResponseError *queue.PollResponseError
+		if errors.As(err, &pollResponseError) {
+			if untilNextJob := time.Until(pollResponseError.NextJobTimeAvailableForProcessing); untilNextJob < wait {
+				wait = untilNextJob
+			}
+		}
+		if wait > remaining {
+			wait = remaining
+		}
+		if wait <= 0 {
+			wait = time.Millisecond
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Wrap(ctx.Err(), "long poll cancelled: tenant=%d, jobType=%d", req.Tenant, req.JobType)
+		case <-wakeup:
+			timer.Stop()
+			interval = q.longPollMinInterval
+		case <-timer.C:
+			if interval *= 2; interval > q.longPollMaxInterval {
+				interval = q.longPollMaxInterval
+			}
+		}
+	}
+}
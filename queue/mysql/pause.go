@@ -0,0 +1,202 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	mysqlerrnum "github.com/bombsimon/mysql-error-numbers"
+	goxSql "github.com/devlibx/gox-base/database/sql"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/queue"
+	"github.com/go-sql-driver/mysql"
+	pkgErrors "github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	pauseActionPause  = "pause"
+	pauseActionResume = "resume"
+)
+
+type pauseKey struct {
+	tenant  int
+	jobType int
+}
+
+type pauseStatusCacheEntry struct {
+	paused    bool
+	fetchedAt time.Time
+}
+
+// pauseStatusCache keeps pause status of (tenant, job type) to avoid reading DB in every poll
+type pauseStatusCache struct {
+	mu      *sync.RWMutex
+	entries map[pauseKey]pauseStatusCacheEntry
+	ttl     time.Duration
+}
+
+func (p *pauseStatusCache) get(key pauseKey) (paused bool, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if e, found := p.entries[key]; found && time.Since(e.fetchedAt) < p.ttl {
+		return e.paused, true
+	}
+	return false, false
+}
+
+func (p *pauseStatusCache) put(key pauseKey, paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries[key] = pauseStatusCacheEntry{paused: paused, fetchedAt: time.Now()}
+}
+
+func newPauseStatusCache(ttl time.Duration) *pauseStatusCache {
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+	return &pauseStatusCache{mu: &sync.RWMutex{}, entries: map[pauseKey]pauseStatusCacheEntry{}, ttl: ttl}
+}
+
+// pauseInit prepares pause queries on first use and not in NewQueue - a queue which never pauses anything works without
+// jobs_pause and jobs_pause_audit tables. If it fails (e.g. tables are not created yet) it is tried again on next call
+func (q *queueImpl) pauseInit() (err error) {
+	q.pauseInitLock.Lock()
+	defer q.pauseInitLock.Unlock()
+	if q.readPauseStatusStatement != nil {
+		return nil
+	}
+
+	upsertQuery := `
+		INSERT INTO jobs_pause
+		    (tenant, job_type, paused, updated_by, reason)
+		VALUES
+		    (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE paused=VALUES(paused), updated_by=VALUES(updated_by), reason=VALUES(reason)
+	`
+	upsertQuery = q.queryRewriter.RewriteQuery("jobs", upsertQuery)
+	auditQuery := "INSERT INTO jobs_pause_audit (tenant, job_type, action, done_by, reason) VALUES (?, ?, ?, ?, ?)"
+	auditQuery = q.queryRewriter.RewriteQuery("jobs", auditQuery)
+	statusQuery := "SELECT paused, updated_by, reason, UNIX_TIMESTAMP(updated_at) FROM jobs_pause WHERE tenant=? AND job_type=?"
+	statusQuery = q.queryRewriter.RewriteQuery("jobs", statusQuery)
+
+	var upsertStatement, auditStatement, statusStatement *sql.Stmt
+	if upsertStatement, err = q.db.PrepareContext(context.Background(), upsertQuery); err != nil {
+		return errors.Wrap(err, "failed to build query to update pause status")
+	} else if auditStatement, err = q.db.PrepareContext(context.Background(), auditQuery); err != nil {
+		_ = upsertStatement.Close()
+		return errors.Wrap(err, "failed to build query to insert pause audit")
+	} else if statusStatement, err = q.db.PrepareContext(context.Background(), statusQuery); err != nil {
+		_ = upsertStatement.Close()
+		_ = auditStatement.Close()
+		return errors.Wrap(err, "failed to build query to read pause status")
+	}
+	q.upsertPauseStatement, q.insertPauseAuditStatement, q.readPauseStatusStatement = upsertStatement, auditStatement, statusStatement
+	return nil
+}
+
+// isNoSuchTableError returns true if err is MySQL "table doesn't exist" error
+func isNoSuchTableError(err error) bool {
+	var e *mysql.MySQLError
+	return errors.As(err, &e) && e.Number == mysqlerrnum.ER_NO_SUCH_TABLE
+}
+
+func (q *queueImpl) PauseJobType(ctx context.Context, req queue.PauseJobTypeRequest) (result *queue.PauseJobTypeResponse, err error) {
+	if err = q.internalUpdatePauseStatus(ctx, req.Tenant, req.JobType, pauseActionPause, req.PausedBy, req.Reason); err != nil {
+		return nil, errors.Wrap(err, "failed to pause job type: tenant=%d, jobType=%d", req.Tenant, req.JobType)
+	}
+	q.logger.Info("job type paused", zap.Int("tenant", req.Tenant), zap.Int("jobType", req.JobType), zap.String("by", req.PausedBy), zap.String("reason", req.Reason))
+	return &queue.PauseJobTypeResponse{}, nil
+}
+
+func (q *queueImpl) ResumeJobType(ctx context.Context, req queue.ResumeJobTypeRequest) (result *queue.ResumeJobTypeResponse, err error) {
+	if err = q.internalUpdatePauseStatus(ctx, req.Tenant, req.JobType, pauseActionResume, req.ResumedBy, req.Reason); err != nil {
+		return nil, errors.Wrap(err, "failed to resume job type: tenant=%d, jobType=%d", req.Tenant, req.JobType)
+	}
+	q.notificationHub.Notify(req.Tenant, req.JobType)
+	q.logger.Info("job type resumed", zap.Int("tenant", req.Tenant), zap.Int("jobType", req.JobType), zap.String("by", req.ResumedBy), zap.String("reason", req.Reason))
+	return &queue.ResumeJobTypeResponse{}, nil
+}
+
+func (q *queueImpl) FetchJobTypePauseStatus(ctx context.Context, req queue.JobTypePauseStatusRequest) (result *queue.JobTypePauseStatusResponse, err error) {
+	if err = q.pauseInit(); err != nil {
+		return nil, errors.Wrap(err, "something is wrong we were not able to init pause queries")
+	}
+
+	result = &queue.JobTypePauseStatusResponse{Tenant: req.Tenant, JobType: req.JobType}
+	var paused sql.NullBool
+	var updatedBy, reason sql.NullString
+	var updatedAt sql.NullInt64
+	err = q.readPauseStatusStatement.QueryRowContext(ctx, req.Tenant, req.JobType).Scan(&paused, &updatedBy, &reason, &updatedAt)
+	if pkgErrors.Is(err, sql.ErrNoRows) {
+		// Never paused
+		err = nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read pause status: tenant=%d, jobType=%d", req.Tenant, req.JobType)
+	}
+
+	result.Paused = paused.Valid && paused.Bool
+	if updatedBy.Valid {
+		result.UpdatedBy = updatedBy.String
+	}
+	if reason.Valid {
+		result.Reason = reason.String
+	}
+	if updatedAt.Valid {
+		result.UpdatedAt = time.Unix(updatedAt.Int64, 0)
+	}
+
+	q.pauseStatusCache.put(pauseKey{tenant: req.Tenant, jobType: req.JobType}, result.Paused)
+	return
+}
+
+// internalUpdatePauseStatus updates the pause flag and writes an audit row in the same transaction
+func (q *queueImpl) internalUpdatePauseStatus(ctx context.Context, tenant int, jobType int, action string, by string, reason string) (err error) {
+	if err = q.pauseInit(); err != nil {
+		return errors.Wrap(err, "something is wrong we were not able to init pause queries")
+	}
+
+	if err = goxSql.RunInTx(ctx, goxSql.RunInTxOptions{
+		TxBeginOptions: goxSql.TxBeginOptions{TxnBeginner: goxSql.NewTxnBeginner(q.db), Name: "queue-update-pause-status"},
+	}, func(ctx context.Context, tx goxSql.Tx) error {
+		if _, err := tx.Stmt(q.upsertPauseStatement).ExecContext(ctx, tenant, jobType, action == pauseActionPause, by, reason); err != nil {
+			return errors.Wrap(err, "failed to update pause status")
+		} else if _, err = tx.Stmt(q.insertPauseAuditStatement).ExecContext(ctx, tenant, jobType, action, by, reason); err != nil {
+			return errors.Wrap(err, "failed to insert pause audit")
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	q.pauseStatusCache.put(pauseKey{tenant: tenant, jobType: jobType}, action == pauseActionPause)
+	return nil
+}
+
+// ensureJobTypeIsNotPaused returns JobTypePausedError if this job type is paused for this tenant
+func (q *queueImpl) ensureJobTypeIsNotPaused(ctx context.Context, tenant int, jobType int) error {
+	key := pauseKey{tenant: tenant, jobType: jobType}
+	paused, ok := q.pauseStatusCache.get(key)
+	if !ok {
+		status, err := q.FetchJobTypePauseStatus(ctx, queue.JobTypePauseStatusRequest{Tenant: tenant, JobType: jobType})
+		if err != nil && isNoSuchTableError(err) {
+			// Pause tables are not created - nothing can be paused, so poll as usual
+			q.pauseTableMissingLogOnce.Do(func() {
+				q.logger.Warn("pause tables are not created - job types can not be paused until they are created", zap.Error(err))
+			})
+			q.pauseStatusCache.put(key, false)
+		} else if err != nil {
+			return errors.Wrap(err, "failed to check if job type is paused")
+		} else {
+			paused = status.Paused
+		}
+	}
+
+	if paused {
+		return &queue.JobTypePausedError{
+			Tenant:                      tenant,
+			JobType:                     jobType,
+			WaitForDurationBeforeTrying: q.pauseStatusCache.ttl,
+		}
+	}
+	return nil
+}
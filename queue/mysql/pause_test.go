@@ -0,0 +1,38 @@
+package queue
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/queue"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestPauseWorksOnlyAfterPauseTablesAreCreated(t *testing.T) {
+	connector := &fakeConnector{prepareErr: func(query string) error {
+		if strings.Contains(query, "jobs_pause") {
+			return &mysql.MySQLError{Number: 1146, Message: "Table 'jobs_pause' doesn't exist"}
+		}
+		return nil
+	}}
+
+	// Queue is built and polls without pause tables
+	q, _ := newQueueWithFakeConnector(t, connector, nil)
+	assert.NoError(t, q.ensureJobTypeIsNotPaused(context.Background(), testTenant, testJobType))
+	_, err := q.PauseJobType(context.Background(), queue.PauseJobTypeRequest{Tenant: testTenant, JobType: testJobType, PausedBy: "test"})
+	assert.Error(t, err)
+
+	// Tables are created - pause works without a restart
+	connector.mu.Lock()
+	connector.prepareErr = nil
+	connector.mu.Unlock()
+	_, err = q.PauseJobType(context.Background(), queue.PauseJobTypeRequest{Tenant: testTenant, JobType: testJobType, PausedBy: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(connector.executed()))
+	assert.Equal(t, 1, connector.commits)
+
+	var pausedErr *queue.JobTypePausedError
+	assert.True(t, errors.As(q.ensureJobTypeIsNotPaused(context.Background(), testTenant, testJobType), &pausedErr))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	goxSql "github.com/devlibx/gox-base/database/sql"
 	"github.com/devlibx/gox-base/errors"
 	"github.com/devlibx/gox-base/queue"
 	"github.com/oklog/ulid/v2"
@@ -13,6 +14,9 @@ import (
 	"time"
 )
 
+// maxExpiredJobsToSkipInOnePoll is the max no of expired jobs marked failed in a single poll call
+const maxExpiredJobsToSkipInOnePoll = 100
+
 type jobTypeRowInfo struct {
 	jobType int
 	tenant  int
@@ -59,6 +63,9 @@ func (j *jobTypeRowInfo) ensureSmallestScheduledJobProcessTime(ctx context.Conte
 }
 
 func (q *queueImpl) Poll(ctx context.Context, req queue.PollRequest) (*queue.PollResponse, error) {
+	if req.LongPollTimeout > 0 {
+		return q.internalLongPoll(ctx, req)
+	}
 	return q.internalPollV1(ctx, req)
 }
 
@@ -66,7 +73,8 @@ func (q *queueImpl) initPollQueriesV1(ctx context.Context) (pollQuery string, up
 
 	// Build poll query with table rewrite
 	if q.useMinQueryToPickLatestRow {
-		pollQuery = "select MIN(id) from jobs where tenant=? AND state=? AND job_type=?  for update SKIP LOCKED"
+		// Expiry of the job is read with the pick - no extra query per polled job to check if it is expired
+		pollQuery = "SELECT id, UNIX_TIMESTAMP(expire_at) FROM jobs WHERE tenant=? AND state=? AND job_type=? ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED"
 	} else {
 		pollQuery = "SELECT id, pending_execution FROM jobs WHERE process_at=? AND tenant=? AND job_type=? AND state=? AND part=? LIMIT 1 FOR UPDATE SKIP LOCKED"
 	}
@@ -101,40 +109,47 @@ func (q *queueImpl) ensureWeMarkJobsWithNoRemainingTryProperly(ctx context.Conte
 
 func (q *queueImpl) internalPollV1(ctx context.Context, req queue.PollRequest) (result *queue.PollResponse, err error) {
 
+	// Do not pick anything if this job type is paused for this tenant
+	if err = q.ensureJobTypeIsNotPaused(ctx, req.Tenant, req.JobType); err != nil {
+		return nil, err
+	}
+
 	// Make sure we have poll and update query statement ready
 	if _, _, err = q.initPollQueriesV1(ctx); err != nil {
 		return nil, errors.Wrap(err, "failed to build poll and update query")
 	}
 
-	// Begin a transaction
-	tx, err := q.db.Begin()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to begin txn to schedule job")
-	}
-	defer func() {
-		if p := recover(); p != nil {
-			q.logger.Error("found error in polling", zap.Any("error", p))
-			if e := tx.Rollback(); e != nil {
-				q.logger.Error("something is wrong - tx failed to rollback after panic", zap.Error(e))
-			}
-		} else if err != nil {
-			if e := tx.Rollback(); e != nil {
-				q.logger.Error("something is wrong - tx failed to rollback", zap.Error(e))
-			}
-		} else {
-			if e := tx.Commit(); e != nil {
-				q.logger.Error("something is wrong - tx failed to commit", zap.Error(e))
-			}
+	// NOTE - we also commit if we did not find a job to run but marked some expired jobs on the way, so the poll error
+	// is kept out of the txn function
+	var pollErr error
+	if err = goxSql.RunInTx(ctx, goxSql.RunInTxOptions{
+		TxBeginOptions: goxSql.TxBeginOptions{TxnBeginner: goxSql.NewTxnBeginner(q.db), Name: "queue-poll"},
+	}, func(ctx context.Context, tx goxSql.Tx) error {
+		expiredJobCount := 0
+		result, pollErr = q.internalPollV1InTx(ctx, tx, req, &expiredJobCount)
+		if pollErr != nil && (expiredJobCount == 0 || !isNoJobToRunNowError(pollErr)) {
+			return pollErr
 		}
-	}()
+		return nil
+	}); err != nil {
+		return result, err
+	}
+	return result, pollErr
+}
+
+// internalPollV1InTx picks the top job and marks it processing in the given txn - expired jobs found on the way are
+// marked failed and counted in expiredJobCount
+func (q *queueImpl) internalPollV1InTx(ctx context.Context, tx goxSql.Tx, req queue.PollRequest, expiredJobCount *int) (result *queue.PollResponse, err error) {
 
 	// Ensure we have the smallest scheduled time - read lock to see if we have it already
 	partitionTime := time.Time{}
 	processAt := time.Time{}
 	result = &queue.PollResponse{}
 	var resultId sql.NullString
+	var expireAtUnix sql.NullInt64
 
-	err = tx.StmtContext(ctx, q.pollQueryStatement).QueryRowContext(ctx, req.Tenant, queue.StatusScheduled, req.JobType).Scan(&resultId)
+pickSmallestJob:
+	err = tx.Stmt(q.pollQueryStatement).QueryRowContext(ctx, req.Tenant, queue.StatusScheduled, req.JobType).Scan(&resultId, &expireAtUnix)
 	if err == nil && resultId.Valid {
 
 		// This is the ID we picked from index (min record)
@@ -162,6 +177,21 @@ func (q *queueImpl) internalPollV1(ctx context.Context, req queue.PollRequest) (
 					return
 				}
 
+				// Skip the job if it is expired - mark it failed and pick the next one
+				if expireAtUnix.Valid {
+					result.ExpireAt = time.Unix(expireAtUnix.Int64, 0)
+				}
+				if !result.ExpireAt.IsZero() && !result.ExpireAt.After(n) {
+					if err = q.markJobExpired(ctx, tx, result.Id, partitionTime); err != nil {
+						return
+					}
+					if *expiredJobCount++; *expiredJobCount < maxExpiredJobsToSkipInOnePoll {
+						goto pickSmallestJob
+					}
+					err = &queue.PollResponseError{WaitForDurationBeforeTrying: time.Millisecond, NextJobTimeAvailableForProcessing: n}
+					return
+				}
+
 			} else {
 				err = errors.Wrap(err, "failed to build process at time from result id: %s", result.Id)
 			}
@@ -183,7 +213,7 @@ func (q *queueImpl) internalPollV1(ctx context.Context, req queue.PollRequest) (
 	// Update the row within the same transaction
 	var updateStatusResult sql.Result
 	var noOfUpdatedRecords int64
-	updateStatusResult, err = tx.StmtContext(ctx, q.updatePollRecordStatement).ExecContext(ctx, queue.StatusProcessing, result.Id, partitionTime)
+	updateStatusResult, err = tx.Stmt(q.updatePollRecordStatement).ExecContext(ctx, queue.StatusProcessing, result.Id, partitionTime)
 	if err != nil {
 		err = fmt.Errorf("failed to update the job table pending_execution: %w id=%s", err, result.Id)
 	} else if noOfUpdatedRecords, err = updateStatusResult.RowsAffected(); err == nil && noOfUpdatedRecords == 0 {
@@ -193,6 +223,22 @@ func (q *queueImpl) internalPollV1(ctx context.Context, req queue.PollRequest) (
 	return
 }
 
+// markJobExpired marks the job failed with SubStatusExpired
+func (q *queueImpl) markJobExpired(ctx context.Context, tx goxSql.Tx, id string, part time.Time) (err error) {
+	if _, err = tx.Stmt(q.updateJobStatusStatement).ExecContext(ctx, queue.StatusFailed, queue.SubStatusExpired, id, part); err != nil {
+		err = errors.Wrap(err, "failed to mark job expired: id=%s", id)
+	} else {
+		q.logger.Debug("skipped expired job", zap.String("id", id))
+	}
+	return
+}
+
+// isNoJobToRunNowError returns true if poll did not fail but there is no job to run now
+func isNoJobToRunNowError(err error) bool {
+	var e *queue.PollResponseError
+	return errors.As(err, &e) || pkgErrors.Is(err, queue.NoJobsToRunAtCurrently)
+}
+
 func (q *queueImpl) internalPollV1_OLD_DONT_USE(ctx context.Context, req queue.PollRequest) (result *queue.PollResponse, err error) {
 
 	// Step 1 - make sure we have configured this job type - jobTypeRowInfo contains the smallest time for this job type and tenant
@@ -273,10 +319,11 @@ tryRefreshingSmallestScheduledJobProcessTime:
 
 	if q.usePreparedStatement && q.useMinQueryToPickLatestRow {
 		var resultId sql.NullString
+		var expireAtUnix sql.NullInt64
 		remainingRetries = 1
 		err = tx.StmtContext(ctx, q.pollQueryStatement).
 			QueryRowContext(ctx, req.Tenant, req.JobType, queue.StatusScheduled).
-			Scan(&resultId)
+			Scan(&resultId, &expireAtUnix)
 		if err == nil && resultId.Valid {
 			// Get the result and now also update the partition time
 			result.Id = resultId.String
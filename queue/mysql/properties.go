@@ -0,0 +1,34 @@
+package queue
+
+import (
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/serialization"
+)
+
+// encodeProperties gives properties as they are stored in DB - json, encoded by the properties codec if it is set
+func (q *queueImpl) encodeProperties(properties map[string]interface{}) (string, error) {
+	data, err := serialization.Stringify(properties)
+	if err != nil || q.propertiesCodec == nil {
+		return data, err
+	}
+	return q.propertiesCodec.Encode([]byte(data))
+}
+
+// decodeProperties reads properties stored in DB, and gives the json they were read from. Plain json (e.g. rows stored
+// before the codec was set) is read as is
+func (q *queueImpl) decodeProperties(stored string) (map[string]interface{}, []byte, error) {
+	data := []byte(stored)
+	if q.propertiesCodec != nil {
+		var err error
+		if data, err = q.propertiesCodec.Decode(stored); err != nil {
+			return nil, nil, err
+		}
+	}
+	properties := map[string]interface{}{}
+	if len(data) == 0 {
+		return properties, data, nil
+	} else if err := serialization.JsonBytesToObject(data, &properties); err != nil {
+		return nil, nil, errors.Wrap(err, "stored properties are not a json object")
+	}
+	return properties, data, nil
+}
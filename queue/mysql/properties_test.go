@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/devlibx/gox-base/queue"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestEncodeAndDecodeProperties(t *testing.T) {
+	codec, err := queue.NewPropertiesCodec(queue.PropertiesCodecConfig{
+		EncryptionKeys:  map[string]string{"k1": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))},
+		EncryptionKeyId: "k1",
+	})
+	assert.NoError(t, err)
+	q := &queueImpl{propertiesCodec: codec}
+
+	stored, err := q.encodeProperties(map[string]interface{}{"phone": "9999999999"})
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(stored, "9999999999"))
+
+	properties, raw, err := q.decodeProperties(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"phone": "9999999999"}, properties)
+	assert.JSONEq(t, `{"phone": "9999999999"}`, string(raw))
+
+	// Rows stored before the codec was set are plain json
+	properties, _, err = q.decodeProperties(`{"phone": "8888888888"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"phone": "8888888888"}, properties)
+
+	// Corrupt properties (or properties decrypted with a wrong key) are an error - not an empty map
+	_, _, err = q.decodeProperties(`{"phone": `)
+	assert.Error(t, err)
+	_, _, err = q.decodeProperties("gxq1:" + base64.StdEncoding.EncodeToString([]byte{0, 0, 'x'}))
+	assert.Error(t, err)
+
+	// Without codec properties are plain json
+	q = &queueImpl{}
+	stored, err = q.encodeProperties(map[string]interface{}{"phone": "9999999999"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"phone": "9999999999"}`, stored)
+}
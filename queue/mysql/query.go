@@ -5,13 +5,13 @@ import (
 	"database/sql"
 	"github.com/devlibx/gox-base/errors"
 	"github.com/devlibx/gox-base/queue"
-	"github.com/devlibx/gox-base/serialization"
+	"strings"
 	"time"
 )
 
 func (q *queueImpl) jobInfoInit() (err error) {
 	q.readJobDetailsOnce.Do(func() {
-		jobQuery := "select job_type, state, sub_state, correlation_id, pending_execution, tenant FROM jobs WHERE id=? AND part=?"
+		jobQuery := "select job_type, state, sub_state, correlation_id, pending_execution, tenant, UNIX_TIMESTAMP(expire_at) FROM jobs WHERE id=? AND part=?"
 		jobQuery = q.queryRewriter.RewriteQuery("jobs", jobQuery)
 		jobDataQuery := "select properties, string_udf_1, string_udf_2, int_udf_1, int_udf_2, retry_group FROM jobs_data WHERE id=? AND part=?"
 		jobDataQuery = q.queryRewriter.RewriteQuery("jobs_data", jobDataQuery)
@@ -33,6 +33,36 @@ func (q *queueImpl) jobInfoInit() (err error) {
 	return
 }
 
+// retryGroupInit prepares the queries which use jobs_data.failure_reason on first use and not in NewQueue - a queue
+// works without this column if FetchRetryGroup and failure reason are not used. If it fails it is tried again on next call
+func (q *queueImpl) retryGroupInit() (err error) {
+	q.retryGroupInitLock.Lock()
+	defer q.retryGroupInitLock.Unlock()
+	if q.readRetryGroupStatement != nil {
+		return nil
+	}
+
+	// NOTE - "jobs" rewrite also takes care of "jobs_data" table name, do not rewrite it twice
+	retryGroupQuery := `
+		SELECT d.id, j.state, j.sub_state, j.pending_execution, UNIX_TIMESTAMP(j.process_at), d.failure_reason
+		FROM jobs_data d INNER JOIN jobs j ON j.id=d.id AND j.part=d.part
+		WHERE d.retry_group=? ORDER BY d.id
+	`
+	retryGroupQuery = q.queryRewriter.RewriteQuery("jobs", retryGroupQuery)
+	jobFailureReasonUpdateQuery := "UPDATE jobs_data SET failure_reason=? WHERE id=? AND part=?"
+	jobFailureReasonUpdateQuery = q.queryRewriter.RewriteQuery("jobs_data", jobFailureReasonUpdateQuery)
+
+	var retryGroupStatement, failureReasonStatement *sql.Stmt
+	if retryGroupStatement, err = q.db.PrepareContext(context.Background(), retryGroupQuery); err != nil {
+		return errors.Wrap(err, "failed to build query for fetch retry group")
+	} else if failureReasonStatement, err = q.db.PrepareContext(context.Background(), jobFailureReasonUpdateQuery); err != nil {
+		_ = retryGroupStatement.Close()
+		return errors.Wrap(err, "failed to build query for update job failure reason")
+	}
+	q.readRetryGroupStatement, q.updateJobFailureReasonStatement = retryGroupStatement, failureReasonStatement
+	return nil
+}
+
 func (q *queueImpl) FetchJobDetails(ctx context.Context, req queue.JobDetailsRequest) (result *queue.JobDetailsResponse, err error) {
 	return q.internalJobDetails(ctx, req)
 }
@@ -46,43 +76,175 @@ func (q *queueImpl) internalJobDetails(ctx context.Context, req queue.JobDetails
 		return nil, errors.Wrap(err, "not able to get time out of id: id=%s", req.Id)
 	}
 
-	var cid, strUdf1, strUdf2, properties, retryGroup sql.NullString
-	var intUdf1, intUdf2 sql.NullInt64
-	var tenant sql.NullInt32
-	if err = q.readJobDetailsStatement.QueryRowContext(ctx, req.Id, part).Scan(&result.JobType, &result.State, &result.SubState, &cid, &result.RemainingExecution, &tenant); err != nil {
+	row := jobDetailsRow{}
+	if err = q.readJobDetailsStatement.QueryRowContext(ctx, req.Id, part).Scan(row.jobDest(result)...); err != nil {
 		return nil, errors.Wrap(err, "failed to read job details: id=%s", req.Id)
-	} else if err = q.readJobDataDetailsStatement.QueryRowContext(ctx, req.Id, part).Scan(&properties, &strUdf1, &strUdf2, &intUdf1, &intUdf2, &retryGroup); err != nil {
+	} else if err = q.readJobDataDetailsStatement.QueryRowContext(ctx, req.Id, part).Scan(row.jobDataDest()...); err != nil {
 		return nil, errors.Wrap(err, "failed to read job data details: id=%s", req.Id)
 	}
 
 	result.Id = req.Id
 	result.At = part
-	if cid.Valid {
-		result.CorrelationId = cid.String
+	if err = q.fillJobDetails(result, &row); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// jobDetailsRow keeps nullable columns of jobs and jobs_data read for job details
+type jobDetailsRow struct {
+	cid, strUdf1, strUdf2, properties, retryGroup sql.NullString
+	intUdf1, intUdf2                              sql.NullInt64
+	tenant                                        sql.NullInt32
+	expireAt                                      sql.NullInt64
+}
+
+// jobDest gives scan destinations of: job_type, state, sub_state, correlation_id, pending_execution, tenant, expire_at
+func (r *jobDetailsRow) jobDest(result *queue.JobDetailsResponse) []interface{} {
+	return []interface{}{&result.JobType, &result.State, &result.SubState, &r.cid, &result.RemainingExecution, &r.tenant, &r.expireAt}
+}
+
+// jobDataDest gives scan destinations of: properties, string_udf_1, string_udf_2, int_udf_1, int_udf_2, retry_group
+func (r *jobDetailsRow) jobDataDest() []interface{} {
+	return []interface{}{&r.properties, &r.strUdf1, &r.strUdf2, &r.intUdf1, &r.intUdf2, &r.retryGroup}
+}
+
+func (q *queueImpl) fillJobDetails(result *queue.JobDetailsResponse, r *jobDetailsRow) (err error) {
+	if r.cid.Valid {
+		result.CorrelationId = r.cid.String
+	}
+	if r.strUdf1.Valid {
+		result.StringUdf1 = r.strUdf1.String
 	}
-	if strUdf1.Valid {
-		result.StringUdf1 = strUdf1.String
+	if r.strUdf2.Valid {
+		result.StringUdf2 = r.strUdf2.String
 	}
-	if strUdf2.Valid {
-		result.StringUdf2 = strUdf2.String
+	if r.intUdf1.Valid {
+		result.IntUdf1 = int(r.intUdf1.Int64)
 	}
-	if cid.Valid {
-		result.IntUdf1 = int(intUdf1.Int64)
+	if r.intUdf2.Valid {
+		result.IntUdf2 = int(r.intUdf2.Int64)
 	}
-	if cid.Valid {
-		result.IntUdf2 = int(intUdf2.Int64)
+	if r.tenant.Valid {
+		result.Tenant = int(r.tenant.Int32)
 	}
-	if tenant.Valid {
-		result.Tenant = int(tenant.Int32)
+	if r.retryGroup.Valid {
+		result.RetryGroup = r.retryGroup.String
 	}
-	if retryGroup.Valid {
-		result.RetryGroup = retryGroup.String
+	if r.expireAt.Valid {
+		result.ExpireAt = time.Unix(r.expireAt.Int64, 0)
 	}
 
-	if properties.Valid {
-		result.Properties = map[string]interface{}{}
-		serialization.JsonBytesToObjectSuppressError([]byte(properties.String), &result.Properties)
+	if r.properties.Valid {
+		if result.Properties, result.RawProperties, err = q.decodeProperties(r.properties.String); err != nil {
+			return errors.Wrap(err, "failed to read job properties: id=%s", result.Id)
+		}
 	}
+	return
+}
 
+func (q *queueImpl) FetchRetryGroup(ctx context.Context, req queue.FetchRetryGroupRequest) (result *queue.FetchRetryGroupResponse, err error) {
+	if err = q.retryGroupInit(); err != nil {
+		return nil, errors.Wrap(err, "something is wrong we were not able to init retry group read")
+	} else if req.RetryGroupId == "" {
+		return nil, errors.New("retry group id is required to fetch retry group")
+	}
+
+	var rows *sql.Rows
+	if rows, err = q.readRetryGroupStatement.QueryContext(ctx, req.RetryGroupId); err != nil {
+		return nil, errors.Wrap(err, "failed to read retry group: retryGroup=%s", req.RetryGroupId)
+	}
+	defer rows.Close()
+
+	result = &queue.FetchRetryGroupResponse{RetryGroupId: req.RetryGroupId, Attempts: make([]queue.JobAttempt, 0)}
+	for rows.Next() {
+		attempt := queue.JobAttempt{}
+		var processAt sql.NullInt64
+		var failureReason sql.NullString
+		if err = rows.Scan(&attempt.Id, &attempt.State, &attempt.SubState, &attempt.RemainingExecution, &processAt, &failureReason); err != nil {
+			return nil, errors.Wrap(err, "failed to read job in retry group: retryGroup=%s", req.RetryGroupId)
+		}
+		if processAt.Valid {
+			attempt.ScheduledAt = time.Unix(processAt.Int64, 0)
+		}
+		if failureReason.Valid {
+			attempt.FailureReason = failureReason.String
+		}
+		result.Attempts = append(result.Attempts, attempt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read retry group: retryGroup=%s", req.RetryGroupId)
+	}
+	return
+}
+
+func (q *queueImpl) FetchJobs(ctx context.Context, req queue.FetchJobsRequest) (result *queue.FetchJobsResponse, err error) {
+	if err = q.jobInfoInit(); err != nil {
+		return nil, errors.Wrap(err, "something is wrong we were not able to init read")
+	}
+
+	// Filters are optional so this query is built for each call (it is not a prepared statement). A page of jobs is read
+	// with their data in one query.
+	// NOTE - "jobs" rewrite also takes care of "jobs_data" table name, do not rewrite it twice
+	query := `
+		SELECT j.id, j.job_type, j.state, j.sub_state, j.correlation_id, j.pending_execution, j.tenant, UNIX_TIMESTAMP(j.expire_at),
+			d.properties, d.string_udf_1, d.string_udf_2, d.int_udf_1, d.int_udf_2, d.retry_group
+		FROM jobs j INNER JOIN jobs_data d ON d.id=j.id AND d.part=j.part
+		WHERE j.tenant=? AND j.id>?`
+	args := []interface{}{req.Tenant, req.AfterId}
+	if len(req.JobTypes) > 0 {
+		query += " AND j.job_type IN (?" + strings.Repeat(",?", len(req.JobTypes)-1) + ")"
+		for _, jt := range req.JobTypes {
+			args = append(args, jt)
+		}
+	}
+	if len(req.States) > 0 {
+		query += " AND j.state IN (?" + strings.Repeat(",?", len(req.States)-1) + ")"
+		for _, state := range req.States {
+			args = append(args, state)
+		}
+	}
+	if !req.ProcessAtFrom.IsZero() {
+		query += " AND j.process_at>=?"
+		args = append(args, req.ProcessAtFrom)
+	}
+	if !req.ProcessAtTo.IsZero() {
+		query += " AND j.process_at<?"
+		args = append(args, req.ProcessAtTo)
+	}
+
+	// Read one more than page size to know if there is a next page
+	query += " ORDER BY j.id LIMIT ?"
+	args = append(args, req.PageSize()+1)
+	query = q.queryRewriter.RewriteQuery("jobs", query)
+
+	var rows *sql.Rows
+	if rows, err = q.db.QueryContext(ctx, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch jobs: tenant=%d", req.Tenant)
+	}
+	defer rows.Close()
+
+	result = &queue.FetchJobsResponse{Jobs: make([]*queue.JobDetailsResponse, 0)}
+	for rows.Next() {
+		jd := &queue.JobDetailsResponse{}
+		row := jobDetailsRow{}
+		dest := append([]interface{}{&jd.Id}, row.jobDest(jd)...)
+		if err = rows.Scan(append(dest, row.jobDataDest()...)...); err != nil {
+			return nil, errors.Wrap(err, "failed to read job: tenant=%d", req.Tenant)
+		} else if jd.At, err = queue.GeneratePartitionTimeByRecordId(jd.Id); err != nil {
+			return nil, errors.Wrap(err, "not able to get time out of id: id=%s", jd.Id)
+		} else if err = q.fillJobDetails(jd, &row); err != nil {
+			return nil, err
+		}
+		result.Jobs = append(result.Jobs, jd)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch jobs: tenant=%d", req.Tenant)
+	}
+
+	if len(result.Jobs) > req.PageSize() {
+		result.Jobs = result.Jobs[:req.PageSize()]
+		result.NextAfterId = result.Jobs[len(result.Jobs)-1].Id
+	}
 	return
 }
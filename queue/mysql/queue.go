@@ -35,6 +35,9 @@ type queueImpl struct {
 	idGenerator   queue.IdGenerator
 	queryRewriter queue.QueryRewriter
 
+	// propertiesCodec encodes properties before they are stored (nil = stored as plain json)
+	propertiesCodec queue.PropertiesCodec
+
 	logger *zap.Logger
 
 	jobTypeRowInfo map[int]*jobTypeRowInfo
@@ -45,8 +48,24 @@ type queueImpl struct {
 	updateJobStatusStatement    *sql.Stmt
 	updateJobDataStatement      *sql.Stmt
 
+	retryGroupInitLock                *sync.Mutex
+	failureReasonColumnMissingLogOnce *sync.Once
+	readRetryGroupStatement           *sql.Stmt
+	updateJobFailureReasonStatement   *sql.Stmt
+
 	usePreparedStatement       bool
 	useMinQueryToPickLatestRow bool
+
+	pauseInitLock             *sync.Mutex
+	pauseTableMissingLogOnce  *sync.Once
+	pauseStatusCache          *pauseStatusCache
+	upsertPauseStatement      *sql.Stmt
+	insertPauseAuditStatement *sql.Stmt
+	readPauseStatusStatement  *sql.Stmt
+
+	notificationHub     *queue.NotificationHub
+	longPollMinInterval time.Duration
+	longPollMaxInterval time.Duration
 }
 
 type refreshEvent struct {
@@ -86,6 +105,37 @@ func NewQueue(cf gox.CrossFunction, storeBackend queue.StoreBackend, queueConfig
 
 		readJobDetailsOnce:     &sync.Once{},
 		insertJobStatementOnce: &sync.Once{},
+
+		retryGroupInitLock:                &sync.Mutex{},
+		failureReasonColumnMissingLogOnce: &sync.Once{},
+
+		pauseInitLock:            &sync.Mutex{},
+		pauseTableMissingLogOnce: &sync.Once{},
+		pauseStatusCache:         newPauseStatusCache(time.Duration(queueConfig.PauseStatusCacheTimeInMs) * time.Millisecond),
+
+		notificationHub:     queue.NewNotificationHub(),
+		longPollMinInterval: time.Duration(queueConfig.LongPollMinIntervalInMs) * time.Millisecond,
+		longPollMaxInterval: time.Duration(queueConfig.LongPollMaxIntervalInMs) * time.Millisecond,
+	}
+	if q.longPollMinInterval <= 0 {
+		q.longPollMinInterval = 50 * time.Millisecond
+	}
+	if q.longPollMaxInterval < q.longPollMinInterval {
+		q.longPollMaxInterval = time.Second
+		if q.longPollMaxInterval < q.longPollMinInterval {
+			q.longPollMaxInterval = q.longPollMinInterval
+		}
+	}
+
+	if queueConfig.PropertiesCodec != nil {
+		if q.propertiesCodec, err = queue.NewPropertiesCodec(*queueConfig.PropertiesCodec); err != nil {
+			return nil, errors.Wrap(err, "failed to build properties codec")
+		}
+	}
+
+	// Fail with the migration to run if DB is not migrated - else the first query would fail with a bare MySQL error
+	if err = q.checkSchema(context.Background()); err != nil {
+		return nil, err
 	}
 
 	// Run job top finder - we can configure max job type id
@@ -3,10 +3,11 @@ package queue
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"github.com/devlibx/gox-base"
+	goxSql "github.com/devlibx/gox-base/database/sql"
 	"github.com/devlibx/gox-base/errors"
 	"github.com/devlibx/gox-base/queue"
+	"github.com/devlibx/gox-base/queue/queuetest"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"math/rand"
@@ -19,8 +20,8 @@ var dbHost = ""
 var dbName = ""
 var dbUser = ""
 var dbPassword = ""
-var testJobType = 79
-var testTenant = 78
+var testJobType = queuetest.JobType
+var testTenant = queuetest.Tenant
 
 func setup() (storeBackend *mySqlStore, queueImpl queue.Queue, cf gox.CrossFunction, err error) {
 	dbHost = os.Getenv("DB_URL")
@@ -28,7 +29,10 @@ func setup() (storeBackend *mySqlStore, queueImpl queue.Queue, cf gox.CrossFunct
 	dbPassword = os.Getenv("DB_PASS")
 	dbName = os.Getenv("DB_NAME")
 
-	if storeBackend, err = NewMySqlBackedStore(queue.MySqlBackedStoreBackendConfig{
+	zapConfig := zap.NewDevelopmentConfig()
+	zapConfig.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+	crossFunction := gox.NewCrossFunction(zapConfig.Build())
+	if storeBackend, err = NewMySqlBackedStoreWithCrossFunction(crossFunction, queue.MySqlBackedStoreBackendConfig{
 		Host:                 os.Getenv("DB_URL"),
 		Port:                 3306,
 		User:                 os.Getenv("DB_USER"),
@@ -47,9 +51,6 @@ func setup() (storeBackend *mySqlStore, queueImpl queue.Queue, cf gox.CrossFunct
 		return
 	}
 
-	zapConfig := zap.NewDevelopmentConfig()
-	zapConfig.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-	crossFunction := gox.NewCrossFunction(zapConfig.Build())
 	if queueImpl, err = NewQueue(
 		crossFunction,
 		storeBackend,
@@ -68,372 +69,220 @@ func setup() (storeBackend *mySqlStore, queueImpl queue.Queue, cf gox.CrossFunct
 	return
 }
 
-func TestSchedule(t *testing.T) {
-	t.SkipNow()
+// TestConformance runs the queue conformance suite (schedule, poll, retry, update etc.) against MySQL
+func TestConformance(t *testing.T) {
+	if os.Getenv("DB_URL") == "" {
+		t.Skip("to run tests you must set DB_URL which points to DB used in the test")
+		return
+	}
+
+	queuetest.RunConformance(t, func(t *testing.T) queue.Queue {
+		sc, appQueue, _, err := setup()
+		assert.NoError(t, err)
+
+		// Clear all test data if remaining
+		markAllTestRowsToDone(t, context.Background(), sc.db)
+		return appQueue
+	})
+}
+
+func TestScheduleWithTxnInContext(t *testing.T) {
 	if os.Getenv("DB_URL") == "" {
 		t.Skip("to run tests you must set DB_URL which points to DB used in the test")
 		return
 	}
 
-	now := time.Now()
 	sc, appQueue, _, err := setup()
-	assert.NoError(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
 	db := sc.db
+	now := time.Now()
 
-	// Clear all test data if remaining
-	markAllTestRowsToDone(t, context.Background(), db)
-
-	t.Run("schedule a simple job", func(t *testing.T) {
+	t.Run("job is not visible if the txn from context is rolled back", func(t *testing.T) {
 		ctx, ch := context.WithTimeout(context.Background(), 10*time.Second)
 		defer ch()
 
-		rs, err := appQueue.Schedule(ctx, queue.ScheduleRequest{
-			JobType:            testJobType,
-			Tenant:             testTenant,
-			At:                 now,
-			RemainingExecution: 3,
-			Properties:         map[string]interface{}{"info": fmt.Sprintf("%d", 1023)},
-		})
+		txCtx, tx, err := goxSql.Begin(ctx, goxSql.TxBeginOptions{TxnBeginner: &dbTxnBeginner{db: db}, Name: "business"})
 		assert.NoError(t, err)
+		rs, err := appQueue.Schedule(txCtx, queue.ScheduleRequest{JobType: testJobType, Tenant: testTenant, At: now, RemainingExecution: 3})
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Rollback())
 
-		resultFromMySQL, readRowError := readRow(ctx, db, rs.Id)
-		assert.NoError(t, readRowError)
-		assert.Equal(t, queue.StatusScheduled, resultFromMySQL.State)
-		assert.Equal(t, queue.SubStatusScheduledOk, resultFromMySQL.SubState)
-		assert.Equal(t, 3, resultFromMySQL.RemainingExecution)
-		assert.Equal(t, testTenant, resultFromMySQL.Tenant)
-		assert.Equal(t, testJobType, resultFromMySQL.JobType)
-
-		// Mark old test jobs completed - otherwise they just pile up
-		_, _ = appQueue.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: rs.Id})
+		_, err = readRow(ctx, db, rs.Id)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
 	})
 
-	t.Run("schedule a simple job and pull it back and also test if job mark complete works", func(t *testing.T) {
-		ctx, ch := context.WithTimeout(context.Background(), 1*time.Second)
+	t.Run("job is visible once the txn from context is committed", func(t *testing.T) {
+		ctx, ch := context.WithTimeout(context.Background(), 10*time.Second)
 		defer ch()
 
-		rs, err := appQueue.Schedule(ctx, queue.ScheduleRequest{
-			JobType:            testJobType,
-			Tenant:             testTenant,
-			At:                 now,
-			RemainingExecution: 3,
-			Properties:         map[string]interface{}{"info": fmt.Sprintf("%d", 1023)},
-		})
+		txCtx, tx, err := goxSql.Begin(ctx, goxSql.TxBeginOptions{TxnBeginner: &dbTxnBeginner{db: db}, Name: "business"})
 		assert.NoError(t, err)
+		rs, err := appQueue.Schedule(txCtx, queue.ScheduleRequest{JobType: testJobType, Tenant: testTenant, At: now, RemainingExecution: 3})
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
 
 		resultFromMySQL, err := readRow(ctx, db, rs.Id)
 		assert.NoError(t, err)
 		assert.Equal(t, queue.StatusScheduled, resultFromMySQL.State)
-		assert.Equal(t, queue.SubStatusScheduledOk, resultFromMySQL.SubState)
-		assert.Equal(t, 3, resultFromMySQL.RemainingExecution)
-		assert.Equal(t, testTenant, resultFromMySQL.Tenant)
-		assert.Equal(t, testJobType, resultFromMySQL.JobType)
-		fmt.Println(rs)
-
-		// Try to get the job - we pull 100 jobs in case we already have some jobs with test id
-		foundJob := false
-		var pollJobDetails *queue.JobDetailsResponse
-		for i := 0; i < 100; i++ {
-			pollResult, err := appQueue.Poll(ctx, queue.PollRequest{
-				Tenant:  testTenant,
-				JobType: testJobType,
-			})
-			assert.NoError(t, err, "since we just scheduled a job, we expect a job from the queue")
-
-			// Job from some other test - ignore it
-			if pollResult.Id != rs.Id {
-				// Mark old test jobs completed - otherwise they just pile up
-				_, _ = appQueue.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: pollResult.Id})
-				continue
-			}
-			foundJob = true
-
-			pollJobDetails, err = appQueue.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: pollResult.Id})
-			assert.NoError(t, err)
-
-			assert.Equal(t, queue.StatusProcessing, pollJobDetails.State)
-			assert.Equal(t, queue.SubStatusScheduledOk, pollJobDetails.SubState)
-			assert.Equal(t, 2, pollJobDetails.RemainingExecution)
-			assert.Equal(t, testTenant, pollJobDetails.Tenant)
-			assert.Equal(t, testJobType, pollJobDetails.JobType)
-			break
-		}
-
-		// Also test mark completed
-		assert.True(t, foundJob)
-
-		if pollJobDetails != nil {
-			jobCompletedResponse, err := appQueue.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: rs.Id})
-			assert.NoError(t, err)
-			assert.NotNil(t, jobCompletedResponse)
-		}
+		_, _ = appQueue.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: rs.Id})
 	})
 }
 
-func TestPollWithNoRecord(t *testing.T) {
-	t.SkipNow()
-
+func TestPauseAndResumeJobType(t *testing.T) {
 	if os.Getenv("DB_URL") == "" {
 		t.Skip("to run tests you must set DB_URL which points to DB used in the test")
 		return
 	}
 
 	sc, appQueue, _, err := setup()
-	assert.NoError(t, err)
-
-	// Clear all test data if remaining
+	if err != nil {
+		t.Fatal(err)
+	}
 	markAllTestRowsToDone(t, context.Background(), sc.db)
 
-	t.Run("we expect no records", func(t *testing.T) {
-		ctx, ch := context.WithTimeout(context.Background(), 10*time.Second)
-		defer ch()
+	ctx, ch := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ch()
 
-		now := time.Now()
-		jobTime := now.Add(10 * time.Second)
-
-		// Make all jobs completed for our test to tun
-		db := sc.db
-		_, err = db.ExecContext(context.Background(), "UPDATE jobs SET state=? WHERE tenant=? AND job_type=?", queue.StatusDone, testTenant, testJobType)
-		assert.NoError(t, err)
+	_, err = appQueue.Schedule(ctx, queue.ScheduleRequest{JobType: testJobType, Tenant: testTenant, At: time.Now(), RemainingExecution: 3})
+	assert.NoError(t, err)
 
-		var scheduledResult *queue.ScheduleResponse
-		scheduledResult, err = appQueue.Schedule(ctx, queue.ScheduleRequest{
-			JobType:            testJobType,
-			Tenant:             testTenant,
-			At:                 jobTime,
-			RemainingExecution: 3,
-			Properties:         map[string]interface{}{"info": fmt.Sprintf("%d", 1023)},
-		})
-		assert.NoError(t, err)
-		_ = scheduledResult
-
-		for i := 0; i < 10; i++ {
-			_, err = appQueue.Poll(context.Background(), queue.PollRequest{
-				Tenant:  testTenant,
-				JobType: testJobType,
-			})
-			assert.Error(t, err, "since we just scheduled a job, we expect a job from the queue")
-
-			var e *queue.PollResponseError
-			tmp := errors.As(err, &e)
-			assert.True(t, tmp)
-			fmt.Println("Wait for ", e.WaitForDurationBeforeTrying.Milliseconds())
-			assert.True(t, e.WaitForDurationBeforeTrying.Milliseconds() > 0)
-
-			if tmp == true {
-				break
-			}
-		}
+	_, err = appQueue.PauseJobType(ctx, queue.PauseJobTypeRequest{Tenant: testTenant, JobType: testJobType, PausedBy: "test", Reason: "pause test"})
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		// Do not leave the job type paused for other tests if this test fails
+		_, _ = appQueue.ResumeJobType(context.Background(), queue.ResumeJobTypeRequest{Tenant: testTenant, JobType: testJobType, ResumedBy: "test"})
 	})
+	status, err := appQueue.FetchJobTypePauseStatus(ctx, queue.JobTypePauseStatusRequest{Tenant: testTenant, JobType: testJobType})
+	assert.NoError(t, err)
+	assert.True(t, status.Paused)
+	assert.Equal(t, "test", status.UpdatedBy)
 
-}
+	_, err = appQueue.Poll(ctx, queue.PollRequest{Tenant: testTenant, JobType: testJobType})
+	var e *queue.JobTypePausedError
+	assert.True(t, errors.As(err, &e))
+	assert.True(t, e.WaitForDurationBeforeTrying > 0)
 
-func TestRescheduleJobOnError(t *testing.T) {
-	t.SkipNow()
+	_, err = appQueue.ResumeJobType(ctx, queue.ResumeJobTypeRequest{Tenant: testTenant, JobType: testJobType, ResumedBy: "test"})
+	assert.NoError(t, err)
+	pollResult, err := appQueue.Poll(ctx, queue.PollRequest{Tenant: testTenant, JobType: testJobType})
+	assert.NoError(t, err)
+	_, _ = appQueue.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: pollResult.Id})
+}
 
+func TestPollSkipsExpiredJob(t *testing.T) {
 	if os.Getenv("DB_URL") == "" {
 		t.Skip("to run tests you must set DB_URL which points to DB used in the test")
 		return
 	}
 
-	now := time.Now()
 	sc, appQueue, _, err := setup()
-	assert.NoError(t, err)
-	db := sc.db
+	if err != nil {
+		t.Fatal(err)
+	}
+	markAllTestRowsToDone(t, context.Background(), sc.db)
 
-	t.Run("add retry on error", func(t *testing.T) {
-		ctx, ch := context.WithTimeout(context.Background(), 10*time.Second)
-		defer ch()
+	ctx, ch := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ch()
 
-		var rs *queue.ScheduleResponse
-		var pollResult *queue.PollResponse
-		var resultFromMySQL, pollJobDetails *queue.JobDetailsResponse
-		var jobFailedResponse *queue.MarkJobFailedWithRetryResponse
-		var err error
+	now := time.Now()
+	expired, err := appQueue.Schedule(ctx, queue.ScheduleRequest{JobType: testJobType, Tenant: testTenant, At: now.Add(-time.Minute), ExpireAt: now.Add(-time.Second), RemainingExecution: 3})
+	assert.NoError(t, err)
+	valid, err := appQueue.Schedule(ctx, queue.ScheduleRequest{JobType: testJobType, Tenant: testTenant, At: now, ExpireAt: now.Add(time.Hour), RemainingExecution: 3})
+	assert.NoError(t, err)
 
-		// Clear all test data if remaining
-		markAllTestRowsToDone(t, ctx, db)
-
-		// Part 1 - Schedule a job and verify its entry in DB
-		rs, err = appQueue.Schedule(ctx, queue.ScheduleRequest{
-			JobType:            testJobType,
-			Tenant:             testTenant,
-			At:                 now,
-			RemainingExecution: 3,
-			Properties:         map[string]interface{}{"info": fmt.Sprintf("%d", 1023)},
-		})
-		assert.NoError(t, err)
-		resultFromMySQL, err = readRow(ctx, db, rs.Id)
-		assert.NoError(t, err)
-		assert.Equal(t, queue.StatusScheduled, resultFromMySQL.State)
-		assert.Equal(t, queue.SubStatusScheduledOk, resultFromMySQL.SubState)
-		assert.Equal(t, 3, resultFromMySQL.RemainingExecution)
-		assert.Equal(t, testTenant, resultFromMySQL.Tenant)
-		assert.Equal(t, testJobType, resultFromMySQL.JobType)
-		fmt.Println(rs)
-
-		// Part 2 - get the job and also fetch its complete details
-		pollResult, err = appQueue.Poll(ctx, queue.PollRequest{
-			Tenant:  testTenant,
-			JobType: testJobType,
-		})
-		assert.NoError(t, err, "since we just scheduled a job, we expect a job from the queue")
-
-		// Part 2.1 - fetch its complete details
-		pollJobDetails, err = appQueue.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: pollResult.Id})
-		assert.NoError(t, err)
-		assert.Equal(t, queue.StatusProcessing, pollJobDetails.State)
-		assert.Equal(t, queue.SubStatusScheduledOk, pollJobDetails.SubState)
-		assert.Equal(t, 2, pollJobDetails.RemainingExecution)
-		assert.Equal(t, testTenant, pollJobDetails.Tenant)
-		assert.Equal(t, testJobType, pollJobDetails.JobType)
-
-		// Part 3 - Mark it failed
-		jobFailedResponse, err = appQueue.MarkJobFailedAndScheduleRetry(ctx, queue.MarkJobFailedWithRetryRequest{
-			Id:              pollResult.Id,
-			ScheduleRetryAt: now.Add(10 * time.Millisecond),
-		})
-		time.Sleep(10 * time.Millisecond)
-		assert.NoError(t, err)
-		newJobId := jobFailedResponse.RetryJobId
+	// We must get the valid job - expired job must be marked failed
+	pollResult, err := appQueue.Poll(ctx, queue.PollRequest{Tenant: testTenant, JobType: testJobType})
+	assert.NoError(t, err)
+	assert.Equal(t, valid.Id, pollResult.Id)
+	jobCtx, cancel := pollResult.WithDeadline(ctx)
+	defer cancel()
+	deadline, ok := jobCtx.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Hour).Unix(), deadline.Unix())
+
+	jd, err := appQueue.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: expired.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, queue.StatusFailed, jd.State)
+	assert.Equal(t, queue.SubStatusExpired, jd.SubState)
+	_, _ = appQueue.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: valid.Id})
+}
 
-		// Part 3.1 - make sure we marked the original job as failed
-		jd, err := readRow(ctx, db, pollResult.Id)
-		assert.NoError(t, err)
-		assert.Equal(t, queue.StatusFailed, jd.State)
-		assert.Equal(t, queue.SubStatusRetryPendingError, jd.SubState)
-		assert.Equal(t, 2, jd.RemainingExecution)
-		assert.Equal(t, testTenant, jd.Tenant)
-		assert.Equal(t, testJobType, jd.JobType)
-
-		// Part 4- Get the job again and this time it should be the retry job
-		// Also the poll result should have the id of the new job id
-		pollResult, err = appQueue.Poll(ctx, queue.PollRequest{
-			Tenant:  testTenant,
-			JobType: testJobType,
-		})
-		assert.NoError(t, err, "since we just scheduled a job, we expect a job from the queue")
-		assert.Equal(t, newJobId, pollResult.Id)
-
-		// Part 2.1 - fetch its complete details
-		pollJobDetails, err = appQueue.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: pollResult.Id})
-		assert.NoError(t, err)
-		assert.Equal(t, queue.StatusProcessing, pollJobDetails.State)
-		assert.Equal(t, queue.SubStatusScheduledOk, pollJobDetails.SubState)
-		assert.Equal(t, 1, pollJobDetails.RemainingExecution)
-		assert.Equal(t, testTenant, pollJobDetails.Tenant)
-		assert.Equal(t, testJobType, pollJobDetails.JobType)
-
-		// Again fail it
-		jobFailedResponse, err = appQueue.MarkJobFailedAndScheduleRetry(ctx, queue.MarkJobFailedWithRetryRequest{
-			Id:              pollResult.Id,
-			ScheduleRetryAt: now.Add(10 * time.Millisecond),
-		})
-		time.Sleep(10 * time.Millisecond)
-		assert.NoError(t, err)
-		newJobId = jobFailedResponse.RetryJobId
-		pollResult, err = appQueue.Poll(ctx, queue.PollRequest{
-			Tenant:  testTenant,
-			JobType: testJobType,
-		})
-		assert.NoError(t, err, "since we just scheduled a job, we expect a job from the queue")
-		assert.Equal(t, newJobId, pollResult.Id)
-		pollJobDetails, err = appQueue.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: pollResult.Id})
-		assert.NoError(t, err)
-		assert.Equal(t, 0, pollJobDetails.RemainingExecution)
-		jobFailedResponse, err = appQueue.MarkJobFailedAndScheduleRetry(ctx, queue.MarkJobFailedWithRetryRequest{
-			Id:              pollResult.Id,
-			ScheduleRetryAt: now.Add(10 * time.Millisecond),
-		})
-		time.Sleep(10 * time.Millisecond)
-		assert.NoError(t, err)
-		pollJobDetails, err = appQueue.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: pollResult.Id})
-		assert.NoError(t, err)
-		assert.Equal(t, queue.StatusFailed, pollJobDetails.State)
-		assert.Equal(t, queue.SubStatusNoRetryPendingError, pollJobDetails.SubState)
+func TestLongPollIsWokenUpBySchedule(t *testing.T) {
+	if os.Getenv("DB_URL") == "" {
+		t.Skip("to run tests you must set DB_URL which points to DB used in the test")
+		return
+	}
 
-		var count int
-		err = db.QueryRowContext(ctx, "SELECT count(*) FROM jobs_data WHERE retry_group=?", pollJobDetails.RetryGroup).Scan(&count)
-		assert.NoError(t, err)
-		assert.Equal(t, 3, count)
-		fmt.Println(pollJobDetails.RetryGroup)
+	sc, appQueue, _, err := setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	markAllTestRowsToDone(t, context.Background(), sc.db)
 
-		fmt.Println(newJobId)
-	})
+	ctx, ch := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ch()
 
-}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = appQueue.Schedule(ctx, queue.ScheduleRequest{JobType: testJobType, Tenant: testTenant, At: time.Now(), RemainingExecution: 3})
+	}()
 
-func TestUpdateJobData(t *testing.T) {
-	t.SkipNow()
+	start := time.Now()
+	pollResult, err := appQueue.Poll(ctx, queue.PollRequest{Tenant: testTenant, JobType: testJobType, LongPollTimeout: 5 * time.Second})
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+	_, _ = appQueue.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: pollResult.Id})
+}
 
+func TestFetchRetryGroup(t *testing.T) {
 	if os.Getenv("DB_URL") == "" {
 		t.Skip("to run tests you must set DB_URL which points to DB used in the test")
 		return
 	}
 
 	sc, appQueue, _, err := setup()
-	assert.NoError(t, err)
-	// db := sc.db
-	now := time.Now()
-
-	// Clear all test data if remaining
+	if err != nil {
+		t.Fatal(err)
+	}
 	markAllTestRowsToDone(t, context.Background(), sc.db)
 
-	t.Run("update job data", func(t *testing.T) {
-		ctx, ch := context.WithTimeout(context.Background(), 10*time.Second)
-		defer ch()
+	ctx, ch := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ch()
 
-		// Part 1 - Schedule a job and verify its entry in DB
-		rs, err := appQueue.Schedule(ctx, queue.ScheduleRequest{
-			JobType:            testJobType,
-			Tenant:             testTenant,
-			At:                 now,
-			RemainingExecution: 3,
-			Properties:         map[string]interface{}{"info": fmt.Sprintf("%d", 5510)},
-			StringUdf1:         "str_udf_1",
-			StringUdf2:         "str_udf_2",
-			IntUdf1:            10,
-			IntUdf2:            11,
-		})
-		assert.NoError(t, err)
-		resultFromMySQL, err := appQueue.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
-		assert.NoError(t, err)
-		assert.Equal(t, queue.StatusScheduled, resultFromMySQL.State)
-		assert.Equal(t, queue.SubStatusScheduledOk, resultFromMySQL.SubState)
-		assert.Equal(t, 3, resultFromMySQL.RemainingExecution)
-		assert.Equal(t, testTenant, resultFromMySQL.Tenant)
-		assert.Equal(t, testJobType, resultFromMySQL.JobType)
-		assert.Equal(t, "str_udf_1", resultFromMySQL.StringUdf1)
-		assert.Equal(t, "str_udf_2", resultFromMySQL.StringUdf2)
-		assert.Equal(t, 10, resultFromMySQL.IntUdf1)
-		assert.Equal(t, 11, resultFromMySQL.IntUdf2)
-		assert.Equal(t, "5510", resultFromMySQL.Properties["info"])
-		fmt.Println(rs)
-
-		updateResponse, err := appQueue.UpdateJobData(ctx, queue.UpdateJobDataRequest{
-			Id:         rs.Id,
-			StringUdf1: "str_udf_1_updated",
-			StringUdf2: "str_udf_2_updated",
-			IntUdf1:    110,
-			IntUdf2:    111,
-			Properties: map[string]interface{}{"info": fmt.Sprintf("%d", 15510)},
-		})
-		assert.NoError(t, err)
-		assert.NotNil(t, updateResponse)
+	now := time.Now()
+	rs, err := appQueue.Schedule(ctx, queue.ScheduleRequest{JobType: testJobType, Tenant: testTenant, At: now, RemainingExecution: 2})
+	assert.NoError(t, err)
+	pollResult, err := appQueue.Poll(ctx, queue.PollRequest{Tenant: testTenant, JobType: testJobType})
+	assert.NoError(t, err)
+	assert.Equal(t, rs.Id, pollResult.Id)
+	retry, err := appQueue.MarkJobFailedAndScheduleRetry(ctx, queue.MarkJobFailedWithRetryRequest{Id: rs.Id, ScheduleRetryAt: now.Add(time.Second), FailureReason: "downstream timeout"})
+	assert.NoError(t, err)
 
-		jd, err := appQueue.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
-		assert.NoError(t, err)
-		assert.NotNil(t, jd)
-		assert.Equal(t, queue.SubStatusScheduledOk, jd.SubState)
-		assert.Equal(t, 3, jd.RemainingExecution)
-		assert.Equal(t, testTenant, jd.Tenant)
-		assert.Equal(t, testJobType, jd.JobType)
-		assert.Equal(t, "str_udf_1_updated", jd.StringUdf1)
-		assert.Equal(t, "str_udf_2_updated", jd.StringUdf2)
-		assert.Equal(t, 110, jd.IntUdf1)
-		assert.Equal(t, 111, jd.IntUdf2)
-		assert.Equal(t, "15510", jd.Properties["info"])
-	})
+	jd, err := appQueue.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
+	assert.NoError(t, err)
+	history, err := appQueue.FetchRetryGroup(ctx, queue.FetchRetryGroupRequest{RetryGroupId: jd.RetryGroup})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(history.Attempts))
+	assert.Equal(t, rs.Id, history.Attempts[0].Id)
+	assert.Equal(t, queue.SubStatusRetryPendingError, history.Attempts[0].SubState)
+	assert.Equal(t, "downstream timeout", history.Attempts[0].FailureReason)
+	assert.Equal(t, retry.RetryJobId, history.Attempts[1].Id)
+	assert.Equal(t, queue.StatusScheduled, history.Attempts[1].State)
+	_, _ = appQueue.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: retry.RetryJobId})
+}
+
+type dbTxnBeginner struct {
+	db *sql.DB
+}
+
+func (d *dbTxnBeginner) Begin() (goxSql.Tx, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
 }
 
 func readRow(ctx context.Context, db *sql.DB, id string) (result *queue.JobDetailsResponse, err error) {
@@ -5,37 +5,79 @@ import (
 	"database/sql"
 	"fmt"
 	_ "github.com/bombsimon/mysql-error-numbers"
-	mysqlerrnum "github.com/bombsimon/mysql-error-numbers"
+	goxSql "github.com/devlibx/gox-base/database/sql"
 	"github.com/devlibx/gox-base/errors"
 	"github.com/devlibx/gox-base/queue"
-	"github.com/devlibx/gox-base/serialization"
-	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
-	"github.com/sethvargo/go-retry"
 	"go.uber.org/zap"
 	"time"
 )
 
+// IdGenerator gives the id generator used for new jobs
+func (q *queueImpl) IdGenerator() queue.IdGenerator {
+	return q.idGenerator
+}
+
 func (q *queueImpl) Schedule(ctx context.Context, req queue.ScheduleRequest) (result *queue.ScheduleResponse, err error) {
-	if err = retry.Exponential(ctx, 1*time.Second, func(ctx context.Context) error {
-		if result, err = q.internalScheduleV1(ctx, req, req.InternalTx); err != nil {
-			var e *mysql.MySQLError
-			if errors.As(err, &e) && e.Number == mysqlerrnum.ER_LOCK_WAIT_TIMEOUT {
-				q.logger.Info("[retry] error in scheduling job", zap.String("error", e.Error()))
-				return nil
-			}
-			return err
+	req.Properties = queue.InjectTraceContext(ctx, req.Properties)
+
+	// If caller is running inside a goxSql transaction then we join it - the job is committed/rolled back with it.
+	// Job is visible to pollers only after the txn commits, so waiting pollers are woken up by a commit hook
+	if req.InternalTx == nil && goxSql.IsTxnInContext(ctx) {
+		if result, err = q.internalScheduleInTxnFromContext(ctx, req); err != nil {
+			err = errors.Wrap(err, "failed to schedule to mysql queue (with txn from context): %v", req)
+		} else if !goxSql.OnCommit(ctx, func() { q.notificationHub.Notify(req.Tenant, req.JobType) }) {
+			q.notificationHub.Notify(req.Tenant, req.JobType)
 		}
-		return err
-	}); err != nil {
+		return
+	}
+
+	var tx goxSql.Tx
+	if req.InternalTx != nil {
+		tx = req.InternalTx
+	}
+
+	// A deadlock or lock wait timeout is returned wrapped - use goxSql.IsRetryableTxnError to back off and retry
+	if result, err = q.internalScheduleV1(ctx, req, tx); err != nil {
 		err = errors.Wrap(err, "failed to schedule to mysql queue: %v", req)
+	} else if req.InternalTx == nil {
+		// With InternalTx the caller commits - a notify now would wake pollers before the job is visible to them
+		q.notificationHub.Notify(req.Tenant, req.JobType)
 	}
 	return
 }
 
-func (q *queueImpl) internalScheduleV1(ctx context.Context, req queue.ScheduleRequest, tx *sql.Tx) (result *queue.ScheduleResponse, err error) {
+// internalScheduleInTxnFromContext inserts the job as a child of the goxSql transaction in ctx. A failure here marks the
+// parent transaction as failed, so the parent commit will fail and business data + job will be rolled back together
+func (q *queueImpl) internalScheduleInTxnFromContext(ctx context.Context, req queue.ScheduleRequest) (result *queue.ScheduleResponse, err error) {
+	var tx goxSql.Tx
+	if ctx, tx, err = goxSql.Begin(ctx, goxSql.TxBeginOptions{Name: "queue-schedule", ContinueExistingTxnIfExists: true}); err != nil {
+		return nil, errors.Wrap(err, "failed to join the transaction from context")
+	}
+	defer func() {
+		if err != nil {
+			if e := tx.Rollback(); e != nil {
+				q.logger.Error("something is wrong - child tx failed to rollback", zap.Error(e))
+			}
+		}
+	}()
+
+	if result, err = q.internalScheduleV1(ctx, req, tx); err == nil {
+		err = tx.Commit()
+	}
+	return
+}
+
+func (q *queueImpl) internalScheduleV1(ctx context.Context, req queue.ScheduleRequest, tx goxSql.Tx) (result *queue.ScheduleResponse, err error) {
 	processAt := req.At.Truncate(time.Second)
-	id := q.idGenerator.GenerateId(processAt)
+	id := req.InternalId
+	if id == "" {
+		if id, err = queue.GenerateIdE(q.idGenerator, processAt); err != nil {
+			return nil, errors.Wrap(err, "failed to schedule (not able to generate id): %v", req)
+		}
+	} else if err = queue.ValidateInternalId(id, processAt); err != nil {
+		return nil, errors.Wrap(err, "failed to schedule (bad id): %v", req)
+	}
 
 	// Min count = 1 i.e. each row is processed min once
 	remainingExecution := req.RemainingExecution
@@ -47,6 +89,15 @@ func (q *queueImpl) internalScheduleV1(ctx context.Context, req queue.ScheduleRe
 	state := queue.StatusScheduled
 	subState := queue.SubStatusScheduledOk
 
+	// Expiry is optional - a job which expires before it is due to run is a bug in caller
+	var expireAt sql.NullTime
+	if !req.ExpireAt.IsZero() {
+		if req.ExpireAt.Before(processAt) {
+			return nil, errors.New("failed to schedule (expire at is before the scheduled time): %v", req)
+		}
+		expireAt = sql.NullTime{Time: req.ExpireAt, Valid: true}
+	}
+
 	// We get the partition based on the process At - by default it is end of next week
 	archiveAfter := queue.InternalImplEndOfWeek(processAt)
 
@@ -54,7 +105,7 @@ func (q *queueImpl) internalScheduleV1(ctx context.Context, req queue.ScheduleRe
 	properties := `{"": ""}`
 	if req.Properties != nil {
 		// properties = req.Properties
-		if properties, err = serialization.Stringify(req.Properties); err != nil {
+		if properties, err = q.encodeProperties(req.Properties); err != nil {
 			return nil, fmt.Errorf("failed to persist (metadata is bad): %w", err)
 		}
 	}
@@ -70,9 +121,9 @@ func (q *queueImpl) internalScheduleV1(ctx context.Context, req queue.ScheduleRe
 
 	insertJobQuery := `
 			INSERT INTO jobs 
-			    (id, tenant, correlation_id, job_type, process_at, state, sub_state, version, pending_execution, part) 
+			    (id, tenant, correlation_id, job_type, process_at, state, sub_state, version, pending_execution, part, expire_at) 
 			VALUES
-			    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)			
+			    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)			
 	`
 	insertJobQuery = q.queryRewriter.RewriteQuery("jobs", insertJobQuery)
 
@@ -91,7 +142,7 @@ func (q *queueImpl) internalScheduleV1(ctx context.Context, req queue.ScheduleRe
 		if req.InternalRetryGroupId == "" {
 			req.InternalRetryGroupId = uuid.NewString()
 		}
-		if _, err = tx.StmtContext(ctx, q.insertJobDataStatement).ExecContext(ctx, id, req.Tenant, req.StringUdf1, req.StringUdf2, req.IntUdf1, req.IntUdf2, properties, req.InternalRetryGroupId, archiveAfter); err != nil {
+		if _, err = tx.Stmt(q.insertJobDataStatement).ExecContext(ctx, id, req.Tenant, req.StringUdf1, req.StringUdf2, req.IntUdf1, req.IntUdf2, properties, req.InternalRetryGroupId, archiveAfter); err != nil {
 			return nil, errors.Wrap(err, "failed to schedule (insert job data failed): %v", req)
 		}
 	} else {
@@ -105,11 +156,11 @@ func (q *queueImpl) internalScheduleV1(ctx context.Context, req queue.ScheduleRe
 	}
 
 	if tx != nil {
-		if _, err = tx.StmtContext(ctx, q.insertJobStatement).ExecContext(ctx, id, req.Tenant, req.CorrelationId, req.JobType, processAt, state, subState, 1, remainingExecution, archiveAfter); err != nil {
+		if _, err = tx.Stmt(q.insertJobStatement).ExecContext(ctx, id, req.Tenant, req.CorrelationId, req.JobType, processAt, state, subState, 1, remainingExecution, archiveAfter, expireAt); err != nil {
 			return nil, errors.Wrap(err, "failed to schedule (insert job failed): %v", req)
 		}
 	} else {
-		if _, err = q.insertJobStatement.ExecContext(ctx, id, req.Tenant, req.CorrelationId, req.JobType, processAt, state, subState, 1, remainingExecution, archiveAfter); err != nil {
+		if _, err = q.insertJobStatement.ExecContext(ctx, id, req.Tenant, req.CorrelationId, req.JobType, processAt, state, subState, 1, remainingExecution, archiveAfter, expireAt); err != nil {
 			// if _, err = q.db.ExecContext(ctx, insertJobQuery, id, req.Tenant, req.CorrelationId, req.JobType, processAt, state, subState, 1, remainingExecution, archiveAfter); err != nil {
 			return nil, errors.Wrap(err, "failed to schedule (insert job failed): %v", req)
 		}
@@ -0,0 +1,55 @@
+package queue
+
+import (
+	"context"
+	goxSql "github.com/devlibx/gox-base/database/sql"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/queue"
+	queueChaos "github.com/devlibx/gox-base/queue/chaos"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestScheduleAfterTxnFromContextIsDone(t *testing.T) {
+	q, connector, db := newQueueWithFakeDb(t, nil)
+	req := queue.ScheduleRequest{JobType: testJobType, Tenant: testTenant, At: time.Now()}
+
+	ctx, tx, err := goxSql.Begin(context.Background(), goxSql.TxBeginOptions{TxnBeginner: goxSql.NewTxnBeginner(db), Name: "business"})
+	assert.NoError(t, err)
+	_, err = q.Schedule(ctx, req)
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	assert.Equal(t, 2, len(connector.executed()))
+
+	// Txn in ctx is committed - schedule must not join it, it runs on its own
+	result, err := q.Schedule(ctx, req)
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, result.Id)
+	}
+	assert.Equal(t, 4, len(connector.executed()))
+	assert.Equal(t, 1, connector.commits)
+}
+
+func TestScheduleReturnsLockWaitTimeout(t *testing.T) {
+	q, connector, _ := newQueueWithFakeDb(t, queueChaos.NewInjector(1, queueChaos.Fault{Operation: queueChaos.OperationDbExec, Probability: 1, Error: queueChaos.ErrLockWaitTimeout}))
+	wakeup := q.notificationHub.Subscribe(testTenant, testJobType)
+
+	result, err := q.Schedule(context.Background(), queue.ScheduleRequest{JobType: testJobType, Tenant: testTenant, At: time.Now()})
+	assert.Error(t, err)
+	assert.Nil(t, result)
+	var e *mysql.MySQLError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, queueChaos.ErrLockWaitTimeout.Number, e.Number)
+	}
+	assert.True(t, goxSql.IsRetryableTxnError(err), "caller must be able to tell that schedule can be retried")
+	assert.Equal(t, 0, connector.commits)
+
+	// Job is not scheduled, so pollers must not be woken up
+	select {
+	case <-wakeup:
+		assert.Fail(t, "pollers must not be notified when schedule fails")
+	default:
+	}
+}
@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	mysqlerrnum "github.com/bombsimon/mysql-error-numbers"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/go-sql-driver/mysql"
+	pkgErrors "github.com/pkg/errors"
+)
+
+// requiredColumn is a column which was added to an existing table - every query of the queue needs it, so a DB without
+// it must be migrated before the queue is used
+type requiredColumn struct {
+	table     string
+	column    string
+	migration string
+}
+
+var requiredColumns = []requiredColumn{
+	{table: "jobs", column: "expire_at", migration: "ALTER TABLE `jobs` ADD COLUMN `expire_at` timestamp NULL DEFAULT NULL AFTER `process_at`"},
+}
+
+// checkSchema returns an error which names the missing column and the migration to run, if a required column is not in
+// the DB - without it the queue would fail in preparing queries with a MySQL error which does not say what to do
+func (q *queueImpl) checkSchema(ctx context.Context) error {
+	for _, c := range requiredColumns {
+		query := q.queryRewriter.RewriteQuery("jobs", "SELECT "+c.column+" FROM "+c.table+" WHERE 1=0")
+		var value interface{}
+		err := q.db.QueryRowContext(ctx, query).Scan(&value)
+		if err == nil || pkgErrors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+
+		if isUnknownColumnError(err) {
+			return errors.New("column %s is missing - run this migration before using this version of queue: %s",
+				c.column, q.queryRewriter.RewriteQuery("jobs", c.migration),
+			)
+		}
+		return errors.Wrap(err, "failed to check column %s in table %s", c.column, c.table)
+	}
+	return nil
+}
+
+// isUnknownColumnError returns true if err is MySQL "unknown column" error
+func isUnknownColumnError(err error) bool {
+	var e *mysql.MySQLError
+	return errors.As(err, &e) && e.Number == mysqlerrnum.ER_BAD_FIELD_ERROR
+}
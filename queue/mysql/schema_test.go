@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"github.com/devlibx/gox-base"
+	"github.com/devlibx/gox-base/queue"
+	queueChaos "github.com/devlibx/gox-base/queue/chaos"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestNewQueueNamesMissingColumn(t *testing.T) {
+	connector := &fakeConnector{prepareErr: func(query string) error {
+		if strings.Contains(query, "expire_at") {
+			return &mysql.MySQLError{Number: 1054, Message: "Unknown column 'expire_at' in 'field list'"}
+		}
+		return nil
+	}}
+	db := sql.OpenDB(queueChaos.WrapConnector(connector, queueChaos.NewInjector(1)))
+	defer db.Close()
+
+	_, err := NewQueue(gox.NewNoOpCrossFunction(), &fakeStoreBackend{db: db}, queue.MySqlBackedQueueConfig{Tenant: testTenant, DontRunPoller: true},
+		nil, queue.NewUdfAndTableNameQueryRewriter("otp_jobs"),
+	)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "column expire_at is missing")
+		assert.Contains(t, err.Error(), "ALTER TABLE `otp_jobs` ADD COLUMN `expire_at`")
+	}
+}
+
+func TestFailureReasonColumnIsNeededOnlyOnFirstUse(t *testing.T) {
+	connector := &fakeConnector{prepareErr: func(query string) error {
+		if strings.Contains(query, "failure_reason") {
+			return &mysql.MySQLError{Number: 1054, Message: "Unknown column 'failure_reason' in 'field list'"}
+		}
+		return nil
+	}}
+
+	// Queue is built without failure_reason column - only FetchRetryGroup fails
+	q, _ := newQueueWithFakeConnector(t, connector, nil)
+	_, err := q.FetchRetryGroup(context.Background(), queue.FetchRetryGroupRequest{RetryGroupId: "group"})
+	assert.Error(t, err)
+	assert.True(t, isUnknownColumnError(err))
+
+	// Column is added - it works without a restart
+	connector.mu.Lock()
+	connector.prepareErr = nil
+	connector.mu.Unlock()
+	result, err := q.FetchRetryGroup(context.Background(), queue.FetchRetryGroupRequest{RetryGroupId: "group"})
+	if assert.NoError(t, err) {
+		assert.Empty(t, result.Attempts)
+	}
+}
@@ -2,15 +2,15 @@ package queue
 
 import (
 	"database/sql"
-	"fmt"
+	"github.com/devlibx/gox-base"
+	goxSql "github.com/devlibx/gox-base/database/sql"
 	"github.com/devlibx/gox-base/errors"
 	"github.com/devlibx/gox-base/queue"
-	_ "github.com/go-sql-driver/mysql"
 	"sync"
-	"time"
 )
 
 type mySqlStore struct {
+	cf     gox.CrossFunction
 	db     *sql.DB
 	config queue.MySqlBackedStoreBackendConfig
 
@@ -30,40 +30,53 @@ func (m *mySqlStore) Init() error {
 		// Set default settings
 		m.config.SetupDefault()
 
-		// Open connection to DB
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", m.config.User, m.config.Password, m.config.Host, m.config.Port, m.config.Database)
-		db, err := sql.Open("mysql", dsn)
+		// Open connection to DB - it pings the DB, so a DB which is not reachable fails here (not on first query)
+		db, err := goxSql.Open(m.cf, m.config.MySQLConfig())
 		if err != nil {
 			err = errors.Wrap(err, "failed to open the db")
 			m.initErr = err
 			return
 		}
-
 		m.db = db
-		m.db.SetMaxOpenConns(m.config.MaxOpenConnection)
-		m.db.SetMaxIdleConns(m.config.MaxIdleConnection)
-		m.db.SetConnMaxLifetime(time.Duration(m.config.ConnMaxLifetimeInSec) * time.Second)
 	})
 
 	return m.initErr
 }
 
 func (m *mySqlStore) GetSqlDb() (*sql.DB, error) {
-	if m.closed {
+	if m.closed || m.db == nil {
 		return nil, errors.New("store is not initialized or it is already closed")
 	}
 	return m.db, nil
 }
 
-func (m *mySqlStore) Close() error {
+// Close closes the DB (it also stops the pool stats reporter of the DB)
+func (m *mySqlStore) Close() (err error) {
 	m.closeOnce.Do(func() {
-
+		m.closed = true
+		if m.db != nil {
+			if err = m.db.Close(); err != nil {
+				err = errors.Wrap(err, "failed to close the db")
+			}
+		}
 	})
-	return nil
+	return
 }
 
+// NewMySqlBackedStore gives a MySQL store backend without logs and metrics of the DB (see
+// NewMySqlBackedStoreWithCrossFunction). With init the DB is opened (and pinged) right away
 func NewMySqlBackedStore(config queue.MySqlBackedStoreBackendConfig, init bool) (*mySqlStore, error) {
+	return NewMySqlBackedStoreWithCrossFunction(gox.NewNoOpCrossFunction(), config, init)
+}
+
+// NewMySqlBackedStoreWithCrossFunction gives a MySQL store backend - cf is used for logs and metrics of the DB (query
+// time, pool stats and circuit breaker). With init the DB is opened (and pinged) right away
+func NewMySqlBackedStoreWithCrossFunction(cf gox.CrossFunction, config queue.MySqlBackedStoreBackendConfig, init bool) (*mySqlStore, error) {
+	if cf == nil {
+		cf = gox.NewNoOpCrossFunction()
+	}
 	m := &mySqlStore{
+		cf:        cf,
 		config:    config,
 		initOnce:  &sync.Once{},
 		closeOnce: &sync.Once{},
@@ -0,0 +1,28 @@
+package queue
+
+import (
+	"database/sql"
+	"github.com/devlibx/gox-base/queue"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMySqlStoreClose(t *testing.T) {
+	store, err := NewMySqlBackedStore(queue.MySqlBackedStoreBackendConfig{}, false)
+	assert.NoError(t, err)
+	_, err = store.GetSqlDb()
+	assert.Error(t, err, "store is not initialized")
+
+	db := sql.OpenDB(&fakeConnector{})
+	store.db = db
+	got, err := store.GetSqlDb()
+	assert.NoError(t, err)
+	assert.Equal(t, db, got)
+
+	// Close closes the db, and it is safe to call it again
+	assert.NoError(t, store.Close())
+	assert.Error(t, db.Ping())
+	_, err = store.GetSqlDb()
+	assert.Error(t, err)
+	assert.NoError(t, store.Close())
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	goxSql "github.com/devlibx/gox-base/database/sql"
 	"github.com/devlibx/gox-base/errors"
 	"github.com/devlibx/gox-base/queue"
-	"github.com/devlibx/gox-base/serialization"
 	"go.uber.org/zap"
 	"time"
 )
@@ -25,11 +25,31 @@ func (q *queueImpl) MarkJobFailedAndScheduleRetry(ctx context.Context, req queue
 		return nil, errors.Wrap(err, "failed to get job with id=%s - needed to setup retry", req.Id)
 	}
 
+	// Keep the reason of failure with this execution - this is only for debugging, so it is not part of retry txn
+	if req.FailureReason != "" {
+		if err = q.retryGroupInit(); err != nil && isUnknownColumnError(err) {
+			// jobs_data is not migrated - retry must not fail only because the reason can not be kept
+			q.failureReasonColumnMissingLogOnce.Do(func() {
+				q.logger.Warn("failure reason is not saved - jobs_data.failure_reason column is missing", zap.Error(err))
+			})
+		} else if err != nil {
+			return nil, errors.Wrap(err, "something is wrong we were not able to init failure reason update")
+		} else if _, err = q.updateJobFailureReasonStatement.ExecContext(ctx, req.FailureReason, req.Id, part); err != nil {
+			return nil, errors.Wrap(err, "failed to save failure reason of job: id=%s", req.Id)
+		}
+	}
+
 	if jobFetchResponse.RemainingExecution <= 0 {
 		if _, err = q.updateJobStatusStatement.ExecContext(ctx, queue.StatusFailed, queue.SubStatusNoRetryPendingError, req.Id, part); err != nil {
 			return nil, errors.Wrap(err, "failed to update the job to mark failed: id=%s", req.Id)
 		}
 		result.Done = false
+	} else if !jobFetchResponse.ExpireAt.IsZero() && req.ScheduleRetryAt.After(jobFetchResponse.ExpireAt) {
+		// Retry will run after the job is expired - no point in scheduling it
+		if _, err = q.updateJobStatusStatement.ExecContext(ctx, queue.StatusFailed, queue.SubStatusExpired, req.Id, part); err != nil {
+			return nil, errors.Wrap(err, "failed to update the job to mark expired: id=%s", req.Id)
+		}
+		result.Done = false
 	} else if req.ScheduleRetryAt.IsZero() {
 		if _, err = q.updateJobStatusStatement.ExecContext(ctx, queue.StatusFailed, queue.SubStatusRetryIgnoredByUserError, req.Id, part); err != nil {
 			return nil, errors.Wrap(err, "failed to update the job to mark failed: id=%s", req.Id)
@@ -37,49 +57,34 @@ func (q *queueImpl) MarkJobFailedAndScheduleRetry(ctx context.Context, req queue
 		result.Done = false
 	} else {
 
-		// Begin a transaction
-		var tx *sql.Tx
-		tx, err = q.db.Begin()
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to begin txn to schedule job")
-		}
-		defer func() {
-			if p := recover(); p != nil {
-				q.logger.Error("found error in polling", zap.Any("error", p))
-				if e := tx.Rollback(); e != nil {
-					q.logger.Error("something is wrong - tx failed to rollback after panic")
-				}
-			} else if err != nil {
-				if e := tx.Rollback(); e != nil {
-					q.logger.Error("something is wrong - tx failed to rollback")
-				}
-			} else {
-				if e := tx.Commit(); e != nil {
-					q.logger.Error("something is wrong - tx failed to commit")
-				}
+		// Retry job is scheduled (it joins the txn from ctx) and this job is marked failed in the same txn
+		var scheduleResponse *queue.ScheduleResponse
+		if err = goxSql.RunInTx(ctx, goxSql.RunInTxOptions{
+			TxBeginOptions: goxSql.TxBeginOptions{TxnBeginner: goxSql.NewTxnBeginner(q.db), Name: "queue-mark-failed-and-schedule-retry"},
+		}, func(ctx context.Context, tx goxSql.Tx) (err error) {
+			if scheduleResponse, err = q.Schedule(ctx, queue.ScheduleRequest{
+				At:                   req.ScheduleRetryAt,
+				JobType:              jobFetchResponse.JobType,
+				Tenant:               jobFetchResponse.Tenant,
+				CorrelationId:        jobFetchResponse.CorrelationId,
+				RemainingExecution:   jobFetchResponse.RemainingExecution,
+				StringUdf1:           jobFetchResponse.StringUdf1,
+				StringUdf2:           jobFetchResponse.StringUdf2,
+				IntUdf1:              jobFetchResponse.IntUdf1,
+				IntUdf2:              jobFetchResponse.IntUdf1,
+				Properties:           jobFetchResponse.Properties,
+				ExpireAt:             jobFetchResponse.ExpireAt,
+				InternalRetryGroupId: jobFetchResponse.RetryGroup,
+			}); err != nil {
+				return errors.Wrap(err, "failed to add new retry jobs (some retries are remaining for this job): id=%s", req.Id)
 			}
-		}()
 
-		var scheduleResponse *queue.ScheduleResponse
-		if scheduleResponse, err = q.Schedule(ctx, queue.ScheduleRequest{
-			At:                   req.ScheduleRetryAt,
-			JobType:              jobFetchResponse.JobType,
-			Tenant:               jobFetchResponse.Tenant,
-			CorrelationId:        jobFetchResponse.CorrelationId,
-			RemainingExecution:   jobFetchResponse.RemainingExecution,
-			StringUdf1:           jobFetchResponse.StringUdf1,
-			StringUdf2:           jobFetchResponse.StringUdf2,
-			IntUdf1:              jobFetchResponse.IntUdf1,
-			IntUdf2:              jobFetchResponse.IntUdf1,
-			Properties:           jobFetchResponse.Properties,
-			InternalRetryGroupId: jobFetchResponse.RetryGroup,
-			InternalTx:           tx,
+			if _, err = tx.Stmt(q.updateJobStatusStatement).ExecContext(ctx, queue.StatusFailed, queue.SubStatusRetryPendingError, req.Id, part); err != nil {
+				return errors.Wrap(err, "failed to update the job to mark failed: id=%s", req.Id)
+			}
+			return nil
 		}); err != nil {
-			return nil, errors.Wrap(err, "failed to add new retry jobs (some retries are remaining for this job): id=%s", req.Id)
-		}
-
-		if _, err = tx.StmtContext(ctx, q.updateJobStatusStatement).ExecContext(ctx, queue.StatusFailed, queue.SubStatusRetryPendingError, req.Id, part); err != nil {
-			return nil, errors.Wrap(err, "failed to update the job to mark failed: id=%s", req.Id)
+			return nil, err
 		}
 
 		result.RetryJobId = scheduleResponse.Id
@@ -121,7 +126,7 @@ func (q *queueImpl) internalUpdateJobData(ctx context.Context, req queue.UpdateJ
 	properties := ""
 	if req.Properties != nil {
 		// properties = req.Properties
-		if properties, err = serialization.Stringify(req.Properties); err != nil {
+		if properties, err = q.encodeProperties(req.Properties); err != nil {
 			return nil, fmt.Errorf("failed to persist (metadata is bad): %w", err)
 		}
 	}
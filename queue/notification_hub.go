@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"sync"
+)
+
+type notificationKey struct {
+	tenant  int
+	jobType int
+}
+
+// NotificationHub is an in-process hub to wake up pollers waiting for jobs of a (tenant, job type).
+// A poller subscribes before it polls, and waits on the channel if there was nothing to run. Schedule in the same
+// process notifies the hub, which closes the channel and wakes all its waiters
+type NotificationHub struct {
+	mu       *sync.Mutex
+	channels map[notificationKey]chan struct{}
+}
+
+// Subscribe gives a channel which is closed on the next Notify for this tenant and job type
+func (n *NotificationHub) Subscribe(tenant int, jobType int) <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := notificationKey{tenant: tenant, jobType: jobType}
+	ch, ok := n.channels[key]
+	if !ok {
+		ch = make(chan struct{})
+		n.channels[key] = ch
+	}
+	return ch
+}
+
+// Notify wakes up all subscribers of this tenant and job type
+func (n *NotificationHub) Notify(tenant int, jobType int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := notificationKey{tenant: tenant, jobType: jobType}
+	if ch, ok := n.channels[key]; ok {
+		close(ch)
+		delete(n.channels, key)
+	}
+}
+
+func NewNotificationHub() *NotificationHub {
+	return &NotificationHub{mu: &sync.Mutex{}, channels: map[notificationKey]chan struct{}{}}
+}
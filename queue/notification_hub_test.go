@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNotificationHub(t *testing.T) {
+	hub := NewNotificationHub()
+
+	first := hub.Subscribe(1, 2)
+	second := hub.Subscribe(1, 2)
+	otherJobType := hub.Subscribe(1, 3)
+
+	hub.Notify(1, 2)
+	select {
+	case <-first:
+	case <-time.After(time.Second):
+		t.Fatal("subscriber must be woken up on notify")
+	}
+	select {
+	case <-second:
+	case <-time.After(time.Second):
+		t.Fatal("all subscribers must be woken up on notify")
+	}
+	select {
+	case <-otherJobType:
+		t.Fatal("subscriber of other job type must not be woken up")
+	default:
+	}
+
+	// A new subscription waits for the next notify
+	third := hub.Subscribe(1, 2)
+	select {
+	case <-third:
+		t.Fatal("new subscriber must wait for the next notify")
+	default:
+	}
+	hub.Notify(1, 2)
+	_, open := <-third
+	assert.False(t, open)
+}
@@ -0,0 +1,494 @@
+// Package queuetest has a conformance test suite to check that a queue.Queue implementation behaves like the MySQL
+// backed queue. Use it in the tests of your implementation:
+//
+//	func TestConformance(t *testing.T) {
+//		queuetest.RunConformance(t, func(t *testing.T) queue.Queue {
+//			q, err := NewQueue(...)
+//			require.NoError(t, err)
+//			return q
+//		})
+//	}
+package queuetest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/queue"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tenant and JobType are used by all jobs scheduled in the conformance suite
+const (
+	Tenant  = 78
+	JobType = 79
+)
+
+// Factory gives the queue to be tested. It is called once for each test case and must give a queue which has no
+// scheduled job of Tenant and JobType (e.g. a shared DB must be cleaned up by factory)
+type Factory func(t *testing.T) queue.Queue
+
+// RunConformance runs all conformance test cases against the queue given by factory
+func RunConformance(t *testing.T, factory Factory) {
+	t.Run("Schedule", func(t *testing.T) { testSchedule(t, factory(t)) })
+	t.Run("DelayedVisibility", func(t *testing.T) { testDelayedVisibility(t, factory(t)) })
+	t.Run("PollResponseErrorHint", func(t *testing.T) { testPollResponseErrorHint(t, factory(t)) })
+	t.Run("NoJobToRun", func(t *testing.T) { testNoJobToRun(t, factory(t)) })
+	t.Run("RetryGroup", func(t *testing.T) { testRetryGroup(t, factory(t)) })
+	t.Run("RemainingExecutionExhausted", func(t *testing.T) { testRemainingExecutionExhausted(t, factory(t)) })
+	t.Run("UpdateJobData", func(t *testing.T) { testUpdateJobData(t, factory(t)) })
+	t.Run("PropertiesRoundTrip", func(t *testing.T) { testPropertiesRoundTrip(t, factory(t)) })
+	t.Run("ConcurrentPollersDoNotDoubleClaim", func(t *testing.T) { testConcurrentPollers(t, factory(t)) })
+	t.Run("FetchJobs", func(t *testing.T) { testFetchJobs(t, factory(t)) })
+	t.Run("ExportImport", func(t *testing.T) { testExportImport(t, factory(t)) })
+}
+
+func newContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func pollRequest() queue.PollRequest {
+	return queue.PollRequest{Tenant: Tenant, JobType: JobType}
+}
+
+func scheduleRequest(at time.Time) queue.ScheduleRequest {
+	return queue.ScheduleRequest{Tenant: Tenant, JobType: JobType, At: at, RemainingExecution: 3}
+}
+
+// pollUntilJob keeps polling (as per PollResponseError hint) till it gets a job or timeout is over
+func pollUntilJob(t *testing.T, ctx context.Context, q queue.Queue, timeout time.Duration) *queue.PollResponse {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		result, err := q.Poll(ctx, pollRequest())
+		if err == nil {
+			return result
+		}
+		var e *queue.PollResponseError
+		require.True(t, errors.As(err, &e), "expected PollResponseError while waiting for job: err=%v", err)
+		time.Sleep(e.WaitForDurationBeforeTrying)
+	}
+	require.FailNow(t, fmt.Sprintf("no job received in %s", timeout))
+	return nil
+}
+
+func testSchedule(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+	rs, err := q.Schedule(ctx, queue.ScheduleRequest{Tenant: Tenant, JobType: JobType, At: time.Now(), RemainingExecution: 3, CorrelationId: "order-1"})
+	require.NoError(t, err)
+	require.NotEmpty(t, rs.Id)
+
+	jd, err := q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
+	require.NoError(t, err)
+	assert.Equal(t, rs.Id, jd.Id)
+	assert.Equal(t, queue.StatusScheduled, jd.State)
+	assert.Equal(t, queue.SubStatusScheduledOk, jd.SubState)
+	assert.Equal(t, 3, jd.RemainingExecution)
+	assert.Equal(t, Tenant, jd.Tenant)
+	assert.Equal(t, JobType, jd.JobType)
+	assert.Equal(t, "order-1", jd.CorrelationId)
+	assert.NotEmpty(t, jd.RetryGroup)
+
+	// Poll gives the job, marks it processing and uses one execution
+	pollResult, err := q.Poll(ctx, pollRequest())
+	require.NoError(t, err)
+	assert.Equal(t, rs.Id, pollResult.Id)
+	jd, err = q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusProcessing, jd.State)
+	assert.Equal(t, queue.SubStatusScheduledOk, jd.SubState)
+	assert.Equal(t, 2, jd.RemainingExecution)
+
+	_, err = q.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: rs.Id})
+	require.NoError(t, err)
+	jd, err = q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusDone, jd.State)
+	assert.Equal(t, queue.SubStatusDone, jd.SubState)
+
+	// Min one execution, even if caller did not set it
+	rs, err = q.Schedule(ctx, queue.ScheduleRequest{Tenant: Tenant, JobType: JobType, At: time.Now()})
+	require.NoError(t, err)
+	jd, err = q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
+	require.NoError(t, err)
+	assert.Equal(t, 1, jd.RemainingExecution)
+	_, _ = q.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: rs.Id})
+}
+
+func testDelayedVisibility(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+	at := time.Now().Add(1500 * time.Millisecond)
+	rs, err := q.Schedule(ctx, scheduleRequest(at))
+	require.NoError(t, err)
+
+	// Not visible before its time
+	_, err = q.Poll(ctx, pollRequest())
+	var e *queue.PollResponseError
+	require.True(t, errors.As(err, &e), "job in future must not be given: err=%v", err)
+
+	// Visible once its time has come
+	pollResult := pollUntilJob(t, ctx, q, 5*time.Second)
+	assert.Equal(t, rs.Id, pollResult.Id)
+	assert.False(t, time.Now().Before(at.Truncate(time.Second)))
+	_, _ = q.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: rs.Id})
+}
+
+func testPollResponseErrorHint(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+	now := time.Now()
+	at := now.Add(10 * time.Second)
+	rs, err := q.Schedule(ctx, scheduleRequest(at))
+	require.NoError(t, err)
+
+	_, err = q.Poll(ctx, pollRequest())
+	var e *queue.PollResponseError
+	require.True(t, errors.As(err, &e))
+	assert.True(t, e.WaitForDurationBeforeTrying > 0, "wait hint must be positive: %s", e.WaitForDurationBeforeTrying)
+	assert.True(t, e.WaitForDurationBeforeTrying <= time.Second, "wait hint must be capped to 1 sec: %s", e.WaitForDurationBeforeTrying)
+	assert.Equal(t, at.Truncate(time.Second).Unix(), e.NextJobTimeAvailableForProcessing.Unix())
+
+	jd, err := q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusScheduled, jd.State)
+	_, _ = q.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: rs.Id})
+}
+
+func testNoJobToRun(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+	_, err := q.Poll(ctx, pollRequest())
+	assert.True(t, pkgErrors.Is(err, queue.NoJobsToRunAtCurrently), "empty queue must give NoJobsToRunAtCurrently: err=%v", err)
+
+	// Job of other job type must not be given
+	rs, err := q.Schedule(ctx, queue.ScheduleRequest{Tenant: Tenant, JobType: JobType + 1, At: time.Now()})
+	require.NoError(t, err)
+	_, err = q.Poll(ctx, pollRequest())
+	assert.True(t, pkgErrors.Is(err, queue.NoJobsToRunAtCurrently), "job of other job type must not be given: err=%v", err)
+	_, _ = q.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: rs.Id})
+}
+
+func testRetryGroup(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+	rs, err := q.Schedule(ctx, scheduleRequest(time.Now()))
+	require.NoError(t, err)
+	pollResult, err := q.Poll(ctx, pollRequest())
+	require.NoError(t, err)
+	require.Equal(t, rs.Id, pollResult.Id)
+
+	// Retry in the next second - attempts are ordered by id, and ids of jobs scheduled in the same second are not ordered
+	retry, err := q.MarkJobFailedAndScheduleRetry(ctx, queue.MarkJobFailedWithRetryRequest{Id: rs.Id, ScheduleRetryAt: time.Now().Add(time.Second), FailureReason: "downstream timeout"})
+	require.NoError(t, err)
+	assert.True(t, retry.Done)
+	require.NotEmpty(t, retry.RetryJobId)
+
+	first, err := q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusFailed, first.State)
+	assert.Equal(t, queue.SubStatusRetryPendingError, first.SubState)
+
+	// Retry job carries the remaining executions and retry group of the failed job
+	second, err := q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: retry.RetryJobId})
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusScheduled, second.State)
+	assert.Equal(t, 2, second.RemainingExecution)
+	assert.Equal(t, first.RetryGroup, second.RetryGroup)
+
+	pollResult = pollUntilJob(t, ctx, q, 5*time.Second)
+	assert.Equal(t, retry.RetryJobId, pollResult.Id)
+
+	history, err := q.FetchRetryGroup(ctx, queue.FetchRetryGroupRequest{RetryGroupId: first.RetryGroup})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(history.Attempts))
+	assert.Equal(t, rs.Id, history.Attempts[0].Id)
+	assert.Equal(t, queue.SubStatusRetryPendingError, history.Attempts[0].SubState)
+	assert.Equal(t, "downstream timeout", history.Attempts[0].FailureReason)
+	assert.Equal(t, retry.RetryJobId, history.Attempts[1].Id)
+	assert.Equal(t, queue.StatusProcessing, history.Attempts[1].State)
+	_, _ = q.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: retry.RetryJobId})
+}
+
+func testRemainingExecutionExhausted(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+	rs, err := q.Schedule(ctx, queue.ScheduleRequest{Tenant: Tenant, JobType: JobType, At: time.Now(), RemainingExecution: 2})
+	require.NoError(t, err)
+
+	id := rs.Id
+	for execution := 1; execution <= 2; execution++ {
+		pollResult := pollUntilJob(t, ctx, q, 5*time.Second)
+		require.Equal(t, id, pollResult.Id, "execution=%d", execution)
+
+		retry, err := q.MarkJobFailedAndScheduleRetry(ctx, queue.MarkJobFailedWithRetryRequest{Id: id, ScheduleRetryAt: time.Now()})
+		require.NoError(t, err)
+		if execution == 1 {
+			require.True(t, retry.Done)
+			id = retry.RetryJobId
+		} else {
+			// No execution is left - job is failed and no retry is scheduled
+			assert.False(t, retry.Done)
+			assert.Empty(t, retry.RetryJobId)
+		}
+	}
+
+	jd, err := q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: id})
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusFailed, jd.State)
+	assert.Equal(t, queue.SubStatusNoRetryPendingError, jd.SubState)
+	assert.Equal(t, 0, jd.RemainingExecution)
+
+	_, err = q.Poll(ctx, pollRequest())
+	assert.True(t, pkgErrors.Is(err, queue.NoJobsToRunAtCurrently), "no job must be left: err=%v", err)
+
+	history, err := q.FetchRetryGroup(ctx, queue.FetchRetryGroupRequest{RetryGroupId: jd.RetryGroup})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(history.Attempts))
+}
+
+func testUpdateJobData(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+	rs, err := q.Schedule(ctx, queue.ScheduleRequest{
+		Tenant:             Tenant,
+		JobType:            JobType,
+		At:                 time.Now(),
+		RemainingExecution: 3,
+		StringUdf1:         "str_udf_1",
+		StringUdf2:         "str_udf_2",
+		IntUdf1:            10,
+		IntUdf2:            11,
+		Properties:         map[string]interface{}{"info": "5510"},
+	})
+	require.NoError(t, err)
+
+	jd, err := q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
+	require.NoError(t, err)
+	assert.Equal(t, "str_udf_1", jd.StringUdf1)
+	assert.Equal(t, "str_udf_2", jd.StringUdf2)
+	assert.Equal(t, 10, jd.IntUdf1)
+	assert.Equal(t, 11, jd.IntUdf2)
+	assert.Equal(t, "5510", jd.Properties["info"])
+
+	_, err = q.UpdateJobData(ctx, queue.UpdateJobDataRequest{
+		Id:         rs.Id,
+		StringUdf1: "str_udf_1_updated",
+		StringUdf2: "str_udf_2_updated",
+		IntUdf1:    110,
+		IntUdf2:    111,
+		Properties: map[string]interface{}{"info": "15510"},
+	})
+	require.NoError(t, err)
+
+	jd, err = q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusScheduled, jd.State)
+	assert.Equal(t, 3, jd.RemainingExecution)
+	assert.Equal(t, "str_udf_1_updated", jd.StringUdf1)
+	assert.Equal(t, "str_udf_2_updated", jd.StringUdf2)
+	assert.Equal(t, 110, jd.IntUdf1)
+	assert.Equal(t, 111, jd.IntUdf2)
+	assert.Equal(t, "15510", jd.Properties["info"])
+	_, _ = q.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: rs.Id})
+}
+
+func testPropertiesRoundTrip(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+
+	// Properties are kept as json - numbers come back as float64, nested objects as maps
+	properties := map[string]interface{}{
+		"string": "value",
+		"number": float64(10.5),
+		"bool":   true,
+		"list":   []interface{}{"a", float64(1)},
+		"nested": map[string]interface{}{"key": "nested_value"},
+		"utf8":   "नमस्ते",
+	}
+	rs, err := q.Schedule(ctx, queue.ScheduleRequest{Tenant: Tenant, JobType: JobType, At: time.Now(), RemainingExecution: 2, Properties: properties})
+	require.NoError(t, err)
+
+	jd, err := q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: rs.Id})
+	require.NoError(t, err)
+	assert.Equal(t, properties, jd.Properties)
+
+	// Properties must also be carried to the retry job
+	pollResult, err := q.Poll(ctx, pollRequest())
+	require.NoError(t, err)
+	retry, err := q.MarkJobFailedAndScheduleRetry(ctx, queue.MarkJobFailedWithRetryRequest{Id: pollResult.Id, ScheduleRetryAt: time.Now()})
+	require.NoError(t, err)
+	require.True(t, retry.Done)
+	jd, err = q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: retry.RetryJobId})
+	require.NoError(t, err)
+	assert.Equal(t, properties, jd.Properties)
+	_, _ = q.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: retry.RetryJobId})
+}
+
+func testConcurrentPollers(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+	const jobCount = 100
+	const pollerCount = 10
+
+	scheduled := map[string]bool{}
+	for i := 0; i < jobCount; i++ {
+		rs, err := q.Schedule(ctx, queue.ScheduleRequest{Tenant: Tenant, JobType: JobType, At: time.Now().Add(-time.Second), Properties: map[string]interface{}{"index": i}})
+		require.NoError(t, err)
+		scheduled[rs.Id] = true
+	}
+
+	// Each poller keeps polling till queue is empty - every job must be claimed by exactly one poller
+	claimed := map[string]int{}
+	var claimedLock sync.Mutex
+	errs := make(chan error, pollerCount)
+	wg := sync.WaitGroup{}
+	for p := 0; p < pollerCount; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				result, err := q.Poll(ctx, pollRequest())
+				var e *queue.PollResponseError
+				if pkgErrors.Is(err, queue.NoJobsToRunAtCurrently) {
+					return
+				} else if errors.As(err, &e) {
+					time.Sleep(e.WaitForDurationBeforeTrying)
+					continue
+				} else if err != nil {
+					errs <- err
+					return
+				}
+				claimedLock.Lock()
+				claimed[result.Id]++
+				claimedLock.Unlock()
+				_, _ = q.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: result.Id})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, jobCount, len(claimed))
+	for id, count := range claimed {
+		assert.True(t, scheduled[id], "claimed a job which was not scheduled: id=%s", id)
+		assert.Equal(t, 1, count, "job claimed more than once: id=%s", id)
+	}
+}
+
+// futureWindow gives a time window (1 year from now) which has no job from other tests - FetchJobs and Export use it
+// as filter, so that jobs left by other test runs in a shared DB are not picked
+func futureWindow() (from time.Time, to time.Time) {
+	from = time.Now().Add(365 * 24 * time.Hour).Add(time.Duration(rand.Intn(1000000)) * time.Minute).Truncate(time.Second)
+	return from, from.Add(time.Hour)
+}
+
+func markCompleted(t *testing.T, ctx context.Context, q queue.Queue, ids ...string) {
+	for _, id := range ids {
+		_, err := q.MarkJobCompleted(ctx, queue.MarkJobCompletedRequest{Id: id})
+		assert.NoError(t, err)
+	}
+}
+
+func testFetchJobs(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+	from, to := futureWindow()
+
+	ids := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		rs, err := q.Schedule(ctx, scheduleRequest(from.Add(time.Duration(i)*time.Second)))
+		require.NoError(t, err)
+		ids = append(ids, rs.Id)
+	}
+	defer markCompleted(t, ctx, q, ids...)
+
+	// Read all jobs in pages of 2 - they must come in the order of id
+	req := queue.FetchJobsRequest{Tenant: Tenant, JobTypes: []int{JobType}, States: []int{queue.StatusScheduled}, ProcessAtFrom: from, ProcessAtTo: to, Limit: 2}
+	fetched := make([]string, 0)
+	pages := 0
+	for {
+		result, err := q.FetchJobs(ctx, req)
+		require.NoError(t, err)
+		pages++
+		for _, jd := range result.Jobs {
+			assert.Equal(t, Tenant, jd.Tenant)
+			assert.Equal(t, JobType, jd.JobType)
+			fetched = append(fetched, jd.Id)
+		}
+		if result.NextAfterId == "" {
+			break
+		}
+		req.AfterId = result.NextAfterId
+	}
+	assert.Equal(t, ids, fetched)
+	assert.Equal(t, 3, pages)
+
+	// Filters
+	result, err := q.FetchJobs(ctx, queue.FetchJobsRequest{Tenant: Tenant, JobTypes: []int{JobType + 1}, ProcessAtFrom: from, ProcessAtTo: to})
+	require.NoError(t, err)
+	assert.Empty(t, result.Jobs)
+	result, err = q.FetchJobs(ctx, queue.FetchJobsRequest{Tenant: Tenant, States: []int{queue.StatusScheduled}, ProcessAtFrom: from.Add(time.Second), ProcessAtTo: from.Add(3 * time.Second)})
+	require.NoError(t, err)
+	require.Len(t, result.Jobs, 2)
+	assert.Equal(t, ids[1:3], []string{result.Jobs[0].Id, result.Jobs[1].Id})
+	assert.Empty(t, result.NextAfterId)
+}
+
+func testExportImport(t *testing.T, q queue.Queue) {
+	ctx := newContext(t)
+	from, to := futureWindow()
+
+	ids := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		req := scheduleRequest(from.Add(time.Duration(i) * time.Second))
+		req.CorrelationId = fmt.Sprintf("correlation-%d", i)
+		req.StringUdf1 = fmt.Sprintf("udf-%d", i)
+		req.IntUdf1 = i
+		req.Properties = map[string]interface{}{"index": float64(i)}
+		rs, err := q.Schedule(ctx, req)
+		require.NoError(t, err)
+		ids = append(ids, rs.Id)
+	}
+	defer markCompleted(t, ctx, q, ids...)
+
+	buf := &bytes.Buffer{}
+	count, err := queue.Export(ctx, q, queue.ExportFilter{Tenant: Tenant, States: []int{queue.StatusScheduled}, ProcessAtFrom: from, ProcessAtTo: to, PageSize: 2}, buf)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 4, bytes.Count(buf.Bytes(), []byte("\n")), "header + 3 jobs")
+
+	// Replay them one hour later with new ids
+	exportedAt := time.Now()
+	result, err := queue.Import(ctx, q, bytes.NewReader(buf.Bytes()), queue.ImportOptions{RebaseTo: exportedAt.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Imported)
+
+	newIds := make([]string, 0)
+	for i, id := range ids {
+		newId := result.IdMapping[id]
+		require.NotEmpty(t, newId)
+		assert.NotEqual(t, id, newId)
+		newIds = append(newIds, newId)
+
+		original, err := q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: id})
+		require.NoError(t, err)
+		imported, err := q.FetchJobDetails(ctx, queue.JobDetailsRequest{Id: newId})
+		require.NoError(t, err)
+		assert.Equal(t, queue.StatusScheduled, imported.State)
+		assert.Equal(t, original.CorrelationId, imported.CorrelationId)
+		assert.Equal(t, original.StringUdf1, imported.StringUdf1)
+		assert.Equal(t, i, imported.IntUdf1)
+		assert.Equal(t, original.Properties, imported.Properties)
+		assert.Equal(t, original.RemainingExecution, imported.RemainingExecution)
+		assert.NotEqual(t, original.RetryGroup, imported.RetryGroup)
+		assert.Equal(t, result.RetryGroupMapping[original.RetryGroup], imported.RetryGroup)
+
+		// Export was done a moment before exportedAt, so the shift is at most 1 hour
+		shift := imported.At.Sub(original.At)
+		assert.True(t, shift <= time.Hour && shift > time.Hour-10*time.Second, "shift=%s", shift)
+	}
+	markCompleted(t, ctx, q, newIds...)
+}
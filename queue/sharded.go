@@ -0,0 +1,274 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/devlibx/gox-base/util"
+	pkgErrors "github.com/pkg/errors"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ShardKeyFunc gives the key used to pick the shard for a new job
+type ShardKeyFunc func(req ScheduleRequest) string
+
+// ShardByTenant puts all jobs of a tenant in the same shard
+func ShardByTenant(req ScheduleRequest) string {
+	return fmt.Sprintf("%d", req.Tenant)
+}
+
+// ShardByCorrelationId puts all jobs with same correlation id in the same shard
+func ShardByCorrelationId(req ScheduleRequest) string {
+	return req.CorrelationId
+}
+
+// ShardByStringUdf1 puts all jobs with same string udf 1 in the same shard
+func ShardByStringUdf1(req ScheduleRequest) string {
+	return req.StringUdf1
+}
+
+// shardedQueue spreads jobs over many queues (e.g. each backed by a different MySQL). The shard of a job is kept in
+// the job id (see ShardIdGenerator), so all id based calls go to the shard which has the job
+type shardedQueue struct {
+	shards       []Queue
+	shardKeyFunc ShardKeyFunc
+	pollCounter  uint64
+}
+
+// IdGeneratorProvider is implemented by queues which can tell the id generator used for new jobs (MySQL and in-memory
+// queue do). Sharded queue needs it to check that a shard generates ids of its own shard
+type IdGeneratorProvider interface {
+	IdGenerator() IdGenerator
+}
+
+// NewShardedQueue gives a queue over the given shards. Shard at index i must generate ids using
+// NewShardIdGenerator(i) e.g. mysqlQueue.NewQueue(cf, storeBackends[i], config, NewShardIdGenerator(i), rewriter).
+// Every shard must implement IdGeneratorProvider - a probe id is generated for each shard, and a shard whose id does
+// not belong to it is rejected here (a job with such id could not be found again after it is scheduled)
+func NewShardedQueue(shards []Queue, shardKeyFunc ShardKeyFunc) (Queue, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("sharded queue needs at least one shard")
+	} else if len(shards) > MaxShards {
+		return nil, errors.New("sharded queue supports max %d shards: shards=%d", MaxShards, len(shards))
+	} else if shardKeyFunc == nil {
+		return nil, errors.New("shard key func is required to build sharded queue")
+	}
+
+	for i, shard := range shards {
+		var idGenerator IdGenerator
+		if p, ok := shard.(IdGeneratorProvider); ok {
+			idGenerator = p.IdGenerator()
+		}
+		if idGenerator == nil {
+			return nil, errors.New("shard queue does not give its id generator (it must implement IdGeneratorProvider): shard=%d", i)
+		}
+		id, err := GenerateIdE(idGenerator, time.Now())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate probe id of shard queue: shard=%d", i)
+		}
+		if idShard, err := ShardFromId(id); err != nil || idShard != i {
+			return nil, errors.New("shard queue generates ids which do not belong to the shard (use NewShardIdGenerator for shard queue): shard=%d, probeId=%s", i, id)
+		}
+	}
+	return &shardedQueue{shards: shards, shardKeyFunc: shardKeyFunc}, nil
+}
+
+func (s *shardedQueue) shardForId(id string) (Queue, error) {
+	shard, err := ShardFromId(id)
+	if err != nil {
+		return nil, err
+	} else if shard >= len(s.shards) {
+		return nil, errors.New("job id has a shard which does not exist: id=%s, shard=%d, shards=%d", id, shard, len(s.shards))
+	}
+	return s.shards[shard], nil
+}
+
+func (s *shardedQueue) Schedule(ctx context.Context, req ScheduleRequest) (*ScheduleResponse, error) {
+	shard := util.StringToHashMod(s.shardKeyFunc(req), len(s.shards))
+	return s.shards[shard].Schedule(ctx, req)
+}
+
+// Poll picks a job from shards - every call starts with the next shard so that all shards are drained evenly
+func (s *shardedQueue) Poll(ctx context.Context, req PollRequest) (*PollResponse, error) {
+	if req.LongPollTimeout <= 0 {
+		return s.pollOnce(ctx, req)
+	}
+
+	// Long poll all shards together - we can not block on a single shard
+	deadline := time.Now().Add(req.LongPollTimeout)
+	req.LongPollTimeout = 0
+	for {
+		result, err := s.pollOnce(ctx, req)
+		if err == nil {
+			return result, nil
+		}
+
+		var pollResponseError *PollResponseError
+		wait := 100 * time.Millisecond
+		if errors.As(err, &pollResponseError) && pollResponseError.WaitForDurationBeforeTrying < wait {
+			wait = pollResponseError.WaitForDurationBeforeTrying
+		} else if !errors.As(err, &pollResponseError) && !pkgErrors.Is(err, NoJobsToRunAtCurrently) {
+			return nil, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, err
+		} else if wait > remaining {
+			wait = remaining
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Wrap(ctx.Err(), "long poll cancelled: tenant=%d, jobType=%d", req.Tenant, req.JobType)
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *shardedQueue) pollOnce(ctx context.Context, req PollRequest) (*PollResponse, error) {
+	start := int(atomic.AddUint64(&s.pollCounter, 1) % uint64(len(s.shards)))
+
+	var earliestPollResponseError *PollResponseError
+	var pausedError *JobTypePausedError
+	var otherError error
+	for i := 0; i < len(s.shards); i++ {
+		result, err := s.shards[(start+i)%len(s.shards)].Poll(ctx, req)
+		if err == nil {
+			return result, nil
+		}
+
+		var pollResponseError *PollResponseError
+		var jobTypePausedError *JobTypePausedError
+		if errors.As(err, &pollResponseError) {
+			if earliestPollResponseError == nil || pollResponseError.NextJobTimeAvailableForProcessing.Before(earliestPollResponseError.NextJobTimeAvailableForProcessing) {
+				earliestPollResponseError = pollResponseError
+			}
+		} else if errors.As(err, &jobTypePausedError) {
+			pausedError = jobTypePausedError
+		} else if !pkgErrors.Is(err, NoJobsToRunAtCurrently) && otherError == nil {
+			otherError = err
+		}
+	}
+
+	// Nothing to run in any shard - give the most useful error back
+	if earliestPollResponseError != nil {
+		return nil, earliestPollResponseError
+	} else if otherError != nil {
+		return nil, otherError
+	} else if pausedError != nil {
+		return nil, pausedError
+	}
+	return nil, errors.Wrap(NoJobsToRunAtCurrently, "no job in any shard: jobType=%d tenant=%d", req.JobType, req.Tenant)
+}
+
+func (s *shardedQueue) FetchJobDetails(ctx context.Context, req JobDetailsRequest) (*JobDetailsResponse, error) {
+	shard, err := s.shardForId(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return shard.FetchJobDetails(ctx, req)
+}
+
+func (s *shardedQueue) MarkJobFailedAndScheduleRetry(ctx context.Context, req MarkJobFailedWithRetryRequest) (*MarkJobFailedWithRetryResponse, error) {
+	shard, err := s.shardForId(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return shard.MarkJobFailedAndScheduleRetry(ctx, req)
+}
+
+func (s *shardedQueue) MarkJobCompleted(ctx context.Context, req MarkJobCompletedRequest) (*MarkJobCompletedResponse, error) {
+	shard, err := s.shardForId(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return shard.MarkJobCompleted(ctx, req)
+}
+
+func (s *shardedQueue) UpdateJobData(ctx context.Context, req UpdateJobDataRequest) (*UpdateJobDataResponse, error) {
+	shard, err := s.shardForId(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return shard.UpdateJobData(ctx, req)
+}
+
+// FetchRetryGroup - retry group id does not have a shard, but all attempts of a job are in the same shard
+func (s *shardedQueue) FetchRetryGroup(ctx context.Context, req FetchRetryGroupRequest) (*FetchRetryGroupResponse, error) {
+	for _, shard := range s.shards {
+		result, err := shard.FetchRetryGroup(ctx, req)
+		if err != nil {
+			return nil, err
+		} else if len(result.Attempts) > 0 {
+			return result, nil
+		}
+	}
+	return &FetchRetryGroupResponse{RetryGroupId: req.RetryGroupId, Attempts: make([]JobAttempt, 0)}, nil
+}
+
+// FetchJobs gives the jobs with the smallest ids from all shards - each shard gives its first page and they are merged
+func (s *shardedQueue) FetchJobs(ctx context.Context, req FetchJobsRequest) (*FetchJobsResponse, error) {
+	jobs := make([]*JobDetailsResponse, 0)
+	more := false
+	for i, shard := range s.shards {
+		result, err := shard.FetchJobs(ctx, req)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch jobs from shard=%d", i)
+		}
+		jobs = append(jobs, result.Jobs...)
+		more = more || result.NextAfterId != ""
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Id < jobs[k].Id })
+
+	result := &FetchJobsResponse{Jobs: jobs}
+	if len(jobs) > req.PageSize() {
+		result.Jobs = jobs[:req.PageSize()]
+		more = true
+	}
+	if more && len(result.Jobs) > 0 {
+		result.NextAfterId = result.Jobs[len(result.Jobs)-1].Id
+	}
+	return result, nil
+}
+
+// PauseJobType pauses the job type in all shards
+func (s *shardedQueue) PauseJobType(ctx context.Context, req PauseJobTypeRequest) (*PauseJobTypeResponse, error) {
+	for i, shard := range s.shards {
+		if _, err := shard.PauseJobType(ctx, req); err != nil {
+			return nil, errors.Wrap(err, "failed to pause job type in shard=%d", i)
+		}
+	}
+	return &PauseJobTypeResponse{}, nil
+}
+
+// ResumeJobType resumes the job type in all shards
+func (s *shardedQueue) ResumeJobType(ctx context.Context, req ResumeJobTypeRequest) (*ResumeJobTypeResponse, error) {
+	for i, shard := range s.shards {
+		if _, err := shard.ResumeJobType(ctx, req); err != nil {
+			return nil, errors.Wrap(err, "failed to resume job type in shard=%d", i)
+		}
+	}
+	return &ResumeJobTypeResponse{}, nil
+}
+
+// FetchJobTypePauseStatus gives paused status if job type is paused in any shard
+func (s *shardedQueue) FetchJobTypePauseStatus(ctx context.Context, req JobTypePauseStatusRequest) (result *JobTypePauseStatusResponse, err error) {
+	for i, shard := range s.shards {
+		var status *JobTypePauseStatusResponse
+		if status, err = shard.FetchJobTypePauseStatus(ctx, req); err != nil {
+			return nil, errors.Wrap(err, "failed to get pause status from shard=%d", i)
+		}
+		if result == nil || status.Paused {
+			result = status
+		}
+		if status.Paused {
+			break
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/errors"
+	"github.com/google/uuid"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+// shardStubQueue keeps jobs in memory - enough to check routing of sharded queue
+type shardStubQueue struct {
+	Queue
+	idGenerator IdGenerator
+	jobs        []string
+	paused      bool
+}
+
+func (s *shardStubQueue) Schedule(ctx context.Context, req ScheduleRequest) (*ScheduleResponse, error) {
+	id := s.idGenerator.GenerateId(time.Now())
+	s.jobs = append(s.jobs, id)
+	return &ScheduleResponse{Id: id}, nil
+}
+
+func (s *shardStubQueue) IdGenerator() IdGenerator {
+	return s.idGenerator
+}
+
+func (s *shardStubQueue) Poll(ctx context.Context, req PollRequest) (*PollResponse, error) {
+	if s.paused {
+		return nil, &JobTypePausedError{Tenant: req.Tenant, JobType: req.JobType}
+	} else if len(s.jobs) == 0 {
+		return nil, errors.Wrap(NoJobsToRunAtCurrently, "no job")
+	}
+	id := s.jobs[0]
+	s.jobs = s.jobs[1:]
+	return &PollResponse{Id: id}, nil
+}
+
+func (s *shardStubQueue) FetchJobDetails(ctx context.Context, req JobDetailsRequest) (*JobDetailsResponse, error) {
+	for _, id := range s.jobs {
+		if id == req.Id {
+			return &JobDetailsResponse{Id: id}, nil
+		}
+	}
+	return nil, errors.New("job not found: id=%s", req.Id)
+}
+
+func (s *shardStubQueue) FetchJobs(ctx context.Context, req FetchJobsRequest) (*FetchJobsResponse, error) {
+	ids := make([]string, 0)
+	for _, id := range s.jobs {
+		if id > req.AfterId {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	result := &FetchJobsResponse{}
+	if len(ids) > req.PageSize() {
+		ids = ids[:req.PageSize()]
+		result.NextAfterId = ids[len(ids)-1]
+	}
+	for _, id := range ids {
+		result.Jobs = append(result.Jobs, &JobDetailsResponse{Id: id})
+	}
+	return result, nil
+}
+
+func (s *shardStubQueue) PauseJobType(ctx context.Context, req PauseJobTypeRequest) (*PauseJobTypeResponse, error) {
+	s.paused = true
+	return &PauseJobTypeResponse{}, nil
+}
+
+func TestShardIdGenerator(t *testing.T) {
+	_, err := NewShardIdGenerator(MaxShards)
+	assert.Error(t, err)
+
+	g, err := NewShardIdGenerator(7)
+	assert.NoError(t, err)
+	now := time.Now()
+	id := g.GenerateId(now)
+
+	shard, err := ShardFromId(id)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, shard)
+
+	// Id is still a ULID with the time it was generated for
+	idTime, err := RecordIdToTime(id)
+	assert.NoError(t, err)
+	assert.Equal(t, now.UnixMilli(), idTime.UnixMilli())
+
+	_, err = ShardFromId("not-a-ulid")
+	assert.Error(t, err)
+}
+
+func TestShardedQueue(t *testing.T) {
+	ctx := context.Background()
+	shards := make([]*shardStubQueue, 4)
+	queues := make([]Queue, 4)
+	for i := range shards {
+		g, _ := NewShardIdGenerator(i)
+		shards[i] = &shardStubQueue{idGenerator: g}
+		queues[i] = shards[i]
+	}
+	q, err := NewShardedQueue(queues, ShardByCorrelationId)
+	assert.NoError(t, err)
+
+	t.Run("same shard key goes to same shard", func(t *testing.T) {
+		first, err := q.Schedule(ctx, ScheduleRequest{CorrelationId: "user-1"})
+		assert.NoError(t, err)
+		second, err := q.Schedule(ctx, ScheduleRequest{CorrelationId: "user-1"})
+		assert.NoError(t, err)
+
+		firstShard, _ := ShardFromId(first.Id)
+		secondShard, _ := ShardFromId(second.Id)
+		assert.Equal(t, firstShard, secondShard)
+
+		// Id based calls go back to the shard which has the job
+		jd, err := q.FetchJobDetails(ctx, JobDetailsRequest{Id: second.Id})
+		assert.NoError(t, err)
+		assert.Equal(t, second.Id, jd.Id)
+	})
+
+	t.Run("poll drains all shards", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			_, err := q.Schedule(ctx, ScheduleRequest{CorrelationId: uuid.NewString()})
+			assert.NoError(t, err)
+		}
+		for i := 0; i < 22; i++ {
+			_, err := q.Poll(ctx, PollRequest{})
+			assert.NoError(t, err)
+		}
+		_, err := q.Poll(ctx, PollRequest{})
+		assert.True(t, pkgErrors.Is(err, NoJobsToRunAtCurrently))
+
+		// Long poll gives up after timeout
+		_, err = q.Poll(ctx, PollRequest{LongPollTimeout: 50 * time.Millisecond})
+		assert.True(t, pkgErrors.Is(err, NoJobsToRunAtCurrently))
+	})
+
+	t.Run("paused in all shards", func(t *testing.T) {
+		_, err := q.PauseJobType(ctx, PauseJobTypeRequest{Tenant: 1, JobType: 2})
+		assert.NoError(t, err)
+		_, err = q.Poll(ctx, PollRequest{Tenant: 1, JobType: 2})
+		var pausedError *JobTypePausedError
+		assert.True(t, errors.As(err, &pausedError))
+	})
+
+	t.Run("shard queue without shard id generator is rejected when sharded queue is built", func(t *testing.T) {
+		g, _ := NewRandomUuidIdGenerator()
+		_, err := NewShardedQueue([]Queue{&shardStubQueue{idGenerator: g}, &shardStubQueue{idGenerator: g}}, ShardByTenant)
+		assert.Error(t, err)
+	})
+
+	t.Run("shard queue with id generator of another shard is rejected when sharded queue is built", func(t *testing.T) {
+		g0, _ := NewShardIdGenerator(0)
+		g1, _ := NewShardIdGenerator(1)
+		_, err := NewShardedQueue([]Queue{&shardStubQueue{idGenerator: g1}, &shardStubQueue{idGenerator: g0}}, ShardByTenant)
+		assert.Error(t, err)
+	})
+
+	t.Run("shard queue which does not give its id generator is rejected when sharded queue is built", func(t *testing.T) {
+		g, _ := NewShardIdGenerator(0)
+		_, err := NewShardedQueue([]Queue{struct{ Queue }{&shardStubQueue{idGenerator: g}}}, ShardByTenant)
+		assert.Error(t, err)
+	})
+}
+
+func TestShardedQueue_FetchJobs(t *testing.T) {
+	ctx := context.Background()
+	queues := make([]Queue, 3)
+	for i := range queues {
+		g, _ := NewShardIdGenerator(i)
+		queues[i] = &shardStubQueue{idGenerator: g}
+	}
+	q, err := NewShardedQueue(queues, ShardByCorrelationId)
+	assert.NoError(t, err)
+
+	scheduled := make([]string, 0)
+	for i := 0; i < 25; i++ {
+		rs, err := q.Schedule(ctx, ScheduleRequest{CorrelationId: uuid.NewString()})
+		assert.NoError(t, err)
+		scheduled = append(scheduled, rs.Id)
+	}
+	sort.Strings(scheduled)
+
+	fetched := make([]string, 0)
+	req := FetchJobsRequest{Limit: 4}
+	for {
+		result, err := q.FetchJobs(ctx, req)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(result.Jobs), 4)
+		for _, jd := range result.Jobs {
+			fetched = append(fetched, jd.Id)
+		}
+		if result.NextAfterId == "" {
+			break
+		}
+		req.AfterId = result.NextAfterId
+	}
+	assert.Equal(t, scheduled, fetched)
+}
@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/util"
+	"github.com/opentracing/opentracing-go"
+)
+
+// TraceContextPropertyKey is the reserved key in job properties which keeps the trace context of the span which was
+// active when the job was scheduled.
+//
+// NOTE - only OpenTracing is supported: the trace context is read from and written with opentracing.GlobalTracer().
+// A native OpenTelemetry propagator is out of scope (this module does not depend on OpenTelemetry) - an OpenTelemetry
+// user must set the OpenTelemetry OpenTracing bridge as the global tracer
+const TraceContextPropertyKey = "_trace_context"
+
+// InjectTraceContext gives properties with the trace context of the active span in ctx (under TraceContextPropertyKey).
+// The given map is not changed. Properties are returned as-is if ctx has no span or properties already have a trace
+// context (e.g. a retry keeps the trace context of the original job)
+func InjectTraceContext(ctx context.Context, properties map[string]interface{}) map[string]interface{} {
+	if _, ok := properties[TraceContextPropertyKey]; ok {
+		return properties
+	}
+	carrier := util.OpentracingInjectSpanContext(ctx)
+	if len(carrier) == 0 {
+		return properties
+	}
+
+	result := make(map[string]interface{}, len(properties)+1)
+	for k, v := range properties {
+		result[k] = v
+	}
+	result[TraceContextPropertyKey] = carrier
+	return result
+}
+
+// ExtractTraceContext gives the trace context stored in job properties by InjectTraceContext (nil if there is none)
+func ExtractTraceContext(properties map[string]interface{}) map[string]string {
+	switch v := properties[TraceContextPropertyKey].(type) {
+	case map[string]string:
+		return v
+	case map[string]interface{}:
+		carrier := make(map[string]string, len(v))
+		for k, value := range v {
+			if s, ok := value.(string); ok {
+				carrier[k] = s
+			}
+		}
+		return carrier
+	}
+	return nil
+}
+
+// StartSpanForJob starts a span to process the job, as a child of the span which scheduled it (a root span if the job
+// has no trace context). The returned context has the new span - caller must finish the span
+func StartSpanForJob(ctx context.Context, operationName string, job *JobDetailsResponse) (opentracing.Span, context.Context) {
+	return startSpanForJob(ctx, operationName, job, false)
+}
+
+// StartLinkedSpanForJob is same as StartSpanForJob but the span follows from (rather than is a child of) the span which
+// scheduled the job. Use it when the job runs long after it was scheduled e.g. a delayed job or a retry
+func StartLinkedSpanForJob(ctx context.Context, operationName string, job *JobDetailsResponse) (opentracing.Span, context.Context) {
+	return startSpanForJob(ctx, operationName, job, true)
+}
+
+func startSpanForJob(ctx context.Context, operationName string, job *JobDetailsResponse, followsFrom bool) (opentracing.Span, context.Context) {
+	return util.OpentracingStartSpanFromTextMap(
+		ctx,
+		operationName,
+		ExtractTraceContext(job.Properties),
+		followsFrom,
+		opentracing.Tag{Key: "job.id", Value: job.Id},
+		opentracing.Tag{Key: "job.type", Value: job.JobType},
+		opentracing.Tag{Key: "job.tenant", Value: job.Tenant},
+	)
+}
@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func setupMockTracer(t *testing.T) *mocktracer.MockTracer {
+	old := opentracing.GlobalTracer()
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	t.Cleanup(func() { opentracing.SetGlobalTracer(old) })
+	return tracer
+}
+
+// toStoredProperties gives properties as they come back from DB (json)
+func toStoredProperties(t *testing.T, properties map[string]interface{}) map[string]interface{} {
+	b, err := json.Marshal(properties)
+	assert.NoError(t, err)
+	result := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(b, &result))
+	return result
+}
+
+func TestInjectTraceContext_NoSpan(t *testing.T) {
+	setupMockTracer(t)
+	properties := map[string]interface{}{"name": "harish"}
+	assert.Equal(t, properties, InjectTraceContext(context.Background(), properties))
+	assert.Nil(t, InjectTraceContext(context.Background(), nil))
+}
+
+func TestTraceContext_ChildSpan(t *testing.T) {
+	tracer := setupMockTracer(t)
+	parent := tracer.StartSpan("schedule")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	properties := map[string]interface{}{"name": "harish"}
+	injected := InjectTraceContext(ctx, properties)
+	assert.NotContains(t, properties, TraceContextPropertyKey)
+	assert.Contains(t, injected, TraceContextPropertyKey)
+	assert.Equal(t, "harish", injected["name"])
+
+	job := &JobDetailsResponse{Id: "job-1", JobType: 2, Tenant: 3, Properties: toStoredProperties(t, injected)}
+	span, spanCtx := StartSpanForJob(context.Background(), "process", job)
+	assert.Equal(t, span, opentracing.SpanFromContext(spanCtx))
+	span.Finish()
+	parent.Finish()
+
+	child := span.(*mocktracer.MockSpan)
+	assert.Equal(t, parent.(*mocktracer.MockSpan).SpanContext.TraceID, child.SpanContext.TraceID)
+	assert.Equal(t, parent.(*mocktracer.MockSpan).SpanContext.SpanID, child.ParentID)
+	assert.Equal(t, "job-1", child.Tag("job.id"))
+	assert.Equal(t, 2, child.Tag("job.type"))
+	assert.Equal(t, 3, child.Tag("job.tenant"))
+}
+
+func TestTraceContext_LinkedSpan(t *testing.T) {
+	tracer := setupMockTracer(t)
+	parent := tracer.StartSpan("schedule")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	job := &JobDetailsResponse{Id: "job-1", Properties: toStoredProperties(t, InjectTraceContext(ctx, nil))}
+	span, _ := StartLinkedSpanForJob(context.Background(), "process", job)
+	span.Finish()
+
+	linked := span.(*mocktracer.MockSpan)
+	assert.Equal(t, parent.(*mocktracer.MockSpan).SpanContext.TraceID, linked.SpanContext.TraceID)
+	assert.Equal(t, parent.(*mocktracer.MockSpan).SpanContext.SpanID, linked.ParentID)
+}
+
+func TestTraceContext_RetryKeepsOriginalTraceContext(t *testing.T) {
+	tracer := setupMockTracer(t)
+	original := tracer.StartSpan("schedule")
+	properties := InjectTraceContext(opentracing.ContextWithSpan(context.Background(), original), nil)
+
+	// Retry is scheduled while processing the job - it must keep the trace context of the original job
+	worker := tracer.StartSpan("process")
+	retry := InjectTraceContext(opentracing.ContextWithSpan(context.Background(), worker), toStoredProperties(t, properties))
+	assert.Equal(t, ExtractTraceContext(properties), ExtractTraceContext(retry))
+}
+
+func TestStartSpanForJob_NoTraceContext(t *testing.T) {
+	setupMockTracer(t)
+	span, _ := StartSpanForJob(context.Background(), "process", &JobDetailsResponse{Id: "job-1"})
+	span.Finish()
+	assert.Equal(t, 0, span.(*mocktracer.MockSpan).ParentID)
+}
+
+func TestTyped_DecodeIgnoresTraceContext(t *testing.T) {
+	tracer := setupMockTracer(t)
+	typed, err := NewTyped[otpPayloadV1](&propertiesStoringQueue{data: map[string]string{}}, TypedConfig{PayloadVersion: 1, DisallowUnknownFields: true})
+	assert.NoError(t, err)
+
+	properties, err := typed.encode(otpPayloadV1{Phone: "1234"})
+	assert.NoError(t, err)
+	span := tracer.StartSpan("schedule")
+	properties = InjectTraceContext(opentracing.ContextWithSpan(context.Background(), span), properties)
+
+	payload, _, err := typed.decode(toStoredProperties(t, properties))
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", payload.Phone)
+}
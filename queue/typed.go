@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/devlibx/gox-base/errors"
+)
+
+// PayloadVersionPropertyKey is the reserved key in job properties which keeps the version of the typed payload
+const PayloadVersionPropertyKey = "_payload_version"
+
+// PayloadUpcaster converts properties of a payload from version "fromVersion" to "fromVersion+1". Numbers in properties
+// are json.Number if the queue gives the stored json (see JobDetailsResponse.RawProperties)
+type PayloadUpcaster func(fromVersion int, properties map[string]interface{}) (map[string]interface{}, error)
+
+// TypedConfig is the config for a Typed queue client
+type TypedConfig struct {
+	// PayloadVersion is the current version of the payload struct (default = 1). Jobs scheduled with an older
+	// version are upcasted to this version on fetch
+	PayloadVersion int
+
+	// Upcasters to move a payload from a version (key) to the next version. Properties written by an untyped client
+	// do not have a version and are treated as version 1
+	Upcasters map[int]PayloadUpcaster
+
+	// DisallowUnknownFields fails decoding if properties have a field which is not in the payload struct
+	DisallowUnknownFields bool
+}
+
+// Typed is a queue client which keeps a struct of type T as job properties. Calls which do not deal with
+// properties (Poll, MarkJobCompleted etc) are served by the underlying Queue
+type Typed[T any] struct {
+	Queue
+	config TypedConfig
+}
+
+// TypedJobDetailsResponse is JobDetailsResponse with properties decoded in T
+type TypedJobDetailsResponse[T any] struct {
+	*JobDetailsResponse
+	Payload T
+
+	// PayloadVersion is the version the job was scheduled with (before upcasting)
+	PayloadVersion int
+}
+
+// NewTyped gives a typed client on top of the given queue
+func NewTyped[T any](q Queue, config TypedConfig) (*Typed[T], error) {
+	if q == nil {
+		return nil, errors.New("queue is required to build typed queue")
+	}
+	if config.PayloadVersion <= 0 {
+		config.PayloadVersion = 1
+	}
+	if config.Upcasters == nil {
+		config.Upcasters = map[int]PayloadUpcaster{}
+	}
+	return &Typed[T]{Queue: q, config: config}, nil
+}
+
+// Schedule puts a job with given payload on the queue. req.Properties must not be set, it is built from payload
+func (t *Typed[T]) Schedule(ctx context.Context, req ScheduleRequest, payload T) (*ScheduleResponse, error) {
+	if req.Properties != nil {
+		return nil, errors.New("properties must not be set in typed schedule request - it is built from the payload")
+	}
+
+	var err error
+	if req.Properties, err = t.encode(payload); err != nil {
+		return nil, errors.Wrap(err, "failed to schedule typed job: %v", req)
+	}
+	return t.Queue.Schedule(ctx, req)
+}
+
+// FetchJobDetails gives job details with properties decoded (and upcasted if needed) in T
+func (t *Typed[T]) FetchJobDetails(ctx context.Context, req JobDetailsRequest) (*TypedJobDetailsResponse[T], error) {
+	jd, err := t.Queue.FetchJobDetails(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stored json is read again (if the queue gives it) - numbers in Properties are float64 and lose large int64 values
+	properties := jd.Properties
+	if jd.RawProperties != nil {
+		if properties, err = decodeJsonObject(jd.RawProperties); err != nil {
+			return nil, errors.Wrap(err, "failed to read properties of job: id=%s", req.Id)
+		}
+	}
+
+	result := &TypedJobDetailsResponse[T]{JobDetailsResponse: jd}
+	if result.Payload, result.PayloadVersion, err = t.decode(properties); err != nil {
+		return nil, errors.Wrap(err, "failed to decode payload of job: id=%s", req.Id)
+	}
+	return result, nil
+}
+
+// UpdateJobData updates job data with the given payload. req.Properties must not be set, it is built from payload
+func (t *Typed[T]) UpdateJobData(ctx context.Context, req UpdateJobDataRequest, payload T) (*UpdateJobDataResponse, error) {
+	if req.Properties != nil {
+		return nil, errors.New("properties must not be set in typed update request - it is built from the payload")
+	}
+
+	var err error
+	if req.Properties, err = t.encode(payload); err != nil {
+		return nil, errors.Wrap(err, "failed to update typed job data: id=%s", req.Id)
+	}
+	return t.Queue.UpdateJobData(ctx, req)
+}
+
+func (t *Typed[T]) encode(payload T) (properties map[string]interface{}, err error) {
+	var b []byte
+	if b, err = json.Marshal(payload); err != nil {
+		return nil, errors.Wrap(err, "failed to serialize payload")
+	}
+
+	if properties, err = decodeJsonObject(b); err != nil {
+		return nil, errors.Wrap(err, "payload must serialize to a json object")
+	} else if _, ok := properties[PayloadVersionPropertyKey]; ok {
+		return nil, errors.New("payload must not have a field named %s", PayloadVersionPropertyKey)
+	} else if _, ok := properties[TraceContextPropertyKey]; ok {
+		return nil, errors.New("payload must not have a field named %s", TraceContextPropertyKey)
+	}
+	properties[PayloadVersionPropertyKey] = t.config.PayloadVersion
+	return properties, nil
+}
+
+func (t *Typed[T]) decode(properties map[string]interface{}) (payload T, version int, err error) {
+	data := make(map[string]interface{}, len(properties))
+	for k, v := range properties {
+		data[k] = v
+	}
+	delete(data, TraceContextPropertyKey)
+
+	// Properties from an untyped client do not have a version
+	version = 1
+	if v, ok := data[PayloadVersionPropertyKey]; ok {
+		if n, ok := v.(json.Number); ok {
+			i, e := n.Int64()
+			if e != nil {
+				return payload, 0, errors.New("payload version is not a number: %v", v)
+			}
+			version = int(i)
+		} else if f, ok := v.(float64); ok {
+			version = int(f)
+		} else if i, ok := v.(int); ok {
+			version = i
+		} else {
+			return payload, 0, errors.New("payload version is not a number: %v", v)
+		}
+		delete(data, PayloadVersionPropertyKey)
+	}
+
+	if version > t.config.PayloadVersion {
+		return payload, version, errors.New("payload version %d is newer than the version %d known to this client", version, t.config.PayloadVersion)
+	}
+
+	// Upcast one version at a time till we reach the current version
+	for from := version; from < t.config.PayloadVersion; from++ {
+		upcaster, ok := t.config.Upcasters[from]
+		if !ok {
+			return payload, version, errors.New("missing upcaster to move payload from version %d to %d", from, from+1)
+		}
+		if data, err = upcaster(from, data); err != nil {
+			return payload, version, errors.Wrap(err, "failed to upcast payload from version %d to %d", from, from+1)
+		}
+	}
+
+	var b []byte
+	if b, err = json.Marshal(data); err != nil {
+		return payload, version, errors.Wrap(err, "failed to serialize properties")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	if t.config.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err = decoder.Decode(&payload); err != nil {
+		return payload, version, errors.Wrap(err, "failed to read properties in payload")
+	}
+	return payload, version, nil
+}
+
+// decodeJsonObject reads a json object with numbers kept as json.Number, so int64 values above 2^53 are not changed
+func decodeJsonObject(b []byte) (map[string]interface{}, error) {
+	object := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// propertiesStoringQueue keeps properties as json - same as they are kept in DB
+type propertiesStoringQueue struct {
+	Queue
+	data map[string]string
+}
+
+func (p *propertiesStoringQueue) Schedule(ctx context.Context, req ScheduleRequest) (*ScheduleResponse, error) {
+	b, _ := json.Marshal(req.Properties)
+	p.data["1"] = string(b)
+	return &ScheduleResponse{Id: "1"}, nil
+}
+
+func (p *propertiesStoringQueue) FetchJobDetails(ctx context.Context, req JobDetailsRequest) (*JobDetailsResponse, error) {
+	properties := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(p.data[req.Id]), &properties)
+	return &JobDetailsResponse{Id: req.Id, Properties: properties, RawProperties: []byte(p.data[req.Id])}, nil
+}
+
+type otpPayloadV1 struct {
+	Phone string `json:"phone"`
+}
+
+type idPayload struct {
+	UserId int64 `json:"user_id"`
+}
+
+type otpPayloadV2 struct {
+	Phone       string `json:"phone"`
+	CountryCode string `json:"country_code"`
+}
+
+func TestTypedQueue(t *testing.T) {
+	ctx := context.Background()
+	store := &propertiesStoringQueue{data: map[string]string{}}
+
+	t.Run("payload round trip", func(t *testing.T) {
+		q, err := NewTyped[otpPayloadV1](store, TypedConfig{})
+		assert.NoError(t, err)
+
+		rs, err := q.Schedule(ctx, ScheduleRequest{JobType: 1}, otpPayloadV1{Phone: "1234"})
+		assert.NoError(t, err)
+		jd, err := q.FetchJobDetails(ctx, JobDetailsRequest{Id: rs.Id})
+		assert.NoError(t, err)
+		assert.Equal(t, "1234", jd.Payload.Phone)
+		assert.Equal(t, 1, jd.PayloadVersion)
+
+		_, err = q.Schedule(ctx, ScheduleRequest{JobType: 1, Properties: map[string]interface{}{}}, otpPayloadV1{Phone: "1234"})
+		assert.Error(t, err, "properties must not be set with typed payload")
+	})
+
+	t.Run("old payload is upcasted", func(t *testing.T) {
+		v1, _ := NewTyped[otpPayloadV1](store, TypedConfig{PayloadVersion: 1})
+		rs, err := v1.Schedule(ctx, ScheduleRequest{JobType: 1}, otpPayloadV1{Phone: "1234"})
+		assert.NoError(t, err)
+
+		v2, _ := NewTyped[otpPayloadV2](store, TypedConfig{
+			PayloadVersion: 2,
+			Upcasters: map[int]PayloadUpcaster{
+				1: func(fromVersion int, properties map[string]interface{}) (map[string]interface{}, error) {
+					properties["country_code"] = "+91"
+					return properties, nil
+				},
+			},
+		})
+		jd, err := v2.FetchJobDetails(ctx, JobDetailsRequest{Id: rs.Id})
+		assert.NoError(t, err)
+		assert.Equal(t, otpPayloadV2{Phone: "1234", CountryCode: "+91"}, jd.Payload)
+		assert.Equal(t, 1, jd.PayloadVersion)
+
+		// v1 client can not read a payload written by v2
+		rs, err = v2.Schedule(ctx, ScheduleRequest{JobType: 1}, otpPayloadV2{Phone: "1234", CountryCode: "+1"})
+		assert.NoError(t, err)
+		_, err = v1.FetchJobDetails(ctx, JobDetailsRequest{Id: rs.Id})
+		assert.Error(t, err)
+	})
+
+	t.Run("large int64 is not changed", func(t *testing.T) {
+		q, _ := NewTyped[idPayload](store, TypedConfig{})
+		rs, err := q.Schedule(ctx, ScheduleRequest{JobType: 1}, idPayload{UserId: 1<<62 + 1})
+		assert.NoError(t, err)
+		jd, err := q.FetchJobDetails(ctx, JobDetailsRequest{Id: rs.Id})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1<<62+1), jd.Payload.UserId)
+
+		// Queue which keeps properties as given (no stored json) also gives the exact value
+		properties, err := q.encode(idPayload{UserId: 1<<62 + 1})
+		assert.NoError(t, err)
+		payload, _, err := q.decode(properties)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1<<62+1), payload.UserId)
+	})
+
+	t.Run("unknown fields fail decoding in strict mode", func(t *testing.T) {
+		v2, _ := NewTyped[otpPayloadV2](store, TypedConfig{PayloadVersion: 1})
+		rs, err := v2.Schedule(ctx, ScheduleRequest{JobType: 1}, otpPayloadV2{Phone: "1234", CountryCode: "+1"})
+		assert.NoError(t, err)
+
+		strict, _ := NewTyped[otpPayloadV1](store, TypedConfig{PayloadVersion: 1, DisallowUnknownFields: true})
+		_, err = strict.FetchJobDetails(ctx, JobDetailsRequest{Id: rs.Id})
+		assert.Error(t, err)
+	})
+}
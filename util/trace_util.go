@@ -1,6 +1,9 @@
 package util
 
-import "github.com/opentracing/opentracing-go"
+import (
+	"context"
+	"github.com/opentracing/opentracing-go"
+)
 
 func OpentracingLogError(spanName string, err error) {
 	if opentracing.GlobalTracer() != nil {
@@ -39,3 +42,36 @@ func OpentracingLogError3(spanName string, err error, key string, value interfac
 		span.Finish()
 	}
 }
+
+// OpentracingInjectSpanContext gives the span context of the active span in ctx as a text map, which can be stored and
+// passed to OpentracingStartSpanFromTextMap later (e.g. in another process). It gives nil if ctx has no span or the
+// tracer did not inject anything (e.g. noop tracer)
+func OpentracingInjectSpanContext(ctx context.Context) map[string]string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	carrier := opentracing.TextMapCarrier{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil || len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// OpentracingStartSpanFromTextMap starts a span which refers to the span context in carrier (a child span, or a span
+// which follows from it if followsFrom is true). It starts a root span if carrier has no span context.
+// The returned context has the new span - caller must finish the span
+func OpentracingStartSpanFromTextMap(ctx context.Context, operationName string, carrier map[string]string, followsFrom bool, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
+	tracer := opentracing.GlobalTracer()
+	if len(carrier) > 0 {
+		if spanContext, err := tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier(carrier)); err == nil {
+			if followsFrom {
+				opts = append(opts, opentracing.FollowsFrom(spanContext))
+			} else {
+				opts = append(opts, opentracing.ChildOf(spanContext))
+			}
+		}
+	}
+	span := tracer.StartSpan(operationName, opts...)
+	return span, opentracing.ContextWithSpan(ctx, span)
+}